@@ -0,0 +1,165 @@
+package binary
+
+import "sync"
+
+const arenaChunkSize = 4096
+
+// arena hands out the slices of a decoded module from a few large chunks
+// instead of one allocation per slice. Chunks are kept when the arena is
+// released, so a pooled arena decodes the next module without allocating.
+type arena struct {
+	valTypes valTypeSlab
+	indices  indexSlab
+	locals   localsSlab
+	instrs   instrSlab
+	exprBuf  []Instruction // scratch space for readExpr
+}
+
+var arenaPool = sync.Pool{
+	New: func() interface{} { return &arena{} },
+}
+
+// DecodeArena decodes like Decode, but carves the module's slices out of
+// a pooled arena. The module, and everything reachable from it, must not
+// be used after release is called.
+func DecodeArena(data []byte) (module Module, release func(), err error) {
+	a := arenaPool.Get().(*arena)
+	once := sync.Once{}
+	release = func() {
+		once.Do(func() {
+			a.reset()
+			arenaPool.Put(a)
+		})
+	}
+
+	module, err = decode(data, DefaultDecodeOptions(), a)
+	if err != nil {
+		release()
+		return Module{}, func() {}, err
+	}
+
+	return module, release, nil
+}
+
+func (a *arena) reset() {
+	a.valTypes.reset()
+	a.indices.reset()
+	a.locals.reset()
+	a.instrs.reset()
+	for i := range a.exprBuf {
+		a.exprBuf[i] = Instruction{}
+	}
+	a.exprBuf = a.exprBuf[:0]
+}
+
+func chunkSize(n int) int {
+	if n > arenaChunkSize {
+		return n
+	}
+	return arenaChunkSize
+}
+
+type valTypeSlab struct {
+	chunks [][]ValType
+	cur    int
+}
+
+func (s *valTypeSlab) alloc(n int) []ValType {
+	for ; s.cur < len(s.chunks); s.cur++ {
+		c := s.chunks[s.cur]
+		if cap(c)-len(c) >= n {
+			s.chunks[s.cur] = c[:len(c)+n]
+			return c[len(c) : len(c)+n : len(c)+n]
+		}
+	}
+	c := make([]ValType, n, chunkSize(n))
+	s.chunks = append(s.chunks, c)
+	return c[:n:n]
+}
+
+func (s *valTypeSlab) reset() {
+	for i, c := range s.chunks {
+		s.chunks[i] = c[:0]
+	}
+	s.cur = 0
+}
+
+type indexSlab struct {
+	chunks [][]uint32
+	cur    int
+}
+
+func (s *indexSlab) alloc(n int) []uint32 {
+	for ; s.cur < len(s.chunks); s.cur++ {
+		c := s.chunks[s.cur]
+		if cap(c)-len(c) >= n {
+			s.chunks[s.cur] = c[:len(c)+n]
+			return c[len(c) : len(c)+n : len(c)+n]
+		}
+	}
+	c := make([]uint32, n, chunkSize(n))
+	s.chunks = append(s.chunks, c)
+	return c[:n:n]
+}
+
+func (s *indexSlab) reset() {
+	for i, c := range s.chunks {
+		s.chunks[i] = c[:0]
+	}
+	s.cur = 0
+}
+
+type localsSlab struct {
+	chunks [][]Locals
+	cur    int
+}
+
+func (s *localsSlab) alloc(n int) []Locals {
+	for ; s.cur < len(s.chunks); s.cur++ {
+		c := s.chunks[s.cur]
+		if cap(c)-len(c) >= n {
+			s.chunks[s.cur] = c[:len(c)+n]
+			return c[len(c) : len(c)+n : len(c)+n]
+		}
+	}
+	c := make([]Locals, n, chunkSize(n))
+	s.chunks = append(s.chunks, c)
+	return c[:n:n]
+}
+
+func (s *localsSlab) reset() {
+	for i, c := range s.chunks {
+		s.chunks[i] = c[:0]
+	}
+	s.cur = 0
+}
+
+type instrSlab struct {
+	chunks [][]Instruction
+	cur    int
+}
+
+func (s *instrSlab) alloc(n int) []Instruction {
+	for ; s.cur < len(s.chunks); s.cur++ {
+		c := s.chunks[s.cur]
+		if cap(c)-len(c) >= n {
+			s.chunks[s.cur] = c[:len(c)+n]
+			return c[len(c) : len(c)+n : len(c)+n]
+		}
+	}
+	c := make([]Instruction, n, chunkSize(n))
+	s.chunks = append(s.chunks, c)
+	return c[:n:n]
+}
+
+// reset also clears the instructions so the arena doesn't keep their
+// arguments alive while it sits in the pool
+func (s *instrSlab) reset() {
+	for i, c := range s.chunks {
+		for j := range c {
+			c[j] = Instruction{}
+		}
+		s.chunks[i] = c[:0]
+	}
+	s.cur = 0
+}
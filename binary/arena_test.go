@@ -0,0 +1,77 @@
+package binary
+
+import (
+	"io/ioutil"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func readTestdata(tb testing.TB, name string) []byte {
+	tb.Helper()
+	data, err := ioutil.ReadFile("../testdata/" + name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeArena(t *testing.T) {
+	data := readTestdata(t, "hw_rust.wasm")
+	want := mustDecode(t, data)
+	for i := 0; i < 2; i++ { // the second time reuses the pooled arena
+		got, release, err := DecodeArena(data)
+		if err != nil {
+			t.Fatalf("DecodeArena: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("DecodeArena decoded a different module than Decode")
+		}
+		release()
+	}
+}
+
+// benchDecodeGC runs decode b.N times alongside a fixed live heap, so
+// that the collector has the same work per cycle for every decoder, and
+// reports the number of collections and their total pause time per op
+func benchDecodeGC(b *testing.B, decode func(data []byte) error) {
+	data := readTestdata(b, "hw_rust.wasm")
+	live := make([]*[64]byte, 1<<18)
+	for i := range live {
+		live[i] = new([64]byte)
+	}
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := decode(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(live)
+	b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "gcs/op")
+	b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(b.N), "gc-pause-ns/op")
+}
+
+// BenchmarkDecode is the baseline of BenchmarkDecodeArena, which should
+// allocate a fraction of the bytes and so run fewer collections
+func BenchmarkDecode(b *testing.B) {
+	benchDecodeGC(b, func(data []byte) error {
+		_, err := Decode(data)
+		return err
+	})
+}
+
+func BenchmarkDecodeArena(b *testing.B) {
+	benchDecodeGC(b, func(data []byte) error {
+		_, release, err := DecodeArena(data)
+		if err == nil {
+			release()
+		}
+		return err
+	})
+}
@@ -0,0 +1,77 @@
+package binary
+
+import "sort"
+
+// ResolveBranchTargets maps the index of each br, br_if and br_table in e
+// to the index of the instruction it jumps to: the End of a block or if,
+// or the Loop itself. Branches out of the function body go to its final
+// End. br_table is mapped to its default target, branches with an invalid
+// label are left out.
+func ResolveBranchTargets(e Expr) map[int]int {
+	// the function body is an implicit block, ended by the final End
+	ends := make(map[int]int)
+	starts := []int{-1}
+	for pc, instr := range e {
+		switch instr.Opcode {
+		case Block, Loop, If:
+			starts = append(starts, pc)
+		case End:
+			if len(starts) > 0 {
+				ends[starts[len(starts)-1]] = pc
+				starts = starts[:len(starts)-1]
+			}
+		}
+	}
+
+	targets := make(map[int]int)
+	labels := []int{-1}
+	for pc, instr := range e {
+		var depth uint32
+		switch instr.Opcode {
+		case Block, Loop, If:
+			labels = append(labels, pc)
+			continue
+		case End:
+			if len(labels) > 0 {
+				labels = labels[:len(labels)-1]
+			}
+			continue
+		case Br, BrIf:
+			depth = instr.Args.(uint32)
+		case BrTable:
+			depth = instr.Args.(BrTableArgs).Default
+		default:
+			continue
+		}
+
+		if int(depth) >= len(labels) {
+			continue
+		}
+		start := labels[len(labels)-1-int(depth)]
+		if start >= 0 && e[start].Opcode == Loop {
+			targets[pc] = start
+		} else if end, ok := ends[start]; ok {
+			targets[pc] = end
+		}
+	}
+
+	return targets
+}
+
+// BranchTarget is a branch instruction and where it jumps to, see
+// ResolveBranchTargets
+type BranchTarget struct {
+	PC     int
+	Target int
+}
+
+// SortedBranchTargets returns the result of ResolveBranchTargets ordered
+// by the index of the branch instruction
+func SortedBranchTargets(e Expr) []BranchTarget {
+	var targets []BranchTarget
+	for pc, target := range ResolveBranchTargets(e) {
+		targets = append(targets, BranchTarget{PC: pc, Target: target})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].PC < targets[j].PC })
+	return targets
+}
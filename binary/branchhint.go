@@ -0,0 +1,96 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BranchHintSecName is the name of the custom section ParseBranchHints decodes
+const BranchHintSecName = "metadata.code.branch_hint"
+
+// BranchHint tells whether a br_if or if is likely to be taken
+type BranchHint byte
+
+const (
+	BranchUnlikely BranchHint = 0
+	BranchLikely   BranchHint = 1
+)
+
+func (h BranchHint) String() string {
+	switch h {
+	case BranchUnlikely:
+		return "unlikely"
+	case BranchLikely:
+		return "likely"
+	}
+	return fmt.Sprintf("BranchHint(%d)", byte(h))
+}
+
+// BranchHints maps a function index, then the byte offset of a br_if or if
+// from the start of the function body (its locals included), to its hint
+type BranchHints map[FuncIdx]map[uint32]BranchHint
+
+// ParseBranchHints decodes a "metadata.code.branch_hint" custom section.
+// Functions must be defined in m and listed in increasing order, as must
+// the offsets in each function. If m's code offsets were recorded, see
+// DecodeOptions.RecordCodeOffsets, the offsets are checked against the
+// body sizes too.
+func ParseBranchHints(sec CustomSec, m Module) (hints BranchHints, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			hints = nil
+			switch x := r.(type) {
+			case error:
+				err = fmt.Errorf("malformed %s section: %w", BranchHintSecName, x)
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	if sec.Name != BranchHintSecName {
+		return nil, fmt.Errorf("not a %s section: %q", BranchHintSecName, sec.Name)
+	}
+	importedFuncs := m.importedCount(ImportTagFunc)
+	reader := &wasmReader{data: sec.Bytes}
+	hints = BranchHints{}
+	var lastFunc uint32
+	for i, n := 0, reader.readVarU32(); uint32(i) < n; i++ {
+		idx := reader.readVarU32()
+		if i > 0 && idx <= lastFunc {
+			panic(fmt.Errorf("function %d out of order", idx))
+		}
+		if int(idx) < importedFuncs || int(idx)-importedFuncs >= len(m.CodeSec) {
+			panic(fmt.Errorf("unknown defined function %d", idx))
+		}
+		code := m.CodeSec[int(idx)-importedFuncs]
+
+		fnHints := map[uint32]BranchHint{}
+		var last uint32
+		for j, count := 0, reader.readVarU32(); uint32(j) < count; j++ {
+			offset := reader.readVarU32()
+			if j > 0 && offset <= last {
+				panic(fmt.Errorf("function %d: offset %d out of order", idx, offset))
+			}
+			if code.End > code.Start && int(offset) >= code.End-code.Start {
+				panic(fmt.Errorf("function %d: offset %d is past the body", idx, offset))
+			}
+			if size := reader.readVarU32(); size != 1 {
+				panic(fmt.Errorf("function %d: hint size %d, expected 1", idx, size))
+			}
+			h := BranchHint(reader.readByte())
+			if h != BranchUnlikely && h != BranchLikely {
+				panic(fmt.Errorf("function %d: invalid hint %d", idx, byte(h)))
+			}
+			fnHints[offset] = h
+			last = offset
+		}
+		hints[idx] = fnHints
+		lastFunc = idx
+	}
+	if reader.remaining() > 0 {
+		panic(errors.New("section size mismatch"))
+	}
+
+	return hints, nil
+}
@@ -0,0 +1,45 @@
+package binary
+
+import "sort"
+
+// CallGraph is the static call graph of a module, imported functions
+// included as nodes without calls of their own
+type CallGraph struct {
+	// Calls maps each defined function to the functions it calls
+	// directly, sorted and without duplicates
+	Calls map[FuncIdx][]FuncIdx
+	// Indirect holds the functions that contain a call_indirect, whose
+	// callees are not known statically
+	Indirect map[FuncIdx]bool
+}
+
+// CallGraph builds the call graph from the call instructions of the
+// function bodies
+func (m Module) CallGraph() CallGraph {
+	cg := CallGraph{
+		Calls:    make(map[FuncIdx][]FuncIdx),
+		Indirect: make(map[FuncIdx]bool),
+	}
+	importedFuncs := m.importedCount(ImportTagFunc)
+	for i, code := range m.CodeSec {
+		caller := FuncIdx(importedFuncs + i)
+		seen := make(map[FuncIdx]bool)
+		var callees []FuncIdx
+		for _, instr := range code.Expr {
+			switch instr.Opcode {
+			case Call:
+				callee := instr.Args.(uint32)
+				if !seen[callee] {
+					seen[callee] = true
+					callees = append(callees, callee)
+				}
+			case CallIndirect:
+				cg.Indirect[caller] = true
+			}
+		}
+		sort.Slice(callees, func(i, j int) bool { return callees[i] < callees[j] })
+		cg.Calls[caller] = callees
+	}
+
+	return cg
+}
@@ -0,0 +1,65 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+)
+
+// dylink.0 的子段
+const (
+	dylinkMemInfo = 1
+	dylinkNeeded  = 2
+)
+
+// Dylink is the content of the "dylink.0" custom section of a dynamically
+// linkable module. The alignments are log2 of the byte alignment.
+type Dylink struct {
+	MemSize    uint32
+	MemAlign   uint32
+	TableSize  uint32
+	TableAlign uint32
+	Needed     []string // shared libraries to load first
+}
+
+// ParseDylink decodes a "dylink.0" custom section. Subsections other than
+// the memory info and the needed libraries are skipped.
+func ParseDylink(sec CustomSec) (dylink Dylink, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			dylink = Dylink{}
+			switch x := r.(type) {
+			case error:
+				err = fmt.Errorf("malformed dylink.0 section: %w", x)
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	if sec.Name != "dylink.0" {
+		return Dylink{}, fmt.Errorf("not a dylink.0 section: %q", sec.Name)
+	}
+	reader := &wasmReader{data: sec.Bytes}
+	for reader.remaining() > 0 {
+		id := reader.readByte()
+		subReader := &wasmReader{data: reader.readBytes()}
+		switch id {
+		case dylinkMemInfo:
+			dylink.MemSize = subReader.readVarU32()
+			dylink.MemAlign = subReader.readVarU32()
+			dylink.TableSize = subReader.readVarU32()
+			dylink.TableAlign = subReader.readVarU32()
+		case dylinkNeeded:
+			for n := subReader.readVarU32(); n > 0; n-- {
+				dylink.Needed = append(dylink.Needed, subReader.readName())
+			}
+		default:
+			continue
+		}
+		if subReader.remaining() > 0 {
+			panic(fmt.Errorf("subsection %d size mismatch", id))
+		}
+	}
+
+	return dylink, nil
+}
@@ -1,11 +1,76 @@
 package binary
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	errUnexpectedEnd         = errors.New("unexpected end of section or function")
 	errIntTooLong            = errors.New("integer representation too long")
 	errIntTooLarge           = errors.New("integer too large")
 	errMalformedUTF8Encoding = errors.New("malformed UTF-8 encoding")
+	errComponent             = errors.New("component-model binary, not a core module")
 	//errLenOutOfBounds = errors.New("length out of bounds")
 )
+
+// FuncBodyTooLargeError reports a function body larger than
+// DecodeOptions.MaxFuncBodyBytes. Index counts the bodies in the code
+// section, imported functions are not included.
+type FuncBodyTooLargeError struct {
+	Index int
+	Size  int
+	Max   int
+}
+
+func (e *FuncBodyTooLargeError) Error() string {
+	return fmt.Sprintf("function body %d too large: %d bytes, at most %d allowed",
+		e.Index, e.Size, e.Max)
+}
+
+// CountLimitError reports a section with more entries than the
+// DecodeOptions limit for it
+type CountLimitError struct {
+	What  string // "imports", "globals", "element segments" or "data segments"
+	Count int
+	Max   int
+}
+
+func (e *CountLimitError) Error() string {
+	return fmt.Sprintf("too many %s: %d, at most %d allowed", e.What, e.Count, e.Max)
+}
+
+// IndexError reports an index beyond the imported and defined entities of
+// its kind, see CheckIndexBounds
+type IndexError struct {
+	Where string // "function 2", "export \"f\"", "code 0"...
+	Kind  string // "type", "function", "table", "memory" or "global"
+	Idx   uint32
+	Count int // of entities of that kind
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("%s: %s index %d out of range (%d in module)", e.Where, e.Kind, e.Idx, e.Count)
+}
+
+// DecodeError is an error of Decode, with the offset in the data where
+// it was found: usually just after the malformed or unexpected bytes.
+// SecID is the section being decoded if InSection is set, errors in the
+// preamble or between sections have none.
+type DecodeError struct {
+	Offset    int
+	InSection bool
+	SecID     byte
+	Err       error
+}
+
+func (e *DecodeError) Error() string {
+	if e.InSection {
+		return fmt.Sprintf("at offset 0x%x in %s section: %s", e.Offset, SecIDToName(e.SecID), e.Err)
+	}
+	return fmt.Sprintf("at offset 0x%x: %s", e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
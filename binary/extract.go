@@ -0,0 +1,248 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// ExtractedFuncName is the export name of the function ExtractFunc
+	// isolates
+	ExtractedFuncName = "extracted"
+	// ExtractedImportModule is the module name of the imports ExtractFunc
+	// creates
+	ExtractedImportModule = "env"
+)
+
+// extractor builds the module of ExtractFunc, old indices are mapped to
+// the new ones as they are first used
+type extractor struct {
+	m       Module
+	out     Module
+	types   map[TypeIdx]TypeIdx
+	funcs   map[FuncIdx]FuncIdx
+	globals map[GlobalIdx]GlobalIdx
+	tables  map[TableIdx]TableIdx
+	hasMem  bool
+}
+
+// ExtractFunc returns a module holding only function idx, exported as
+// ExtractedFuncName. The other functions it calls or references, and the
+// globals, tables and memory it uses, become imports of
+// ExtractedImportModule named after their kind and old index, e.g.
+// "func3". Only the types it needs are kept. Functions using data or
+// element segments can not be extracted.
+func (m Module) ExtractFunc(idx FuncIdx) (out Module, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out = Module{}
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	code, err := m.Instructions(idx)
+	if err != nil {
+		return Module{}, err
+	}
+
+	x := &extractor{
+		m:       m,
+		out:     Module{Magic: MagicNumber, Version: Version},
+		types:   make(map[TypeIdx]TypeIdx),
+		funcs:   make(map[FuncIdx]FuncIdx),
+		globals: make(map[GlobalIdx]GlobalIdx),
+		tables:  make(map[TableIdx]TableIdx),
+	}
+	// 先收集导入, 定义的函数排在所有导入的函数之后, 递归调用最后再改
+	expr := make(Expr, len(code))
+	var selfRefs []int
+	for i, instr := range code {
+		if (instr.Opcode == Call || instr.Opcode == RefFunc) && instr.Args.(uint32) == idx {
+			selfRefs = append(selfRefs, i)
+			expr[i] = instr
+			continue
+		}
+		expr[i] = x.mapInstr(instr)
+	}
+	for _, i := range selfRefs {
+		expr[i].Args = FuncIdx(len(x.funcs))
+	}
+
+	typeIdx := x.typeIdx(m.funcTypeIdx(idx))
+	x.out.FuncSec = []TypeIdx{typeIdx}
+	body := m.CodeSec[int(idx)-m.importedCount(ImportTagFunc)]
+	x.out.CodeSec = []Code{{Locals: body.Locals, Expr: expr}}
+	x.out.ExportSec = []Export{{
+		Name: ExtractedFuncName,
+		Desc: ExportDesc{Tag: ExportTagFunc, Idx: FuncIdx(len(x.funcs))},
+	}}
+
+	return x.out, nil
+}
+
+// funcTypeIdx returns the type index of function idx, imported functions
+// come first
+func (m Module) funcTypeIdx(idx FuncIdx) TypeIdx {
+	for _, imp := range m.ImportSec {
+		if imp.Desc.Tag != ImportTagFunc {
+			continue
+		}
+		if idx == 0 {
+			return imp.Desc.FuncType
+		}
+		idx--
+	}
+	if int(idx) >= len(m.FuncSec) {
+		panic(fmt.Errorf("unknown function %d", idx))
+	}
+	return m.FuncSec[idx]
+}
+
+// importAt returns the idx-th import of kind tag, ok is false for a
+// defined entity
+func (m Module) importAt(tag byte, idx uint32) (imp Import, ok bool) {
+	for _, imp := range m.ImportSec {
+		if imp.Desc.Tag != tag {
+			continue
+		}
+		if idx == 0 {
+			return imp, true
+		}
+		idx--
+	}
+	return Import{}, false
+}
+
+func (x *extractor) addImport(name string, desc ImportDesc) {
+	x.out.ImportSec = append(x.out.ImportSec, Import{
+		Module: ExtractedImportModule,
+		Name:   name,
+		Desc:   desc,
+	})
+}
+
+func (x *extractor) typeIdx(old TypeIdx) TypeIdx {
+	if idx, ok := x.types[old]; ok {
+		return idx
+	}
+	if int(old) >= len(x.m.TypeSec) {
+		panic(fmt.Errorf("unknown type %d", old))
+	}
+	idx := TypeIdx(len(x.out.TypeSec))
+	x.out.TypeSec = append(x.out.TypeSec, x.m.TypeSec[old])
+	x.types[old] = idx
+	return idx
+}
+
+func (x *extractor) funcIdx(old FuncIdx) FuncIdx {
+	if idx, ok := x.funcs[old]; ok {
+		return idx
+	}
+	idx := FuncIdx(len(x.funcs))
+	x.addImport(fmt.Sprintf("func%d", old), ImportDesc{
+		Tag:      ImportTagFunc,
+		FuncType: x.typeIdx(x.m.funcTypeIdx(old)),
+	})
+	x.funcs[old] = idx
+	return idx
+}
+
+func (x *extractor) globalIdx(old GlobalIdx) GlobalIdx {
+	if idx, ok := x.globals[old]; ok {
+		return idx
+	}
+	var gt GlobalType
+	if imp, ok := x.m.importAt(ImportTagGlobal, old); ok {
+		gt = imp.Desc.Global
+	} else {
+		i := int(old) - x.m.importedCount(ImportTagGlobal)
+		if i >= len(x.m.GlobalSec) {
+			panic(fmt.Errorf("unknown global %d", old))
+		}
+		gt = x.m.GlobalSec[i].Type
+	}
+	idx := GlobalIdx(len(x.globals))
+	x.addImport(fmt.Sprintf("global%d", old), ImportDesc{Tag: ImportTagGlobal, Global: gt})
+	x.globals[old] = idx
+	return idx
+}
+
+func (x *extractor) tableIdx(old TableIdx) TableIdx {
+	if idx, ok := x.tables[old]; ok {
+		return idx
+	}
+	tt, ok := x.m.TableType(old)
+	if !ok {
+		panic(fmt.Errorf("unknown table %d", old))
+	}
+	idx := TableIdx(len(x.tables))
+	x.addImport(fmt.Sprintf("table%d", old), ImportDesc{Tag: ImportTagTable, Table: tt})
+	x.tables[old] = idx
+	return idx
+}
+
+func (x *extractor) useMemory() {
+	if x.hasMem {
+		return
+	}
+	mt, ok := MemType{}, false
+	if imp, imported := x.m.importAt(ImportTagMem, 0); imported {
+		mt, ok = imp.Desc.Mem, true
+	} else if len(x.m.MemSec) > 0 {
+		mt, ok = x.m.MemSec[0], true
+	}
+	if !ok {
+		panic(errors.New("unknown memory 0"))
+	}
+	x.addImport("memory", ImportDesc{Tag: ImportTagMem, Mem: mt})
+	x.hasMem = true
+}
+
+// mapInstr renumbers the indices instr refers to
+func (x *extractor) mapInstr(instr Instruction) Instruction {
+	if _, ok := accessSize(instr); ok {
+		x.useMemory()
+		return instr
+	}
+
+	switch instr.Opcode {
+	case Block, Loop, If:
+		bt := instr.Args.(BlockType)
+		if _, ok := bt.ValType(); !ok && bt != BlockTypeEmpty {
+			instr.Args = BlockType(x.typeIdx(TypeIdx(bt)))
+		}
+	case Call, RefFunc:
+		instr.Args = x.funcIdx(instr.Args.(uint32))
+	case CallIndirect:
+		args := instr.Args.(CallIndirectArgs)
+		args.Type = x.typeIdx(args.Type)
+		args.Table = x.tableIdx(args.Table)
+		instr.Args = args
+	case GlobalGet, GlobalSet:
+		instr.Args = x.globalIdx(instr.Args.(uint32))
+	case TableGet, TableSet:
+		instr.Args = x.tableIdx(instr.Args.(uint32))
+	case MemorySize, MemoryGrow:
+		x.useMemory()
+	case PrefixMisc:
+		switch instr.SubOpcode {
+		case MemoryCopy, MemoryFill:
+			x.useMemory()
+		case TableCopy:
+			args := instr.Args.(TableCopyArgs)
+			args.Dst = x.tableIdx(args.Dst)
+			args.Src = x.tableIdx(args.Src)
+			instr.Args = args
+		case TableGrow, TableSize, TableFill:
+			instr.Args = x.tableIdx(instr.Args.(uint32))
+		case MemoryInit, DataDrop, TableInit, ElemDrop:
+			panic(fmt.Errorf("can not extract a function using %s", instr.GetOpname()))
+		}
+	}
+	return instr
+}
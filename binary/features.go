@@ -0,0 +1,39 @@
+package binary
+
+import "fmt"
+
+// Features selects which post-MVP proposals the decoder accepts.
+// The zero value accepts the MVP only.
+type Features struct {
+	SignExtension  bool
+	SatConversion  bool
+	MultiValue     bool
+	BulkMemory     bool
+	ReferenceTypes bool
+	SIMD           bool
+	ExtendedConst  bool
+	Threads        bool
+	// GC only covers decoding the type section: recursion groups,
+	// subtypes, struct and array types
+	GC bool
+}
+
+func AllFeatures() Features {
+	return Features{
+		SignExtension:  true,
+		SatConversion:  true,
+		MultiValue:     true,
+		BulkMemory:     true,
+		ReferenceTypes: true,
+		SIMD:           true,
+		ExtendedConst:  true,
+		Threads:        true,
+		GC:             true,
+	}
+}
+
+func (reader *wasmReader) requireFeature(enabled bool, name string) {
+	if !enabled {
+		panic(fmt.Errorf("feature %s not enabled", name))
+	}
+}
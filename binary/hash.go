@@ -0,0 +1,20 @@
+package binary
+
+import "crypto/sha256"
+
+// SemanticHash returns the SHA-256 of the module as Encode writes it from
+// the decoded fields, without the custom sections: the preamble and every
+// known section, the data count section included if DataCountSec is set.
+// CustomSecs, RawSecs and Trailing are ignored, so modules differing only
+// in debug or name sections, or in how their sections were encoded, hash
+// the same. It panics if m can not be encoded.
+func (m Module) SemanticHash() [32]byte {
+	m.CustomSecs = nil
+	m.RawSecs = nil
+	m.Trailing = nil
+	data, err := Encode(m)
+	if err != nil {
+		panic(err)
+	}
+	return sha256.Sum256(data)
+}
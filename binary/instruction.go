@@ -1,3 +1,92 @@
 package binary
 
-type Expr any
+// Expr is a flat instruction sequence. Block, loop, if, else and end
+// appear as ordinary instructions, and the expression ends with the End
+// that terminates it.
+type Expr []Instruction
+
+type Instruction struct {
+	Opcode    byte
+	SubOpcode uint32 // only for prefixed opcodes (0xFC, 0xFD, 0xFE)
+	Args      interface{}
+	// Raw is the encoding the instruction was decoded from, a slice of
+	// the decoded data, see DecodeOptions.RecordInstrBytes. It is not
+	// updated when the instruction is changed and Encode ignores it.
+	Raw []byte
+}
+
+// Opcode identifies an instruction regardless of its immediates. Prefix
+// is 0 for single byte opcodes, Code is then the opcode itself.
+type Opcode struct {
+	Prefix byte
+	Code   uint32
+}
+
+func (instr Instruction) GetOpcode() Opcode {
+	switch instr.Opcode {
+	case PrefixMisc, PrefixSIMD, PrefixAtomic:
+		return Opcode{Prefix: instr.Opcode, Code: instr.SubOpcode}
+	}
+	return Opcode{Code: uint32(instr.Opcode)}
+}
+
+type BlockType int64
+
+const (
+	BlockTypeI32       BlockType = -1  // 0x7F
+	BlockTypeI64       BlockType = -2  // 0x7E
+	BlockTypeF32       BlockType = -3  // 0x7D
+	BlockTypeF64       BlockType = -4  // 0x7C
+	BlockTypeV128      BlockType = -5  // 0x7B
+	BlockTypeFuncRef   BlockType = -16 // 0x70
+	BlockTypeExternRef BlockType = -17 // 0x6F
+	BlockTypeEmpty     BlockType = -64 // 0x40
+)
+
+// ValType returns the result type of a block type that is a single value
+// type, those are encoded as the value type's byte in a one byte s33.
+func (bt BlockType) ValType() (ValType, bool) {
+	if bt < 0 && bt >= -64 && bt != BlockTypeEmpty {
+		return ValType(bt & 0x7F), true
+	}
+	return 0, false
+}
+
+type BrTableArgs struct {
+	Labels  []LabelIdx
+	Default LabelIdx
+}
+
+type CallIndirectArgs struct {
+	Type  TypeIdx
+	Table TableIdx
+}
+
+type MemArg struct {
+	Align  uint32
+	Offset uint32
+}
+
+type TableInitArgs struct {
+	Elem  ElemIdx
+	Table TableIdx
+}
+
+type TableCopyArgs struct {
+	Dst TableIdx
+	Src TableIdx
+}
+
+// V128 is the immediate of v128.const
+type V128 [16]byte
+
+type LaneIdx = byte
+
+// ShuffleArgs are the lane indices of i8x16.shuffle, each selecting one
+// of the 32 lanes of both operands
+type ShuffleArgs [16]LaneIdx
+
+type MemLaneArgs struct {
+	MemArg MemArg
+	Lane   LaneIdx
+}
@@ -0,0 +1,418 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeInstrs decodes body as the body of a function, the final end
+// added. The module has a table, a memory and a passive data segment for
+// the instructions that need them.
+func decodeInstrs(body ...byte) (Expr, error) {
+	secs := voidFunc(append(body, End)...)
+	m, err := Decode(wasm(secs[0], secs[1],
+		sec(SecTableID, 1, FuncRef, 0, 1),
+		sec(SecMemID, 1, 0, 1),
+		sec(SecDataCountID, 1),
+		secs[2],
+		sec(SecDataID, 1, 1, 0)))
+	if err != nil {
+		return nil, err
+	}
+	return m.CodeSec[0].Expr, nil
+}
+
+func mi(sub uint32, args interface{}) Instruction {
+	return Instruction{Opcode: PrefixMisc, SubOpcode: sub, Args: args}
+}
+
+func si(sub uint32, args interface{}) Instruction {
+	return Instruction{Opcode: PrefixSIMD, SubOpcode: sub, Args: args}
+}
+
+func ai(sub uint32, args interface{}) Instruction {
+	return Instruction{Opcode: PrefixAtomic, SubOpcode: sub, Args: args}
+}
+
+// golden maps hand-encoded instructions to their decoded form, the
+// final end of the body excluded
+var golden = []struct {
+	name  string
+	bytes []byte
+	want  []Instruction
+}{
+	// 控制指令
+	{"block empty", []byte{Block, 0x40, End},
+		[]Instruction{{Opcode: Block, Args: BlockTypeEmpty}, {Opcode: End}}},
+	{"block i32", []byte{Block, 0x7F, End},
+		[]Instruction{{Opcode: Block, Args: BlockTypeI32}, {Opcode: End}}},
+	{"loop f64", []byte{Loop, 0x7C, End},
+		[]Instruction{{Opcode: Loop, Args: BlockTypeF64}, {Opcode: End}}},
+	{"block v128", []byte{Block, 0x7B, End},
+		[]Instruction{{Opcode: Block, Args: BlockTypeV128}, {Opcode: End}}},
+	{"block externref", []byte{Block, 0x6F, End},
+		[]Instruction{{Opcode: Block, Args: BlockTypeExternRef}, {Opcode: End}}},
+	{"block type index 0", []byte{Block, 0x00, End},
+		[]Instruction{{Opcode: Block, Args: BlockType(0)}, {Opcode: End}}},
+	{"block type index 200", []byte{Block, 0xC8, 0x01, End},
+		[]Instruction{{Opcode: Block, Args: BlockType(200)}, {Opcode: End}}},
+	{"if else", []byte{I32Const, 0, If, 0x40, Else, End},
+		[]Instruction{{Opcode: I32Const, Args: int32(0)}, {Opcode: If, Args: BlockTypeEmpty}, {Opcode: Else}, {Opcode: End}}},
+	{"br", []byte{Br, 0}, []Instruction{{Opcode: Br, Args: uint32(0)}}},
+	{"br_if", []byte{BrIf, 0x81, 0x01}, []Instruction{{Opcode: BrIf, Args: uint32(129)}}},
+	{"br_table", []byte{BrTable, 3, 0, 1, 0x80, 0x01, 2},
+		[]Instruction{{Opcode: BrTable, Args: BrTableArgs{Labels: []LabelIdx{0, 1, 128}, Default: 2}}}},
+	{"br_table default only", []byte{BrTable, 0, 5},
+		[]Instruction{{Opcode: BrTable, Args: BrTableArgs{Labels: []LabelIdx{}, Default: 5}}}},
+	{"call", []byte{Call, 0xAC, 0x02}, []Instruction{{Opcode: Call, Args: uint32(300)}}},
+	{"call_indirect", []byte{CallIndirect, 1, 0},
+		[]Instruction{{Opcode: CallIndirect, Args: CallIndirectArgs{Type: 1}}}},
+	{"call_indirect table", []byte{CallIndirect, 0, 2},
+		[]Instruction{{Opcode: CallIndirect, Args: CallIndirectArgs{Table: 2}}}},
+
+	// 参数指令
+	{"select t", []byte{SelectT, 1, ValTypeI64},
+		[]Instruction{{Opcode: SelectT, Args: []ValType{ValTypeI64}}}},
+
+	// 变量和表指令
+	{"local.get", []byte{LocalGet, 0x80, 0x01}, []Instruction{{Opcode: LocalGet, Args: uint32(128)}}},
+	{"local.set", []byte{LocalSet, 1}, []Instruction{{Opcode: LocalSet, Args: uint32(1)}}},
+	{"local.tee", []byte{LocalTee, 2}, []Instruction{{Opcode: LocalTee, Args: uint32(2)}}},
+	{"global.get", []byte{GlobalGet, 3}, []Instruction{{Opcode: GlobalGet, Args: uint32(3)}}},
+	{"global.set", []byte{GlobalSet, 4}, []Instruction{{Opcode: GlobalSet, Args: uint32(4)}}},
+	{"table.get", []byte{TableGet, 0}, []Instruction{{Opcode: TableGet, Args: uint32(0)}}},
+	{"table.set", []byte{TableSet, 1}, []Instruction{{Opcode: TableSet, Args: uint32(1)}}},
+
+	// 内存指令
+	{"i32.load", []byte{I32Load, 2, 0}, []Instruction{{Opcode: I32Load, Args: MemArg{Align: 2}}}},
+	{"i64.load8_u", []byte{I64Load8U, 0, 16}, []Instruction{{Opcode: I64Load8U, Args: MemArg{Offset: 16}}}},
+	{"i64.store max offset", []byte{I64Store, 3, 0xFF, 0xFF, 0xFF, 0xFF, 0x0F},
+		[]Instruction{{Opcode: I64Store, Args: MemArg{Align: 3, Offset: 0xFFFFFFFF}}}},
+	{"i64.store32", []byte{I64Store32, 2, 0x80, 0x80, 0x04},
+		[]Instruction{{Opcode: I64Store32, Args: MemArg{Align: 2, Offset: 0x10000}}}},
+	{"memory.size", []byte{MemorySize, 0}, []Instruction{{Opcode: MemorySize, Args: byte(0)}}},
+	{"memory.grow", []byte{MemoryGrow, 0}, []Instruction{{Opcode: MemoryGrow, Args: byte(0)}}},
+
+	// 数值指令
+	{"i32.const -1", []byte{I32Const, 0x7F}, []Instruction{{Opcode: I32Const, Args: int32(-1)}}},
+	{"i32.const 64", []byte{I32Const, 0xC0, 0x00}, []Instruction{{Opcode: I32Const, Args: int32(64)}}},
+	{"i32.const min", []byte{I32Const, 0x80, 0x80, 0x80, 0x80, 0x78},
+		[]Instruction{{Opcode: I32Const, Args: int32(-1 << 31)}}},
+	{"i64.const -129", []byte{I64Const, 0xFF, 0x7E}, []Instruction{{Opcode: I64Const, Args: int64(-129)}}},
+	{"f32.const", []byte{F32Const, 0x00, 0x00, 0xC0, 0x3F}, []Instruction{{Opcode: F32Const, Args: float32(1.5)}}},
+	{"f64.const", []byte{F64Const, 0, 0, 0, 0, 0, 0, 0x04, 0xC0},
+		[]Instruction{{Opcode: F64Const, Args: float64(-2.5)}}},
+
+	// 引用指令
+	{"ref.null", []byte{RefNull, ExternRef}, []Instruction{{Opcode: RefNull, Args: byte(ExternRef)}}},
+	{"ref.func", []byte{RefFunc, 0}, []Instruction{{Opcode: RefFunc, Args: uint32(0)}}},
+
+	// 0xFC 前缀
+	{"memory.init", []byte{PrefixMisc, MemoryInit, 0, 0}, []Instruction{mi(MemoryInit, DataIdx(0))}},
+	{"data.drop", []byte{PrefixMisc, DataDrop, 0}, []Instruction{mi(DataDrop, DataIdx(0))}},
+	{"memory.copy", []byte{PrefixMisc, MemoryCopy, 0, 0}, []Instruction{mi(MemoryCopy, nil)}},
+	{"memory.fill", []byte{PrefixMisc, MemoryFill, 0}, []Instruction{mi(MemoryFill, nil)}},
+	{"table.init", []byte{PrefixMisc, TableInit, 1, 0},
+		[]Instruction{mi(TableInit, TableInitArgs{Elem: 1})}},
+	{"elem.drop", []byte{PrefixMisc, ElemDrop, 2}, []Instruction{mi(ElemDrop, uint32(2))}},
+	{"table.copy", []byte{PrefixMisc, TableCopy, 1, 2},
+		[]Instruction{mi(TableCopy, TableCopyArgs{Dst: 1, Src: 2})}},
+	{"table.grow", []byte{PrefixMisc, TableGrow, 0}, []Instruction{mi(TableGrow, uint32(0))}},
+	{"table.size", []byte{PrefixMisc, TableSize, 1}, []Instruction{mi(TableSize, uint32(1))}},
+	{"table.fill", []byte{PrefixMisc, TableFill, 0}, []Instruction{mi(TableFill, uint32(0))}},
+	{"i64.trunc_sat_f64_u", []byte{PrefixMisc, I64TruncSatF64U}, []Instruction{mi(I64TruncSatF64U, nil)}},
+
+	// 0xFD 前缀, 子操作码是 LEB128
+	{"v128.load", []byte{PrefixSIMD, V128Load, 4, 8}, []Instruction{si(V128Load, MemArg{Align: 4, Offset: 8})}},
+	{"v128.load64_zero", []byte{PrefixSIMD, V128Load64Zero, 3, 0},
+		[]Instruction{si(V128Load64Zero, MemArg{Align: 3})}},
+	{"v128.const", []byte{PrefixSIMD, V128Const, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		[]Instruction{si(V128Const, V128{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})}},
+	{"i8x16.shuffle", []byte{PrefixSIMD, I8x16Shuffle, 0, 31, 1, 30, 2, 29, 3, 28, 4, 27, 5, 26, 6, 25, 7, 24},
+		[]Instruction{si(I8x16Shuffle, ShuffleArgs{0, 31, 1, 30, 2, 29, 3, 28, 4, 27, 5, 26, 6, 25, 7, 24})}},
+	{"i16x8.extract_lane_u", []byte{PrefixSIMD, I16x8ExtractLaneU, 7},
+		[]Instruction{si(I16x8ExtractLaneU, LaneIdx(7))}},
+	{"v128.load32_lane", []byte{PrefixSIMD, V128Load32Lane, 2, 4, 3},
+		[]Instruction{si(V128Load32Lane, MemLaneArgs{MemArg: MemArg{Align: 2, Offset: 4}, Lane: 3})}},
+	{"i32x4.add", []byte{PrefixSIMD, 0xAE, 0x01}, []Instruction{si(I32x4Add, nil)}},
+
+	// 0xFE 前缀
+	{"atomic.fence", []byte{PrefixAtomic, AtomicFence, 0}, []Instruction{ai(AtomicFence, byte(0))}},
+	{"i32.atomic.rmw.add", []byte{PrefixAtomic, I32AtomicRmwAdd, 2, 8},
+		[]Instruction{ai(I32AtomicRmwAdd, MemArg{Align: 2, Offset: 8})}},
+}
+
+func TestDecodeGolden(t *testing.T) {
+	for _, tt := range golden {
+		expr, err := decodeInstrs(tt.bytes...)
+		if err != nil {
+			t.Errorf("%s: decoding % x: %v", tt.name, tt.bytes, err)
+			continue
+		}
+		want := append(append([]Instruction{}, tt.want...), Instruction{Opcode: End})
+		if !reflect.DeepEqual([]Instruction(expr), want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, expr, want)
+		}
+	}
+}
+
+// noImmediates returns an instruction for each opcode that has no
+// immediate
+func noImmediates() []Instruction {
+	var instrs []Instruction
+	for _, opcode := range []byte{Unreachable, Nop, Return, Drop, Select, RefIsNull} {
+		instrs = append(instrs, Instruction{Opcode: opcode})
+	}
+	for opcode := I32Eqz; opcode <= F64ReinterpretI64; opcode++ {
+		instrs = append(instrs, Instruction{Opcode: byte(opcode)})
+	}
+	for opcode := I32Extend8S; opcode <= I64Extend32S; opcode++ {
+		instrs = append(instrs, Instruction{Opcode: byte(opcode)})
+	}
+	for sub := uint32(I32TruncSatF32S); sub <= I64TruncSatF64U; sub++ {
+		instrs = append(instrs, mi(sub, nil))
+	}
+	for sub := range simdOpnames {
+		if sub > V128Const && sub != I8x16Shuffle &&
+			!(sub >= I8x16ExtractLaneS && sub <= F64x2ReplaceLane) &&
+			!(sub >= V128Load8Lane && sub <= V128Load64Zero) {
+			instrs = append(instrs, si(sub, nil))
+		}
+	}
+	return instrs
+}
+
+// TestDecodeNoImmediates decodes each opcode that has no immediate
+func TestDecodeNoImmediates(t *testing.T) {
+	for _, instr := range noImmediates() {
+		var bytes []byte
+		if instr.Opcode == PrefixMisc || instr.Opcode == PrefixSIMD {
+			bytes = append([]byte{instr.Opcode}, encodeVarUint(uint64(instr.SubOpcode))...)
+		} else {
+			bytes = []byte{instr.Opcode}
+		}
+		expr, err := decodeInstrs(bytes...)
+		if err != nil {
+			t.Errorf("%s: decoding % x: %v", instr.GetOpname(), bytes, err)
+			continue
+		}
+		if len(expr) != 2 || !reflect.DeepEqual(expr[0], instr) {
+			t.Errorf("%s: got %v, want %v", instr.GetOpname(), expr, instr)
+		}
+	}
+}
+
+// TestEncodeGolden checks that writeExpr gives back the bytes each golden
+// instruction was decoded from
+func TestEncodeGolden(t *testing.T) {
+	for _, tt := range golden {
+		writer := &wasmWriter{}
+		writer.writeExpr(tt.want)
+		if !bytes.Equal(writer.data, tt.bytes) {
+			t.Errorf("%s: got % x, want % x", tt.name, writer.data, tt.bytes)
+		}
+	}
+}
+
+// TestEncodeRoundTrip encodes every instruction shape and decodes it
+// back
+func TestEncodeRoundTrip(t *testing.T) {
+	var instrs []Instruction
+	for _, tt := range golden {
+		instrs = append(instrs, tt.want...)
+	}
+	instrs = append(instrs, noImmediates()...)
+	for _, instr := range instrs {
+		writer := &wasmWriter{}
+		switch instr.Opcode {
+		case Else, End:
+			continue // only valid in a block, which TestEncodeGolden covers
+		case Block, Loop, If:
+			writer.writeExpr(Expr{instr, {Opcode: End}})
+		default:
+			writer.writeInstruction(instr)
+		}
+		expr, err := decodeInstrs(writer.data...)
+		if err != nil {
+			t.Errorf("%s: decoding % x: %v", instr.GetOpname(), writer.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(expr[0], instr) {
+			t.Errorf("%s: got %#v, want %#v", instr.GetOpname(), expr[0], instr)
+		}
+	}
+}
+
+func TestDecodeBlockType(t *testing.T) {
+	tests := []struct {
+		bytes []byte // the immediate of block
+		want  BlockType
+		err   string
+	}{
+		{[]byte{0x40}, BlockTypeEmpty, ""},
+		{[]byte{0x7F}, BlockTypeI32, ""},
+		{[]byte{0x70}, BlockTypeFuncRef, ""},
+		{[]byte{0x3F}, 63, ""},
+		{[]byte{0xC0, 0x00}, 64, ""},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F}, 1<<32 - 1, ""},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x10}, 0, "integer too large"},
+		{[]byte{0x60}, 0, "malformed block type: 96"},
+		{[]byte{0x41}, 0, "malformed block type: 65"},
+		{[]byte{0xBF, 0x7F}, 0, "malformed block type: -65"},
+	}
+	for _, tt := range tests {
+		expr, err := decodeInstrs(append(append([]byte{Block}, tt.bytes...), End)...)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("% x: got error %v, want %q", tt.bytes, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("% x: %v", tt.bytes, err)
+		}
+		if bt := expr[0].Args.(BlockType); bt != tt.want {
+			t.Fatalf("% x: got block type %d, want %d", tt.bytes, bt, tt.want)
+		}
+	}
+
+	// type indices need multi-value, value types do not
+	opts := DefaultDecodeOptions()
+	opts.Features.MultiValue = false
+	for _, bt := range []byte{0x40, 0x7F, 0x00} {
+		secs := voidFunc(Block, bt, End, End)
+		_, err := DecodeWithOptions(wasm(secs...), opts)
+		if bt == 0x00 {
+			wantError(t, err, "multi-value")
+		} else if err != nil {
+			t.Fatalf("block type 0x%02x without multi-value: %v", bt, err)
+		}
+	}
+}
+
+// TestBrTableRoundTrip decodes modules with a br_table and encodes them
+// back
+func TestBrTableRoundTrip(t *testing.T) {
+	many := []byte{BrTable, 0xAC, 0x02} // 300 labels
+	var labels []LabelIdx
+	for i := 0; i < 300; i++ {
+		many = append(many, byte(i%2))
+		labels = append(labels, LabelIdx(i%2))
+	}
+	many = append(many, 1)
+	tests := []struct {
+		name  string
+		table []byte
+		want  BrTableArgs
+	}{
+		{"no labels", []byte{BrTable, 0, 1}, BrTableArgs{Labels: []LabelIdx{}, Default: 1}},
+		{"two labels", []byte{BrTable, 2, 1, 0, 1}, BrTableArgs{Labels: []LabelIdx{1, 0}, Default: 1}},
+		{"300 labels", many, BrTableArgs{Labels: labels, Default: 1}},
+	}
+	for _, tt := range tests {
+		body := []byte{Block, 0x40, Block, 0x40, I32Const, 0}
+		body = append(append(body, tt.table...), End, End, End)
+		data := wasm(voidFunc(body...)...)
+		m := mustDecode(t, data)
+		if got := m.CodeSec[0].Expr[3].Args.(BrTableArgs); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		if encoded := mustEncode(t, m); !bytes.Equal(encoded, data) {
+			t.Fatalf("%s: got % x, want % x", tt.name, encoded, data)
+		}
+	}
+}
+
+func TestDecodeMemArg(t *testing.T) {
+	for opcode := I32Load; opcode <= I64Store32; opcode++ {
+		expr, err := decodeInstrs(byte(opcode), 0x03, 0xFF, 0xFF, 0xFF, 0xFF, 0x0F)
+		if err != nil {
+			t.Fatalf("%s: %v", opnames[opcode], err)
+		}
+		if want := (MemArg{Align: 3, Offset: 0xFFFFFFFF}); expr[0].Args != want {
+			t.Fatalf("%s: got %v, want %v", opnames[opcode], expr[0].Args, want)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		bytes []byte
+		err   string
+	}{
+		{"offset over 32 bits", []byte{I32Load, 2, 0x80, 0x80, 0x80, 0x80, 0x10}, "integer too large"},
+		{"no offset", []byte{I32Load, 2}, "unexpected end"},
+		{"memory.size of memory 1", []byte{MemorySize, 1}, "zero byte expected, got: 1"},
+		{"memory.grow of memory 1", []byte{MemoryGrow, 1}, "zero byte expected, got: 1"},
+	}
+	for _, tt := range tests {
+		_, err := decodeInstrs(tt.bytes...)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+// TestConstBits checks that const immediates keep their exact bits,
+// decoded and encoded back, NaN payloads included
+func TestConstBits(t *testing.T) {
+	le32 := func(bits uint32) []byte {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, bits)
+		return b
+	}
+	le64 := func(bits uint64) []byte {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, bits)
+		return b
+	}
+	tests := []struct {
+		opcode byte
+		imm    []byte
+		bits   uint64 // of the decoded immediate
+	}{
+		{I32Const, []byte{0x7F}, 0xFFFFFFFF},
+		{I32Const, []byte{0xC0, 0x00}, 64},
+		{I32Const, []byte{0x80, 0x80, 0x80, 0x80, 0x78}, 0x80000000},
+		{I32Const, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x07}, 0x7FFFFFFF},
+		{I64Const, []byte{0x7F}, 0xFFFFFFFFFFFFFFFF},
+		{I64Const, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x7F}, 1 << 63},
+		{I64Const, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F}, 0xFFFFFFFF},
+		{F32Const, le32(0x7FC00001), 0x7FC00001}, // NaN with a payload
+		{F32Const, le32(0xFFA00000), 0xFFA00000}, // negative signaling NaN
+		{F32Const, le32(0x7F800000), 0x7F800000}, // +Inf
+		{F32Const, le32(0x80000000), 0x80000000}, // -0
+		{F64Const, le64(0x7FF0000000000001), 0x7FF0000000000001},
+		{F64Const, le64(0xFFF0000000000000), 0xFFF0000000000000}, // -Inf
+		{F64Const, le64(0x8000000000000000), 0x8000000000000000},
+	}
+	for _, tt := range tests {
+		expr, err := decodeInstrs(append([]byte{tt.opcode}, tt.imm...)...)
+		if err != nil {
+			t.Fatalf("%s % x: %v", opnames[tt.opcode], tt.imm, err)
+		}
+		var bits uint64
+		switch v := expr[0].Args.(type) {
+		case int32:
+			bits = uint64(uint32(v))
+		case int64:
+			bits = uint64(v)
+		case float32:
+			bits = uint64(math.Float32bits(v))
+		case float64:
+			bits = math.Float64bits(v)
+		}
+		if bits != tt.bits {
+			t.Fatalf("%s % x: got bits 0x%x, want 0x%x", opnames[tt.opcode], tt.imm, bits, tt.bits)
+		}
+
+		writer := &wasmWriter{}
+		writer.writeInstruction(expr[0])
+		if want := append([]byte{tt.opcode}, tt.imm...); !bytes.Equal(writer.data, want) {
+			t.Fatalf("%s: encoded % x, want % x", opnames[tt.opcode], writer.data, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Interface is what a module needs from and offers to other modules
+type Interface struct {
+	Imports []InterfaceImport
+	Exports []InterfaceExport
+}
+
+type InterfaceImport struct {
+	Import
+	Type FuncType // signature of a function import
+}
+
+type InterfaceExport struct {
+	Export
+	Type FuncType // signature of an exported function
+}
+
+// DecodeInterface decodes only the type, import, function and export
+// sections of data. The content of the other sections is skipped without
+// being checked, so a module that fails to Decode may still have an
+// Interface.
+func DecodeInterface(data []byte) (iface Interface, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			iface = Interface{}
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	reader := &wasmReader{
+		data: data,
+		end:  len(data),
+		opts: DefaultDecodeOptions(),
+	}
+	reader.readPreamble()
+
+	var m Module // 只有类型, 导入, 函数和导出段
+	reader.forEachSection(func(secID byte) {
+		switch secID {
+		case SecCustomID:
+			reader.readBytes()
+		case SecTypeID, SecImportID, SecFuncID, SecExportID:
+			reader.readSec(secID, moduleBuilder{&m})
+		default:
+			reader.skipSecContent()
+		}
+	})
+
+	types := m.TypeSec
+	var funcTypes []TypeIdx // 导入的函数在前
+	for _, imp := range m.ImportSec {
+		iface.Imports = append(iface.Imports, InterfaceImport{Import: imp})
+		if imp.Desc.Tag == ImportTagFunc {
+			funcTypes = append(funcTypes, imp.Desc.FuncType)
+		}
+	}
+	funcTypes = append(funcTypes, m.FuncSec...)
+
+	typeAt := func(idx TypeIdx) FuncType {
+		if int(idx) >= len(types) {
+			panic(fmt.Errorf("unknown type %d", idx))
+		}
+		return types[idx]
+	}
+	for i, imp := range iface.Imports {
+		if imp.Desc.Tag == ImportTagFunc {
+			iface.Imports[i].Type = typeAt(imp.Desc.FuncType)
+		}
+	}
+	for _, exp := range m.ExportSec {
+		ie := InterfaceExport{Export: exp}
+		if exp.Desc.Tag == ExportTagFunc {
+			if int(exp.Desc.Idx) >= len(funcTypes) {
+				panic(fmt.Errorf("unknown function %d", exp.Desc.Idx))
+			}
+			ie.Type = typeAt(funcTypes[exp.Desc.Idx])
+		}
+		iface.Exports = append(iface.Exports, ie)
+	}
+
+	return iface, nil
+}
+
+// skipSecContent skips the content of the non-custom section being read
+// by forEachSection
+func (reader *wasmReader) skipSecContent() {
+	size, w := decodeVarUint(reader.secData[1:], 32)
+	end := 1 + w + int(size)
+	if end > len(reader.secData) {
+		panic(errUnexpectedEnd)
+	}
+	reader.data = reader.secData[end:]
+}
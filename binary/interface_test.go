@@ -0,0 +1,47 @@
+package binary
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDecodeInterface checks DecodeInterface against a full Decode
+func TestDecodeInterface(t *testing.T) {
+	data := readTestdata(t, "hw_rust.wasm")
+	m := mustDecode(t, data)
+	iface, err := DecodeInterface(data)
+	if err != nil {
+		t.Fatalf("DecodeInterface: %v", err)
+	}
+
+	var want Interface
+	for _, imp := range m.ImportSec {
+		ii := InterfaceImport{Import: imp}
+		if imp.Desc.Tag == ImportTagFunc {
+			ii.Type = m.TypeSec[imp.Desc.FuncType]
+		}
+		want.Imports = append(want.Imports, ii)
+	}
+	for _, exp := range m.ExportSec {
+		ie := InterfaceExport{Export: exp}
+		if exp.Desc.Tag == ExportTagFunc {
+			ie.Type, _ = m.GetFuncType(exp.Desc.Idx)
+		}
+		want.Exports = append(want.Exports, ie)
+	}
+	if !reflect.DeepEqual(iface, want) {
+		t.Fatalf("got %+v, want %+v", iface, want)
+	}
+}
+
+// BenchmarkDecodeInterface should be much faster than BenchmarkDecode,
+// the code and data sections are skipped
+func BenchmarkDecodeInterface(b *testing.B) {
+	data := readTestdata(b, "hw_rust.wasm")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeInterface(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
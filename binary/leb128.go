@@ -1,6 +1,11 @@
 package binary
 
 func decodeVarUint(data []byte, size int) (uint64, int) {
+	// 大多数值只有一个字节, 不必进入循环
+	if len(data) > 0 && data[0] < 0x80 {
+		return uint64(data[0]), 1
+	}
+
 	result := uint64(0)
 	for i, b := range data {
 		if i == size/7 {
@@ -22,6 +27,11 @@ func decodeVarUint(data []byte, size int) (uint64, int) {
 }
 
 func decodeVarInt(data []byte, size int) (int64, int) {
+	if len(data) > 0 && data[0] < 0x80 {
+		// 符号扩展第 6 位
+		return int64(int8(data[0]<<1) >> 1), 1
+	}
+
 	result := int64(0)
 	for i, b := range data {
 		if i == size/7 {
@@ -38,7 +48,7 @@ func decodeVarInt(data []byte, size int) (int64, int) {
 		result |= (int64(b) & 0x7f) << (i * 7)
 		if b&0x80 == 0 {
 			if b&0x40 != 0 {
-				result |= -1 << (i + 1) * 7
+				result |= -1 << ((i + 1) * 7)
 			}
 			return result, i + 1
 		}
@@ -46,3 +56,30 @@ func decodeVarInt(data []byte, size int) (int64, int) {
 
 	panic(errUnexpectedEnd)
 }
+
+func encodeVarUint(n uint64) []byte {
+	buf := make([]byte, 0, 10)
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n != 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			return buf
+		}
+	}
+}
+
+func encodeVarInt(n int64) []byte {
+	buf := make([]byte, 0, 10)
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 && b&0x40 == 0 || n == -1 && b&0x40 != 0 {
+			return append(buf, b)
+		}
+		buf = append(buf, b|0x80)
+	}
+}
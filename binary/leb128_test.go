@@ -0,0 +1,170 @@
+package binary
+
+import (
+	"bytes"
+	"math/bits"
+	"testing"
+	"testing/quick"
+)
+
+func TestDecodeVarIntSignExtension(t *testing.T) {
+	tests := []struct {
+		data []byte
+		size int
+		want int64
+	}{
+		{[]byte{0x7F}, 32, -1},
+		{[]byte{0x40}, 32, -64},
+		{[]byte{0x80, 0x7F}, 32, -128},
+		{[]byte{0xC0, 0xBB, 0x78}, 32, -123456},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x78}, 32, -1 << 31},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x07}, 32, 1<<31 - 1},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x7F}, 64, -1 << 63},
+	}
+	for _, tt := range tests {
+		got, n := decodeVarInt(tt.data, tt.size)
+		if got != tt.want || n != len(tt.data) {
+			t.Errorf("decodeVarInt(%x) = %d, %d bytes; want %d, %d bytes",
+				tt.data, got, n, tt.want, len(tt.data))
+		}
+	}
+}
+
+// TestDecodeVarFastPath checks the values on both sides of the
+// single-byte fast path
+func TestDecodeVarFastPath(t *testing.T) {
+	uints := []struct {
+		data []byte
+		want uint64
+	}{
+		{[]byte{0x00}, 0},
+		{[]byte{0x7F}, 127},
+		{[]byte{0x80, 0x01}, 128},
+		{[]byte{0xFF, 0x01}, 255},
+	}
+	for _, tt := range uints {
+		got, n := decodeVarUint(tt.data, 32)
+		if got != tt.want || n != len(tt.data) {
+			t.Fatalf("decodeVarUint(%x) = %d, %d bytes; want %d, %d bytes", tt.data, got, n, tt.want, len(tt.data))
+		}
+	}
+	ints := []struct {
+		data []byte
+		want int64
+	}{
+		{[]byte{0x3F}, 63},
+		{[]byte{0x40}, -64},
+		{[]byte{0xC0, 0x00}, 64},
+		{[]byte{0xBF, 0x7F}, -65},
+	}
+	for _, tt := range ints {
+		got, n := decodeVarInt(tt.data, 32)
+		if got != tt.want || n != len(tt.data) {
+			t.Fatalf("decodeVarInt(%x) = %d, %d bytes; want %d, %d bytes", tt.data, got, n, tt.want, len(tt.data))
+		}
+	}
+}
+
+var lebBenchmarks = []struct {
+	name string
+	data []byte
+}{
+	{"1 byte", []byte{0x2A}},
+	{"2 bytes", []byte{0xAA, 0x01}},
+	{"5 bytes", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x07}},
+}
+
+func BenchmarkDecodeVarUint(b *testing.B) {
+	for _, bm := range lebBenchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				decodeVarUint(bm.data, 32)
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeVarInt(b *testing.B) {
+	for _, bm := range lebBenchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				decodeVarInt(bm.data, 32)
+			}
+		})
+	}
+}
+
+func TestEncodeVarEdgeCases(t *testing.T) {
+	uints := []struct {
+		n    uint64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{1<<32 - 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F}},
+		{1<<64 - 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}},
+	}
+	for _, tt := range uints {
+		if got := encodeVarUint(tt.n); !bytes.Equal(got, tt.want) {
+			t.Fatalf("encodeVarUint(%d) = % x, want % x", tt.n, got, tt.want)
+		}
+	}
+	ints := []struct {
+		n    int64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{63, []byte{0x3F}},
+		{64, []byte{0xC0, 0x00}},
+		{-1, []byte{0x7F}},
+		{-64, []byte{0x40}},
+		{-65, []byte{0xBF, 0x7F}},
+		{-1 << 31, []byte{0x80, 0x80, 0x80, 0x80, 0x78}},
+		{-1 << 63, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x7F}},
+		{1<<63 - 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}},
+	}
+	for _, tt := range ints {
+		if got := encodeVarInt(tt.n); !bytes.Equal(got, tt.want) {
+			t.Fatalf("encodeVarInt(%d) = % x, want % x", tt.n, got, tt.want)
+		}
+	}
+}
+
+// TestVarRoundTrip checks that decoding gives back what was encoded, from
+// as few bytes as possible. The values are shifted so that every length
+// is tried.
+func TestVarRoundTrip(t *testing.T) {
+	unsigned := func(n uint64, shift uint8) bool {
+		n >>= shift % 64
+		data := encodeVarUint(n)
+		got, w := decodeVarUint(data, 64)
+		return got == n && w == len(data) && len(data) == minLen(bits.Len64(n))
+	}
+	signed := func(n int64, shift uint8) bool {
+		n >>= shift % 64
+		data := encodeVarInt(n)
+		got, w := decodeVarInt(data, 64)
+		// a sign bit is needed on top of the significant bits
+		significant := bits.Len64(uint64(n))
+		if n < 0 {
+			significant = bits.Len64(uint64(^n))
+		}
+		return got == n && w == len(data) && len(data) == minLen(significant+1)
+	}
+	config := &quick.Config{MaxCount: 10000}
+	if err := quick.Check(unsigned, config); err != nil {
+		t.Fatalf("decodeVarUint(encodeVarUint(n)): %v", err)
+	}
+	if err := quick.Check(signed, config); err != nil {
+		t.Fatalf("decodeVarInt(encodeVarInt(n)): %v", err)
+	}
+}
+
+// minLen is the number of LEB128 bytes needed for n bits
+func minLen(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return (n + 6) / 7
+}
@@ -1,5 +1,12 @@
 package binary
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
 const (
 	SecCustomID = iota
 	SecTypeID
@@ -13,6 +20,7 @@ const (
 	SecElemID
 	SecCodeID
 	SecDataID
+	SecDataCountID
 )
 
 const (
@@ -28,9 +36,23 @@ const (
 	ExportTagGlobal = 3
 )
 
+const (
+	ElemModeActive      = 0
+	ElemModePassive     = 1
+	ElemModeDeclarative = 2
+)
+
+const (
+	DataModeActive  = 0
+	DataModePassive = 1
+)
+
 const (
 	MagicNumber = 0x6D736100
 	Version     = 0x00000001
+	// the high half of the version field is the layer, component-model
+	// binaries have layer 1
+	ComponentLayer = 1
 )
 
 type (
@@ -41,23 +63,37 @@ type (
 	GlobalIdx = uint32
 	LocalIdx  = uint32
 	LabelIdx  = uint32
+	ElemIdx   = uint32
+	DataIdx   = uint32
 )
 
 type Module struct {
-	Magic      uint32
-	Version    uint32
-	CustomSecs []CustomSec
-	TypeSec    []FuncType
-	ImportSec  []Import
-	FuncSec    []TypeIdx
-	TableSec   []TableType
-	MemSec     []MemType
-	GlobalSec  []Global
-	ExportSec  []Export
-	StartSec   *FuncIdx
-	ElemSec    []Elem
-	CodeSec    []Code
-	DataSec    []Data
+	Magic        uint32
+	Version      uint32
+	CustomSecs   []CustomSec
+	TypeSec      []FuncType
+	ImportSec    []Import
+	FuncSec      []TypeIdx
+	TableSec     []TableType
+	MemSec       []MemType
+	GlobalSec    []Global
+	ExportSec    []Export
+	StartSec     *FuncIdx
+	ElemSec      []Elem
+	DataCountSec *uint32
+	CodeSec      []Code
+	DataSec      []Data
+	// RawSecs maps section ids to the encoded sections, id and size
+	// included, see DecodeOptions.KeepRawSections. Encode writes these
+	// instead of the decoded fields, unless the fields of a section no
+	// longer encode as they did when it was decoded. MarkDirty forces a
+	// section to be encoded from its fields.
+	RawSecs map[byte][]byte
+	// rawSums holds secSum of each section in RawSecs when it was decoded
+	rawSums map[byte][32]byte
+	// Trailing holds the bytes after the last section, see
+	// DecodeOptions.AllowTrailingBytes. Encode writes them back.
+	Trailing []byte
 }
 
 type CustomSec struct {
@@ -94,15 +130,31 @@ type ExportDesc struct {
 	Idx uint32
 }
 
+// Elem is an element segment. Active segments are copied into Table at
+// Offset when the module is instantiated, passive ones only by table.init
+// and declarative ones only declare the functions for ref.func. The
+// entries are either the functions of Init or, if Exprs isn't nil, the
+// references of type Type that Exprs evaluate to.
 type Elem struct {
+	Mode   byte
 	Table  TableIdx
 	Offset Expr
 	Init   []FuncIdx
+	Type   ValType
+	Exprs  []Expr
 }
 
 type Code struct {
 	Locals []Locals
 	Expr   Expr
+	// absolute byte range of the body in the decoded data, see
+	// DecodeOptions.RecordCodeOffsets
+	Start int
+	End   int
+	// absolute byte offset of each instruction of Expr, see
+	// DecodeOptions.RecordCodeOffsets. It is not updated when Expr is
+	// changed.
+	InstrOffsets []int
 }
 
 type Locals struct {
@@ -110,12 +162,21 @@ type Locals struct {
 	Type ValType
 }
 
+// Data is a data segment. Active segments are copied into memory Mem at
+// Offset when the module is instantiated, passive ones only by
+// memory.init.
 type Data struct {
+	Mode   byte
 	Mem    MemIdx
 	Offset Expr
 	Init   []byte
 }
 
+// MaxLocals bounds the number of locals a function body may declare,
+// parameters not included. The binary format allows up to 2^32-1, but
+// expanding that many takes gigabytes, engines cap it far lower.
+const MaxLocals = 50000
+
 func (code Code) GetLocalCount() uint64 {
 	n := uint64(0)
 	for _, locals := range code.Locals {
@@ -124,3 +185,412 @@ func (code Code) GetLocalCount() uint64 {
 
 	return n
 }
+
+// checkLocalCount panics if a body declares more than MaxLocals locals
+func checkLocalCount(n uint64) {
+	if n > MaxLocals {
+		panic(fmt.Errorf("too many locals: %d", n))
+	}
+}
+
+// ExpandedLocals returns the type of each local declared by the body, the
+// parameters not included: local i is ExpandedLocals()[i-len(params)]. It
+// panics if there are more than MaxLocals, as Decode fails then.
+func (code Code) ExpandedLocals() []ValType {
+	n := code.GetLocalCount()
+	checkLocalCount(n)
+
+	vts := make([]ValType, 0, n)
+	for _, locals := range code.Locals {
+		for i := uint32(0); i < locals.N; i++ {
+			vts = append(vts, locals.Type)
+		}
+	}
+	return vts
+}
+
+// MarkDirty tells Encode that section secID must be encoded from the
+// decoded fields rather than from its raw bytes. RawSecs is copied rather
+// than modified, copies of m keep the raw section.
+func (m *Module) MarkDirty(secID byte) {
+	if _, ok := m.RawSecs[secID]; !ok {
+		return
+	}
+	rawSecs := make(map[byte][]byte, len(m.RawSecs))
+	for id, raw := range m.RawSecs {
+		if id != secID {
+			rawSecs[id] = raw
+		}
+	}
+	m.RawSecs = rawSecs
+}
+
+func (m Module) importedCount(tag byte) int {
+	n := 0
+	for _, imp := range m.ImportSec {
+		if imp.Desc.Tag == tag {
+			n++
+		}
+	}
+
+	return n
+}
+
+// TableType returns the type of table idx, imported tables come first.
+// ok is false if there is no such table.
+func (m Module) TableType(idx TableIdx) (tt TableType, ok bool) {
+	if imp, ok := m.importAt(ImportTagTable, idx); ok {
+		return imp.Desc.Table, true
+	}
+	idx -= uint32(m.importedCount(ImportTagTable))
+	if int(idx) < len(m.TableSec) {
+		return m.TableSec[idx], true
+	}
+	return TableType{}, false
+}
+
+// MemType returns the type of memory idx, imported memories come first.
+// ok is false if there is no such memory.
+func (m Module) MemType(idx MemIdx) (mt MemType, ok bool) {
+	if imp, ok := m.importAt(ImportTagMem, idx); ok {
+		return imp.Desc.Mem, true
+	}
+	idx -= uint32(m.importedCount(ImportTagMem))
+	if int(idx) < len(m.MemSec) {
+		return m.MemSec[idx], true
+	}
+	return MemType{}, false
+}
+
+// GlobalType returns the type of global idx, imported globals come first.
+// ok is false if there is no such global.
+func (m Module) GlobalType(idx GlobalIdx) (gt GlobalType, ok bool) {
+	if imp, ok := m.importAt(ImportTagGlobal, idx); ok {
+		return imp.Desc.Global, true
+	}
+	idx -= uint32(m.importedCount(ImportTagGlobal))
+	if int(idx) < len(m.GlobalSec) {
+		return m.GlobalSec[idx].Type, true
+	}
+	return GlobalType{}, false
+}
+
+// ImportedFuncCount returns the number of imported functions, which take
+// the lowest function indices
+func (m Module) ImportedFuncCount() int {
+	return m.importedCount(ImportTagFunc)
+}
+
+// IsImportedFunc reports whether function idx is imported
+func (m Module) IsImportedFunc(idx FuncIdx) bool {
+	return int(idx) < m.ImportedFuncCount()
+}
+
+// GetFuncType returns the signature of function idx, whether imported or
+// defined. ok is false if there is no such function or its type index is
+// out of range.
+func (m Module) GetFuncType(idx FuncIdx) (ft FuncType, ok bool) {
+	var typeIdx TypeIdx
+	if imp, ok := m.importAt(ImportTagFunc, idx); ok {
+		typeIdx = imp.Desc.FuncType
+	} else {
+		i := int(idx) - m.ImportedFuncCount()
+		if i >= len(m.FuncSec) {
+			return FuncType{}, false
+		}
+		typeIdx = m.FuncSec[i]
+	}
+	if int(typeIdx) >= len(m.TypeSec) {
+		return FuncType{}, false
+	}
+	return m.TypeSec[typeIdx], true
+}
+
+// Instructions returns the body of function fn, imported functions come
+// first and have no body
+func (m Module) Instructions(fn FuncIdx) (Expr, error) {
+	imported := m.importedCount(ImportTagFunc)
+	if int(fn) < imported {
+		return nil, fmt.Errorf("function %d is imported", fn)
+	}
+	i := int(fn) - imported
+	if i >= len(m.CodeSec) {
+		return nil, fmt.Errorf("unknown function %d", fn)
+	}
+	return m.CodeSec[i].Expr, nil
+}
+
+// FuncAtOffset returns the function whose body contains offset. It needs
+// the code offsets recorded with DecodeOptions.RecordCodeOffsets.
+func (m Module) FuncAtOffset(offset int) (FuncIdx, bool) {
+	i := sort.Search(len(m.CodeSec), func(i int) bool {
+		return m.CodeSec[i].End > offset
+	})
+	if i == len(m.CodeSec) || m.CodeSec[i].Start > offset {
+		return 0, false
+	}
+
+	return FuncIdx(m.importedCount(ImportTagFunc) + i), true
+}
+
+// CheckImports reports every import that is not a function listed in
+// allowed with exactly the same signature.
+func (m Module) CheckImports(allowed map[string]map[string]FuncType) error {
+	var problems []string
+	for _, imp := range m.ImportSec {
+		name := imp.Module + "." + imp.Name
+		if imp.Desc.Tag != ImportTagFunc {
+			problems = append(problems, fmt.Sprintf("%s: only function imports are allowed", name))
+			continue
+		}
+
+		ft, ok := allowed[imp.Module][imp.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: not allowed", name))
+			continue
+		}
+		if int(imp.Desc.FuncType) >= len(m.TypeSec) {
+			problems = append(problems, fmt.Sprintf("%s: unknown type %d", name, imp.Desc.FuncType))
+			continue
+		}
+		if actual := m.TypeSec[imp.Desc.FuncType]; !actual.Equal(ft) {
+			problems = append(problems, fmt.Sprintf("%s: signature %s does not match %s",
+				name, actual.GetSignature(), ft.GetSignature()))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("incompatible imports: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// DuplicateTypes returns the groups of structurally equal function types,
+// ordered by the index of their first type. Types without duplicates are
+// left out.
+func (m Module) DuplicateTypes() [][]TypeIdx {
+	var groups [][]TypeIdx
+	grouped := make([]bool, len(m.TypeSec))
+	for i, ft := range m.TypeSec {
+		if grouped[i] {
+			continue
+		}
+		group := []TypeIdx{TypeIdx(i)}
+		for j := i + 1; j < len(m.TypeSec); j++ {
+			if !grouped[j] && ft.Equal(m.TypeSec[j]) {
+				group = append(group, TypeIdx(j))
+				grouped[j] = true
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups
+}
+
+// UsedOpcodes returns the set of opcodes the function bodies use
+func (m Module) UsedOpcodes() map[Opcode]bool {
+	used := make(map[Opcode]bool)
+	for _, code := range m.CodeSec {
+		for _, instr := range code.Expr {
+			used[instr.GetOpcode()] = true
+		}
+	}
+	return used
+}
+
+// SortedUsedOpcodes returns the opcodes of UsedOpcodes ordered by prefix,
+// unprefixed opcodes first, then by code
+func (m Module) SortedUsedOpcodes() []Opcode {
+	var opcodes []Opcode
+	for op := range m.UsedOpcodes() {
+		opcodes = append(opcodes, op)
+	}
+	sort.Slice(opcodes, func(i, j int) bool {
+		if opcodes[i].Prefix != opcodes[j].Prefix {
+			return opcodes[i].Prefix < opcodes[j].Prefix
+		}
+		return opcodes[i].Code < opcodes[j].Code
+	})
+	return opcodes
+}
+
+// ImportArity returns the number of imported functions, tables, memories
+// and globals.
+func (m Module) ImportArity() (funcs, tables, mems, globals int) {
+	return m.importedCount(ImportTagFunc), m.importedCount(ImportTagTable),
+		m.importedCount(ImportTagMem), m.importedCount(ImportTagGlobal)
+}
+
+// CheckIndexBounds reports every function, table, memory, global and type
+// index that is beyond the imported and defined entities of its kind. It
+// doesn't type-check anything, so it is much cheaper than Validate.
+func (m Module) CheckIndexBounds() error {
+	errs := m.indexErrors()
+	if len(errs) == 0 {
+		return nil
+	}
+	problems := make([]string, len(errs))
+	for i, err := range errs {
+		problems[i] = err.Error()
+	}
+	return errors.New("index out of bounds: " + strings.Join(problems, "; "))
+}
+
+// Validate returns an *IndexError for the first function, table, memory,
+// global or type index of m that is out of range, in the order of the
+// sections. Unlike the Validate method, it checks nothing else.
+func Validate(m Module) error {
+	if errs := m.indexErrors(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// indexErrors lists the out of range indices of m, see CheckIndexBounds
+func (m Module) indexErrors() []*IndexError {
+	funcs, tables, mems, globals := m.ImportArity()
+	funcs += len(m.FuncSec)
+	tables += len(m.TableSec)
+	mems += len(m.MemSec)
+	globals += len(m.GlobalSec)
+
+	var errs []*IndexError
+	check := func(where, kind string, idx uint32, count int) {
+		if int(idx) >= count {
+			errs = append(errs, &IndexError{Where: where, Kind: kind, Idx: idx, Count: count})
+		}
+	}
+	checkExpr := func(where string, expr Expr) {
+		for _, instr := range expr {
+			switch instr.Opcode {
+			case Call, RefFunc:
+				check(where, "function", instr.Args.(uint32), funcs)
+			case CallIndirect:
+				check(where, "type", instr.Args.(CallIndirectArgs).Type, len(m.TypeSec))
+				check(where, "table", instr.Args.(CallIndirectArgs).Table, tables)
+			case GlobalGet, GlobalSet:
+				check(where, "global", instr.Args.(uint32), globals)
+			case TableGet, TableSet:
+				check(where, "table", instr.Args.(uint32), tables)
+			case PrefixAtomic:
+				if instr.SubOpcode != AtomicFence {
+					check(where, "memory", 0, mems)
+				}
+			case PrefixMisc:
+				switch instr.SubOpcode {
+				case MemoryInit, MemoryCopy, MemoryFill:
+					check(where, "memory", 0, mems)
+				case TableInit:
+					check(where, "table", instr.Args.(TableInitArgs).Table, tables)
+				case TableCopy:
+					check(where, "table", instr.Args.(TableCopyArgs).Dst, tables)
+					check(where, "table", instr.Args.(TableCopyArgs).Src, tables)
+				case TableGrow, TableSize, TableFill:
+					check(where, "table", instr.Args.(uint32), tables)
+				}
+			default:
+				if instr.Opcode >= I32Load && instr.Opcode <= MemoryGrow {
+					check(where, "memory", 0, mems)
+				}
+			}
+		}
+	}
+
+	for i, imp := range m.ImportSec {
+		if imp.Desc.Tag == ImportTagFunc {
+			check(fmt.Sprintf("import %d", i), "type", imp.Desc.FuncType, len(m.TypeSec))
+		}
+	}
+	for i, typeIdx := range m.FuncSec {
+		check(fmt.Sprintf("function %d", i), "type", typeIdx, len(m.TypeSec))
+	}
+	for i, g := range m.GlobalSec {
+		checkExpr(fmt.Sprintf("global %d", i), g.Init)
+	}
+	for _, exp := range m.ExportSec {
+		where := fmt.Sprintf("export %q", exp.Name)
+		switch exp.Desc.Tag {
+		case ExportTagFunc:
+			check(where, "function", exp.Desc.Idx, funcs)
+		case ExportTagTable:
+			check(where, "table", exp.Desc.Idx, tables)
+		case ExportTagMem:
+			check(where, "memory", exp.Desc.Idx, mems)
+		case ExportTagGlobal:
+			check(where, "global", exp.Desc.Idx, globals)
+		}
+	}
+	if m.StartSec != nil {
+		check("start", "function", *m.StartSec, funcs)
+	}
+	for i, elem := range m.ElemSec {
+		where := fmt.Sprintf("elem %d", i)
+		if elem.Mode == ElemModeActive {
+			check(where, "table", elem.Table, tables)
+			checkExpr(where, elem.Offset)
+		}
+		for _, idx := range elem.Init {
+			check(where, "function", idx, funcs)
+		}
+		for _, expr := range elem.Exprs {
+			checkExpr(where, expr)
+		}
+	}
+	for i, code := range m.CodeSec {
+		checkExpr(fmt.Sprintf("code %d", i), code.Expr)
+	}
+	for i, data := range m.DataSec {
+		where := fmt.Sprintf("data %d", i)
+		if data.Mode == DataModeActive {
+			check(where, "memory", data.Mem, mems)
+			checkExpr(where, data.Offset)
+		}
+	}
+
+	return errs
+}
+
+// ExportByName returns the export called name
+func (m Module) ExportByName(name string) (Export, bool) {
+	for _, exp := range m.ExportSec {
+		if exp.Name == name {
+			return exp, true
+		}
+	}
+	return Export{}, false
+}
+
+// ExportedFuncIndex returns the index of the function exported as name.
+// It reports false if there is no such export or it is not a function.
+func (m Module) ExportedFuncIndex(name string) (FuncIdx, bool) {
+	exp, ok := m.ExportByName(name)
+	if !ok || exp.Desc.Tag != ExportTagFunc {
+		return 0, false
+	}
+	return exp.Desc.Idx, true
+}
+
+// CustomSectionByName returns the first custom section called name
+func (m Module) CustomSectionByName(name string) (CustomSec, bool) {
+	for _, cs := range m.CustomSecs {
+		if cs.Name == name {
+			return cs, true
+		}
+	}
+	return CustomSec{}, false
+}
+
+// CustomSectionsByName returns the custom sections called name, in the
+// order they appear
+func (m Module) CustomSectionsByName(name string) []CustomSec {
+	var secs []CustomSec
+	for _, cs := range m.CustomSecs {
+		if cs.Name == name {
+			secs = append(secs, cs)
+		}
+	}
+	return secs
+}
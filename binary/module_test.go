@@ -0,0 +1,105 @@
+package binary
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExportByName(t *testing.T) {
+	m := Module{ExportSec: []Export{
+		{Name: "f", Desc: ExportDesc{Tag: ExportTagFunc, Idx: 3}},
+		{Name: "mem", Desc: ExportDesc{Tag: ExportTagMem, Idx: 0}},
+	}}
+	if idx, ok := m.ExportedFuncIndex("f"); !ok || idx != 3 {
+		t.Fatalf("got function %d, %v, want 3", idx, ok)
+	}
+	if idx, ok := m.ExportedFuncIndex("mem"); ok {
+		t.Fatalf("got function %d for a memory export, want none", idx)
+	}
+	if exp, ok := m.ExportByName("missing"); ok {
+		t.Fatalf("got %v for a missing export, want none", exp)
+	}
+	if exp, ok := m.ExportByName("mem"); !ok || exp != m.ExportSec[1] {
+		t.Fatalf("got %v, %v, want %v", exp, ok, m.ExportSec[1])
+	}
+}
+
+func TestDecodeDuplicateExport(t *testing.T) {
+	data := wasm(sec(SecExportID, 2, 1, 'x', ExportTagMem, 0, 1, 'x', ExportTagMem, 0))
+	_, err := Decode(data)
+	wantError(t, err, `duplicate export name: "x"`)
+}
+
+func TestIndexSpaces(t *testing.T) {
+	ft0 := FuncType{Tag: FtTag, ParamTypes: []ValType{ValTypeI32}}
+	ft1 := FuncType{Tag: FtTag, ResultTypes: []ValType{ValTypeI64}}
+	m := Module{
+		TypeSec: []FuncType{ft0, ft1},
+		ImportSec: []Import{
+			{Module: "a", Name: "g", Desc: ImportDesc{Tag: ImportTagGlobal, Global: GlobalType{ValType: ValTypeF32}}},
+			{Module: "a", Name: "f", Desc: ImportDesc{Tag: ImportTagFunc, FuncType: 1}},
+		},
+		FuncSec:   []TypeIdx{0, 5}, // function 2 has no type
+		GlobalSec: []Global{{Type: GlobalType{ValType: ValTypeI64}}},
+	}
+	if n := m.ImportedFuncCount(); n != 1 {
+		t.Fatalf("got %d imported functions, want 1", n)
+	}
+	if !m.IsImportedFunc(0) || m.IsImportedFunc(1) {
+		t.Fatalf("got imported %v and %v for functions 0 and 1, want true and false",
+			m.IsImportedFunc(0), m.IsImportedFunc(1))
+	}
+
+	funcTypes := []struct {
+		idx  FuncIdx
+		want FuncType
+		ok   bool
+	}{
+		{0, ft1, true}, // imported
+		{1, ft0, true},
+		{2, FuncType{}, false},
+		{3, FuncType{}, false},
+	}
+	for _, tt := range funcTypes {
+		ft, ok := m.GetFuncType(tt.idx)
+		if ok != tt.ok || ok && !ft.Equal(tt.want) {
+			t.Fatalf("function %d: got %v, %v, want %v, %v", tt.idx, ft, ok, tt.want, tt.ok)
+		}
+	}
+
+	if gt, ok := m.GlobalType(0); !ok || gt.ValType != ValTypeF32 {
+		t.Fatalf("got global 0 %v, %v, want the imported f32", gt, ok)
+	}
+	if gt, ok := m.GlobalType(1); !ok || gt.ValType != ValTypeI64 {
+		t.Fatalf("got global 1 %v, %v, want the defined i64", gt, ok)
+	}
+	if mt, ok := m.MemType(0); ok {
+		t.Fatalf("got memory %v, want none", mt)
+	}
+}
+
+func TestValidateIndices(t *testing.T) {
+	m := voidModule(Instruction{Opcode: Call, Args: uint32(3)})
+	m.FuncSec[0] = 2
+	m.ExportSec = []Export{{Name: "g", Desc: ExportDesc{Tag: ExportTagGlobal, Idx: 0}}}
+
+	err := Validate(m)
+	var indexErr *IndexError
+	if !errors.As(err, &indexErr) {
+		t.Fatalf("got error %v, want an *IndexError", err)
+	}
+	// the function section comes first
+	if want := (IndexError{Where: "function 0", Kind: "type", Idx: 2, Count: 1}); *indexErr != want {
+		t.Fatalf("got %+v, want %+v", *indexErr, want)
+	}
+	wantError(t, m.CheckIndexBounds(), `function 0: type index 2 out of range (1 in module); `+
+		`export "g": global index 0 out of range (0 in module); code 0: function index 3 out of range (1 in module)`)
+
+	m.FuncSec[0] = 0
+	m.ExportSec = nil
+	wantError(t, Validate(m), "code 0: function index 3 out of range (1 in module)")
+	m.CodeSec[0].Expr[0].Args = uint32(0)
+	if err := Validate(m); err != nil {
+		t.Fatalf("got error %v, want none", err)
+	}
+}
@@ -0,0 +1,132 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// name 段的子段
+const (
+	nameSubsecModuleName = 0
+	nameSubsecFuncNames  = 1
+	nameSubsecLocalNames = 2
+)
+
+// NameSec is the content of the "name" custom section. The maps are nil
+// if their subsection is absent.
+type NameSec struct {
+	ModuleName string
+	FuncNames  map[FuncIdx]string
+	LocalNames map[FuncIdx]map[LocalIdx]string
+	// subsections other than the three above, kept as they are
+	Unknown []NameSubsec
+}
+
+type NameSubsec struct {
+	ID    byte
+	Bytes []byte
+}
+
+// FuncName returns the name of function idx, if it has one
+func (ns *NameSec) FuncName(idx FuncIdx) (string, bool) {
+	name, ok := ns.FuncNames[idx]
+	return name, ok
+}
+
+// LocalName returns the name of local idx of function fn, if it has one
+func (ns *NameSec) LocalName(fn FuncIdx, idx LocalIdx) (string, bool) {
+	name, ok := ns.LocalNames[fn][idx]
+	return name, ok
+}
+
+// ParseNameSection decodes a "name" custom section. The subsections must
+// come in increasing id order.
+func ParseNameSection(cs CustomSec) (ns *NameSec, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ns = nil
+			switch x := r.(type) {
+			case error:
+				err = fmt.Errorf("malformed name section: %w", x)
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	if cs.Name != "name" {
+		return nil, fmt.Errorf("not a name section: %q", cs.Name)
+	}
+	ns = &NameSec{}
+	reader := &wasmReader{data: cs.Bytes}
+	for prevID := -1; reader.remaining() > 0; {
+		id := reader.readByte()
+		if int(id) <= prevID {
+			panic(fmt.Errorf("subsection %d out of order", id))
+		}
+		prevID = int(id)
+
+		data := reader.readBytes()
+		subReader := &wasmReader{data: data}
+		switch id {
+		case nameSubsecModuleName:
+			ns.ModuleName = subReader.readName()
+		case nameSubsecFuncNames:
+			ns.FuncNames = subReader.readNameMap()
+		case nameSubsecLocalNames:
+			ns.LocalNames = make(map[FuncIdx]map[LocalIdx]string)
+			for n := subReader.readVarU32(); n > 0; n-- {
+				idx := subReader.readVarU32()
+				ns.LocalNames[idx] = subReader.readNameMap()
+			}
+		default:
+			ns.Unknown = append(ns.Unknown, NameSubsec{ID: id, Bytes: data})
+			continue
+		}
+		if subReader.remaining() > 0 {
+			panic(fmt.Errorf("subsection %d size mismatch", id))
+		}
+	}
+
+	return ns, nil
+}
+
+func (reader *wasmReader) readNameMap() map[uint32]string {
+	names := make(map[uint32]string)
+	for n := reader.readVarU32(); n > 0; n-- {
+		idx := reader.readVarU32()
+		names[idx] = reader.readName()
+	}
+	return names
+}
+
+// FuncNames returns the function names from the "name" custom section,
+// or nil when there is no such section or it is malformed.
+func (m Module) FuncNames() map[FuncIdx]string {
+	cs, ok := m.CustomSectionByName("name")
+	if !ok {
+		return nil
+	}
+	ns, err := ParseNameSection(cs)
+	if err != nil {
+		return nil
+	}
+	return ns.FuncNames
+}
+
+// FuncName is a function index and its name from the "name" section
+type FuncName struct {
+	Idx  FuncIdx
+	Name string
+}
+
+// SortedFuncNames returns the names of FuncNames ordered by function index
+func (m Module) SortedFuncNames() []FuncName {
+	var names []FuncName
+	for idx, name := range m.FuncNames() {
+		names = append(names, FuncName{Idx: idx, Name: name})
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].Idx < names[j].Idx })
+	return names
+}
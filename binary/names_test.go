@@ -0,0 +1,54 @@
+package binary
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNameSection(t *testing.T) {
+	data := []byte{
+		0, 4, 3, 'm', 'o', 'd', // module name
+		1, 4, 1, 2, 1, 'f', // function 2 is "f"
+		2, 6, 1, 2, 1, 0, 1, 'x', // local 0 of function 2 is "x"
+		7, 2, 0xAA, 0xBB, // unknown subsection
+	}
+	ns, err := ParseNameSection(CustomSec{Name: "name", Bytes: data})
+	if err != nil {
+		t.Fatalf("ParseNameSection: %v", err)
+	}
+	if ns.ModuleName != "mod" {
+		t.Fatalf("got module name %q, want %q", ns.ModuleName, "mod")
+	}
+	if name, ok := ns.FuncName(2); !ok || name != "f" {
+		t.Fatalf("got function 2 name %q, %v, want %q", name, ok, "f")
+	}
+	if name, ok := ns.FuncName(0); ok {
+		t.Fatalf("got function 0 name %q, want none", name)
+	}
+	if name, ok := ns.LocalName(2, 0); !ok || name != "x" {
+		t.Fatalf("got local name %q, %v, want %q", name, ok, "x")
+	}
+	if want := []NameSubsec{{ID: 7, Bytes: []byte{0xAA, 0xBB}}}; !reflect.DeepEqual(ns.Unknown, want) {
+		t.Fatalf("got unknown subsections %v, want %v", ns.Unknown, want)
+	}
+}
+
+func TestParseNameSectionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cs   CustomSec
+		err  string
+	}{
+		{"other section", CustomSec{Name: "producers"}, `not a name section: "producers"`},
+		// function names before the module name
+		{"out of order", CustomSec{Name: "name", Bytes: []byte{1, 1, 0, 0, 1, 0}}, "subsection 0 out of order"},
+		{"size mismatch", CustomSec{Name: "name", Bytes: []byte{1, 2, 0, 0}}, "subsection 1 size mismatch"},
+	}
+	for _, tt := range tests {
+		_, err := ParseNameSection(tt.cs)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package binary
+
+import "strings"
+
+// IsObjectFile reports whether m is a relocatable object file, which
+// carries a "linking" custom section and still has to be linked.
+func (m Module) IsObjectFile() bool {
+	_, ok := m.CustomSectionByName("linking")
+	return ok
+}
+
+// RelocSections returns the "reloc.*" custom sections of an object file,
+// in the order they appear. Their content is not parsed.
+func (m Module) RelocSections() []CustomSec {
+	var secs []CustomSec
+	for _, sec := range m.CustomSecs {
+		if strings.HasPrefix(sec.Name, "reloc.") {
+			secs = append(secs, sec)
+		}
+	}
+	return secs
+}
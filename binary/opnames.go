@@ -0,0 +1,530 @@
+package binary
+
+var opnames = [256]string{
+	Unreachable:       "unreachable",
+	Nop:               "nop",
+	Block:             "block",
+	Loop:              "loop",
+	If:                "if",
+	Else:              "else",
+	End:               "end",
+	Br:                "br",
+	BrIf:              "br_if",
+	BrTable:           "br_table",
+	Return:            "return",
+	Call:              "call",
+	CallIndirect:      "call_indirect",
+	Drop:              "drop",
+	Select:            "select",
+	SelectT:           "select",
+	LocalGet:          "local.get",
+	LocalSet:          "local.set",
+	LocalTee:          "local.tee",
+	GlobalGet:         "global.get",
+	GlobalSet:         "global.set",
+	TableGet:          "table.get",
+	TableSet:          "table.set",
+	I32Load:           "i32.load",
+	I64Load:           "i64.load",
+	F32Load:           "f32.load",
+	F64Load:           "f64.load",
+	I32Load8S:         "i32.load8_s",
+	I32Load8U:         "i32.load8_u",
+	I32Load16S:        "i32.load16_s",
+	I32Load16U:        "i32.load16_u",
+	I64Load8S:         "i64.load8_s",
+	I64Load8U:         "i64.load8_u",
+	I64Load16S:        "i64.load16_s",
+	I64Load16U:        "i64.load16_u",
+	I64Load32S:        "i64.load32_s",
+	I64Load32U:        "i64.load32_u",
+	I32Store:          "i32.store",
+	I64Store:          "i64.store",
+	F32Store:          "f32.store",
+	F64Store:          "f64.store",
+	I32Store8:         "i32.store8",
+	I32Store16:        "i32.store16",
+	I64Store8:         "i64.store8",
+	I64Store16:        "i64.store16",
+	I64Store32:        "i64.store32",
+	MemorySize:        "memory.size",
+	MemoryGrow:        "memory.grow",
+	I32Const:          "i32.const",
+	I64Const:          "i64.const",
+	F32Const:          "f32.const",
+	F64Const:          "f64.const",
+	I32Eqz:            "i32.eqz",
+	I32Eq:             "i32.eq",
+	I32Ne:             "i32.ne",
+	I32LtS:            "i32.lt_s",
+	I32LtU:            "i32.lt_u",
+	I32GtS:            "i32.gt_s",
+	I32GtU:            "i32.gt_u",
+	I32LeS:            "i32.le_s",
+	I32LeU:            "i32.le_u",
+	I32GeS:            "i32.ge_s",
+	I32GeU:            "i32.ge_u",
+	I64Eqz:            "i64.eqz",
+	I64Eq:             "i64.eq",
+	I64Ne:             "i64.ne",
+	I64LtS:            "i64.lt_s",
+	I64LtU:            "i64.lt_u",
+	I64GtS:            "i64.gt_s",
+	I64GtU:            "i64.gt_u",
+	I64LeS:            "i64.le_s",
+	I64LeU:            "i64.le_u",
+	I64GeS:            "i64.ge_s",
+	I64GeU:            "i64.ge_u",
+	F32Eq:             "f32.eq",
+	F32Ne:             "f32.ne",
+	F32Lt:             "f32.lt",
+	F32Gt:             "f32.gt",
+	F32Le:             "f32.le",
+	F32Ge:             "f32.ge",
+	F64Eq:             "f64.eq",
+	F64Ne:             "f64.ne",
+	F64Lt:             "f64.lt",
+	F64Gt:             "f64.gt",
+	F64Le:             "f64.le",
+	F64Ge:             "f64.ge",
+	I32Clz:            "i32.clz",
+	I32Ctz:            "i32.ctz",
+	I32PopCnt:         "i32.popcnt",
+	I32Add:            "i32.add",
+	I32Sub:            "i32.sub",
+	I32Mul:            "i32.mul",
+	I32DivS:           "i32.div_s",
+	I32DivU:           "i32.div_u",
+	I32RemS:           "i32.rem_s",
+	I32RemU:           "i32.rem_u",
+	I32And:            "i32.and",
+	I32Or:             "i32.or",
+	I32Xor:            "i32.xor",
+	I32Shl:            "i32.shl",
+	I32ShrS:           "i32.shr_s",
+	I32ShrU:           "i32.shr_u",
+	I32Rotl:           "i32.rotl",
+	I32Rotr:           "i32.rotr",
+	I64Clz:            "i64.clz",
+	I64Ctz:            "i64.ctz",
+	I64PopCnt:         "i64.popcnt",
+	I64Add:            "i64.add",
+	I64Sub:            "i64.sub",
+	I64Mul:            "i64.mul",
+	I64DivS:           "i64.div_s",
+	I64DivU:           "i64.div_u",
+	I64RemS:           "i64.rem_s",
+	I64RemU:           "i64.rem_u",
+	I64And:            "i64.and",
+	I64Or:             "i64.or",
+	I64Xor:            "i64.xor",
+	I64Shl:            "i64.shl",
+	I64ShrS:           "i64.shr_s",
+	I64ShrU:           "i64.shr_u",
+	I64Rotl:           "i64.rotl",
+	I64Rotr:           "i64.rotr",
+	F32Abs:            "f32.abs",
+	F32Neg:            "f32.neg",
+	F32Ceil:           "f32.ceil",
+	F32Floor:          "f32.floor",
+	F32Trunc:          "f32.trunc",
+	F32Nearest:        "f32.nearest",
+	F32Sqrt:           "f32.sqrt",
+	F32Add:            "f32.add",
+	F32Sub:            "f32.sub",
+	F32Mul:            "f32.mul",
+	F32Div:            "f32.div",
+	F32Min:            "f32.min",
+	F32Max:            "f32.max",
+	F32CopySign:       "f32.copysign",
+	F64Abs:            "f64.abs",
+	F64Neg:            "f64.neg",
+	F64Ceil:           "f64.ceil",
+	F64Floor:          "f64.floor",
+	F64Trunc:          "f64.trunc",
+	F64Nearest:        "f64.nearest",
+	F64Sqrt:           "f64.sqrt",
+	F64Add:            "f64.add",
+	F64Sub:            "f64.sub",
+	F64Mul:            "f64.mul",
+	F64Div:            "f64.div",
+	F64Min:            "f64.min",
+	F64Max:            "f64.max",
+	F64CopySign:       "f64.copysign",
+	I32WrapI64:        "i32.wrap_i64",
+	I32TruncF32S:      "i32.trunc_f32_s",
+	I32TruncF32U:      "i32.trunc_f32_u",
+	I32TruncF64S:      "i32.trunc_f64_s",
+	I32TruncF64U:      "i32.trunc_f64_u",
+	I64ExtendI32S:     "i64.extend_i32_s",
+	I64ExtendI32U:     "i64.extend_i32_u",
+	I64TruncF32S:      "i64.trunc_f32_s",
+	I64TruncF32U:      "i64.trunc_f32_u",
+	I64TruncF64S:      "i64.trunc_f64_s",
+	I64TruncF64U:      "i64.trunc_f64_u",
+	F32ConvertI32S:    "f32.convert_i32_s",
+	F32ConvertI32U:    "f32.convert_i32_u",
+	F32ConvertI64S:    "f32.convert_i64_s",
+	F32ConvertI64U:    "f32.convert_i64_u",
+	F32DemoteF64:      "f32.demote_f64",
+	F64ConvertI32S:    "f64.convert_i32_s",
+	F64ConvertI32U:    "f64.convert_i32_u",
+	F64ConvertI64S:    "f64.convert_i64_s",
+	F64ConvertI64U:    "f64.convert_i64_u",
+	F64PromoteF32:     "f64.promote_f32",
+	I32ReinterpretF32: "i32.reinterpret_f32",
+	I64ReinterpretF64: "i64.reinterpret_f64",
+	F32ReinterpretI32: "f32.reinterpret_i32",
+	F64ReinterpretI64: "f64.reinterpret_i64",
+	I32Extend8S:       "i32.extend8_s",
+	I32Extend16S:      "i32.extend16_s",
+	I64Extend8S:       "i64.extend8_s",
+	I64Extend16S:      "i64.extend16_s",
+	I64Extend32S:      "i64.extend32_s",
+	RefNull:           "ref.null",
+	RefIsNull:         "ref.is_null",
+	RefFunc:           "ref.func",
+}
+
+var miscOpnames = map[uint32]string{
+	I32TruncSatF32S: "i32.trunc_sat_f32_s",
+	I32TruncSatF32U: "i32.trunc_sat_f32_u",
+	I32TruncSatF64S: "i32.trunc_sat_f64_s",
+	I32TruncSatF64U: "i32.trunc_sat_f64_u",
+	I64TruncSatF32S: "i64.trunc_sat_f32_s",
+	I64TruncSatF32U: "i64.trunc_sat_f32_u",
+	I64TruncSatF64S: "i64.trunc_sat_f64_s",
+	I64TruncSatF64U: "i64.trunc_sat_f64_u",
+	MemoryInit:      "memory.init",
+	DataDrop:        "data.drop",
+	MemoryCopy:      "memory.copy",
+	MemoryFill:      "memory.fill",
+	TableInit:       "table.init",
+	ElemDrop:        "elem.drop",
+	TableCopy:       "table.copy",
+	TableGrow:       "table.grow",
+	TableSize:       "table.size",
+	TableFill:       "table.fill",
+}
+
+var simdOpnames = map[uint32]string{
+	0x00: "v128.load",
+	0x01: "v128.load8x8_s",
+	0x02: "v128.load8x8_u",
+	0x03: "v128.load16x4_s",
+	0x04: "v128.load16x4_u",
+	0x05: "v128.load32x2_s",
+	0x06: "v128.load32x2_u",
+	0x07: "v128.load8_splat",
+	0x08: "v128.load16_splat",
+	0x09: "v128.load32_splat",
+	0x0A: "v128.load64_splat",
+	0x0B: "v128.store",
+	0x0C: "v128.const",
+	0x0D: "i8x16.shuffle",
+	0x0E: "i8x16.swizzle",
+	0x0F: "i8x16.splat",
+	0x10: "i16x8.splat",
+	0x11: "i32x4.splat",
+	0x12: "i64x2.splat",
+	0x13: "f32x4.splat",
+	0x14: "f64x2.splat",
+	0x15: "i8x16.extract_lane_s",
+	0x16: "i8x16.extract_lane_u",
+	0x17: "i8x16.replace_lane",
+	0x18: "i16x8.extract_lane_s",
+	0x19: "i16x8.extract_lane_u",
+	0x1A: "i16x8.replace_lane",
+	0x1B: "i32x4.extract_lane",
+	0x1C: "i32x4.replace_lane",
+	0x1D: "i64x2.extract_lane",
+	0x1E: "i64x2.replace_lane",
+	0x1F: "f32x4.extract_lane",
+	0x20: "f32x4.replace_lane",
+	0x21: "f64x2.extract_lane",
+	0x22: "f64x2.replace_lane",
+	0x23: "i8x16.eq",
+	0x24: "i8x16.ne",
+	0x25: "i8x16.lt_s",
+	0x26: "i8x16.lt_u",
+	0x27: "i8x16.gt_s",
+	0x28: "i8x16.gt_u",
+	0x29: "i8x16.le_s",
+	0x2A: "i8x16.le_u",
+	0x2B: "i8x16.ge_s",
+	0x2C: "i8x16.ge_u",
+	0x2D: "i16x8.eq",
+	0x2E: "i16x8.ne",
+	0x2F: "i16x8.lt_s",
+	0x30: "i16x8.lt_u",
+	0x31: "i16x8.gt_s",
+	0x32: "i16x8.gt_u",
+	0x33: "i16x8.le_s",
+	0x34: "i16x8.le_u",
+	0x35: "i16x8.ge_s",
+	0x36: "i16x8.ge_u",
+	0x37: "i32x4.eq",
+	0x38: "i32x4.ne",
+	0x39: "i32x4.lt_s",
+	0x3A: "i32x4.lt_u",
+	0x3B: "i32x4.gt_s",
+	0x3C: "i32x4.gt_u",
+	0x3D: "i32x4.le_s",
+	0x3E: "i32x4.le_u",
+	0x3F: "i32x4.ge_s",
+	0x40: "i32x4.ge_u",
+	0x41: "f32x4.eq",
+	0x42: "f32x4.ne",
+	0x43: "f32x4.lt",
+	0x44: "f32x4.gt",
+	0x45: "f32x4.le",
+	0x46: "f32x4.ge",
+	0x47: "f64x2.eq",
+	0x48: "f64x2.ne",
+	0x49: "f64x2.lt",
+	0x4A: "f64x2.gt",
+	0x4B: "f64x2.le",
+	0x4C: "f64x2.ge",
+	0x4D: "v128.not",
+	0x4E: "v128.and",
+	0x4F: "v128.andnot",
+	0x50: "v128.or",
+	0x51: "v128.xor",
+	0x52: "v128.bitselect",
+	0x53: "v128.any_true",
+	0x54: "v128.load8_lane",
+	0x55: "v128.load16_lane",
+	0x56: "v128.load32_lane",
+	0x57: "v128.load64_lane",
+	0x58: "v128.store8_lane",
+	0x59: "v128.store16_lane",
+	0x5A: "v128.store32_lane",
+	0x5B: "v128.store64_lane",
+	0x5C: "v128.load32_zero",
+	0x5D: "v128.load64_zero",
+	0x5E: "f32x4.demote_f64x2_zero",
+	0x5F: "f64x2.promote_low_f32x4",
+	0x60: "i8x16.abs",
+	0x61: "i8x16.neg",
+	0x62: "i8x16.popcnt",
+	0x63: "i8x16.all_true",
+	0x64: "i8x16.bitmask",
+	0x65: "i8x16.narrow_i16x8_s",
+	0x66: "i8x16.narrow_i16x8_u",
+	0x67: "f32x4.ceil",
+	0x68: "f32x4.floor",
+	0x69: "f32x4.trunc",
+	0x6A: "f32x4.nearest",
+	0x6B: "i8x16.shl",
+	0x6C: "i8x16.shr_s",
+	0x6D: "i8x16.shr_u",
+	0x6E: "i8x16.add",
+	0x6F: "i8x16.add_sat_s",
+	0x70: "i8x16.add_sat_u",
+	0x71: "i8x16.sub",
+	0x72: "i8x16.sub_sat_s",
+	0x73: "i8x16.sub_sat_u",
+	0x74: "f64x2.ceil",
+	0x75: "f64x2.floor",
+	0x76: "i8x16.min_s",
+	0x77: "i8x16.min_u",
+	0x78: "i8x16.max_s",
+	0x79: "i8x16.max_u",
+	0x7A: "f64x2.trunc",
+	0x7B: "i8x16.avgr_u",
+	0x7C: "i16x8.extadd_pairwise_i8x16_s",
+	0x7D: "i16x8.extadd_pairwise_i8x16_u",
+	0x7E: "i32x4.extadd_pairwise_i16x8_s",
+	0x7F: "i32x4.extadd_pairwise_i16x8_u",
+	0x80: "i16x8.abs",
+	0x81: "i16x8.neg",
+	0x82: "i16x8.q15mulr_sat_s",
+	0x83: "i16x8.all_true",
+	0x84: "i16x8.bitmask",
+	0x85: "i16x8.narrow_i32x4_s",
+	0x86: "i16x8.narrow_i32x4_u",
+	0x87: "i16x8.extend_low_i8x16_s",
+	0x88: "i16x8.extend_high_i8x16_s",
+	0x89: "i16x8.extend_low_i8x16_u",
+	0x8A: "i16x8.extend_high_i8x16_u",
+	0x8B: "i16x8.shl",
+	0x8C: "i16x8.shr_s",
+	0x8D: "i16x8.shr_u",
+	0x8E: "i16x8.add",
+	0x8F: "i16x8.add_sat_s",
+	0x90: "i16x8.add_sat_u",
+	0x91: "i16x8.sub",
+	0x92: "i16x8.sub_sat_s",
+	0x93: "i16x8.sub_sat_u",
+	0x94: "f64x2.nearest",
+	0x95: "i16x8.mul",
+	0x96: "i16x8.min_s",
+	0x97: "i16x8.min_u",
+	0x98: "i16x8.max_s",
+	0x99: "i16x8.max_u",
+	0x9B: "i16x8.avgr_u",
+	0x9C: "i16x8.extmul_low_i8x16_s",
+	0x9D: "i16x8.extmul_high_i8x16_s",
+	0x9E: "i16x8.extmul_low_i8x16_u",
+	0x9F: "i16x8.extmul_high_i8x16_u",
+	0xA0: "i32x4.abs",
+	0xA1: "i32x4.neg",
+	0xA3: "i32x4.all_true",
+	0xA4: "i32x4.bitmask",
+	0xA7: "i32x4.extend_low_i16x8_s",
+	0xA8: "i32x4.extend_high_i16x8_s",
+	0xA9: "i32x4.extend_low_i16x8_u",
+	0xAA: "i32x4.extend_high_i16x8_u",
+	0xAB: "i32x4.shl",
+	0xAC: "i32x4.shr_s",
+	0xAD: "i32x4.shr_u",
+	0xAE: "i32x4.add",
+	0xB1: "i32x4.sub",
+	0xB5: "i32x4.mul",
+	0xB6: "i32x4.min_s",
+	0xB7: "i32x4.min_u",
+	0xB8: "i32x4.max_s",
+	0xB9: "i32x4.max_u",
+	0xBA: "i32x4.dot_i16x8_s",
+	0xBC: "i32x4.extmul_low_i16x8_s",
+	0xBD: "i32x4.extmul_high_i16x8_s",
+	0xBE: "i32x4.extmul_low_i16x8_u",
+	0xBF: "i32x4.extmul_high_i16x8_u",
+	0xC0: "i64x2.abs",
+	0xC1: "i64x2.neg",
+	0xC3: "i64x2.all_true",
+	0xC4: "i64x2.bitmask",
+	0xC7: "i64x2.extend_low_i32x4_s",
+	0xC8: "i64x2.extend_high_i32x4_s",
+	0xC9: "i64x2.extend_low_i32x4_u",
+	0xCA: "i64x2.extend_high_i32x4_u",
+	0xCB: "i64x2.shl",
+	0xCC: "i64x2.shr_s",
+	0xCD: "i64x2.shr_u",
+	0xCE: "i64x2.add",
+	0xD1: "i64x2.sub",
+	0xD5: "i64x2.mul",
+	0xD6: "i64x2.eq",
+	0xD7: "i64x2.ne",
+	0xD8: "i64x2.lt_s",
+	0xD9: "i64x2.gt_s",
+	0xDA: "i64x2.le_s",
+	0xDB: "i64x2.ge_s",
+	0xDC: "i64x2.extmul_low_i32x4_s",
+	0xDD: "i64x2.extmul_high_i32x4_s",
+	0xDE: "i64x2.extmul_low_i32x4_u",
+	0xDF: "i64x2.extmul_high_i32x4_u",
+	0xE0: "f32x4.abs",
+	0xE1: "f32x4.neg",
+	0xE3: "f32x4.sqrt",
+	0xE4: "f32x4.add",
+	0xE5: "f32x4.sub",
+	0xE6: "f32x4.mul",
+	0xE7: "f32x4.div",
+	0xE8: "f32x4.min",
+	0xE9: "f32x4.max",
+	0xEA: "f32x4.pmin",
+	0xEB: "f32x4.pmax",
+	0xEC: "f64x2.abs",
+	0xED: "f64x2.neg",
+	0xEF: "f64x2.sqrt",
+	0xF0: "f64x2.add",
+	0xF1: "f64x2.sub",
+	0xF2: "f64x2.mul",
+	0xF3: "f64x2.div",
+	0xF4: "f64x2.min",
+	0xF5: "f64x2.max",
+	0xF6: "f64x2.pmin",
+	0xF7: "f64x2.pmax",
+	0xF8: "i32x4.trunc_sat_f32x4_s",
+	0xF9: "i32x4.trunc_sat_f32x4_u",
+	0xFA: "f32x4.convert_i32x4_s",
+	0xFB: "f32x4.convert_i32x4_u",
+	0xFC: "i32x4.trunc_sat_f64x2_s_zero",
+	0xFD: "i32x4.trunc_sat_f64x2_u_zero",
+	0xFE: "f64x2.convert_low_i32x4_s",
+	0xFF: "f64x2.convert_low_i32x4_u",
+}
+
+var atomicOpnames = map[uint32]string{
+	0x00: "memory.atomic.notify",
+	0x01: "memory.atomic.wait32",
+	0x02: "memory.atomic.wait64",
+	0x03: "atomic.fence",
+	0x10: "i32.atomic.load",
+	0x11: "i64.atomic.load",
+	0x12: "i32.atomic.load8_u",
+	0x13: "i32.atomic.load16_u",
+	0x14: "i64.atomic.load8_u",
+	0x15: "i64.atomic.load16_u",
+	0x16: "i64.atomic.load32_u",
+	0x17: "i32.atomic.store",
+	0x18: "i64.atomic.store",
+	0x19: "i32.atomic.store8",
+	0x1A: "i32.atomic.store16",
+	0x1B: "i64.atomic.store8",
+	0x1C: "i64.atomic.store16",
+	0x1D: "i64.atomic.store32",
+	0x1E: "i32.atomic.rmw.add",
+	0x1F: "i64.atomic.rmw.add",
+	0x20: "i32.atomic.rmw8.add_u",
+	0x21: "i32.atomic.rmw16.add_u",
+	0x22: "i64.atomic.rmw8.add_u",
+	0x23: "i64.atomic.rmw16.add_u",
+	0x24: "i64.atomic.rmw32.add_u",
+	0x25: "i32.atomic.rmw.sub",
+	0x26: "i64.atomic.rmw.sub",
+	0x27: "i32.atomic.rmw8.sub_u",
+	0x28: "i32.atomic.rmw16.sub_u",
+	0x29: "i64.atomic.rmw8.sub_u",
+	0x2A: "i64.atomic.rmw16.sub_u",
+	0x2B: "i64.atomic.rmw32.sub_u",
+	0x2C: "i32.atomic.rmw.and",
+	0x2D: "i64.atomic.rmw.and",
+	0x2E: "i32.atomic.rmw8.and_u",
+	0x2F: "i32.atomic.rmw16.and_u",
+	0x30: "i64.atomic.rmw8.and_u",
+	0x31: "i64.atomic.rmw16.and_u",
+	0x32: "i64.atomic.rmw32.and_u",
+	0x33: "i32.atomic.rmw.or",
+	0x34: "i64.atomic.rmw.or",
+	0x35: "i32.atomic.rmw8.or_u",
+	0x36: "i32.atomic.rmw16.or_u",
+	0x37: "i64.atomic.rmw8.or_u",
+	0x38: "i64.atomic.rmw16.or_u",
+	0x39: "i64.atomic.rmw32.or_u",
+	0x3A: "i32.atomic.rmw.xor",
+	0x3B: "i64.atomic.rmw.xor",
+	0x3C: "i32.atomic.rmw8.xor_u",
+	0x3D: "i32.atomic.rmw16.xor_u",
+	0x3E: "i64.atomic.rmw8.xor_u",
+	0x3F: "i64.atomic.rmw16.xor_u",
+	0x40: "i64.atomic.rmw32.xor_u",
+	0x41: "i32.atomic.rmw.xchg",
+	0x42: "i64.atomic.rmw.xchg",
+	0x43: "i32.atomic.rmw8.xchg_u",
+	0x44: "i32.atomic.rmw16.xchg_u",
+	0x45: "i64.atomic.rmw8.xchg_u",
+	0x46: "i64.atomic.rmw16.xchg_u",
+	0x47: "i64.atomic.rmw32.xchg_u",
+	0x48: "i32.atomic.rmw.cmpxchg",
+	0x49: "i64.atomic.rmw.cmpxchg",
+	0x4A: "i32.atomic.rmw8.cmpxchg_u",
+	0x4B: "i32.atomic.rmw16.cmpxchg_u",
+	0x4C: "i64.atomic.rmw8.cmpxchg_u",
+	0x4D: "i64.atomic.rmw16.cmpxchg_u",
+	0x4E: "i64.atomic.rmw32.cmpxchg_u",
+}
+
+func (instr Instruction) GetOpname() string {
+	if instr.Opcode == PrefixMisc {
+		return miscOpnames[instr.SubOpcode]
+	}
+	if instr.Opcode == PrefixSIMD {
+		return simdOpnames[instr.SubOpcode]
+	}
+	if instr.Opcode == PrefixAtomic {
+		return atomicOpnames[instr.SubOpcode]
+	}
+	return opnames[instr.Opcode]
+}
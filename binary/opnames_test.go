@@ -0,0 +1,62 @@
+package binary
+
+import "testing"
+
+func TestOpcodeValues(t *testing.T) {
+	// a sample of each group, with the value the spec gives it
+	tests := []struct {
+		opcode int
+		want   int
+		name   string
+	}{
+		{Unreachable, 0x00, "unreachable"},
+		{Nop, 0x01, "nop"},
+		{Block, 0x02, "block"},
+		{BrTable, 0x0E, "br_table"},
+		{CallIndirect, 0x11, "call_indirect"},
+		{Drop, 0x1A, "drop"},
+		{LocalGet, 0x20, "local.get"},
+		{GlobalSet, 0x24, "global.set"},
+		{I32Load, 0x28, "i32.load"},
+		{I64Store32, 0x3E, "i64.store32"},
+		{MemoryGrow, 0x40, "memory.grow"},
+		{I32Const, 0x41, "i32.const"},
+		{F64Const, 0x44, "f64.const"},
+		{I32Eqz, 0x45, "i32.eqz"},
+		{F64Ge, 0x66, "f64.ge"},
+		{I32Add, 0x6A, "i32.add"},
+		{F64CopySign, 0xA6, "f64.copysign"},
+		{I32WrapI64, 0xA7, "i32.wrap_i64"},
+		{F64ReinterpretI64, 0xBF, "f64.reinterpret_i64"},
+		{I64Extend32S, 0xC4, "i64.extend32_s"},
+	}
+	for _, tt := range tests {
+		if tt.opcode != tt.want {
+			t.Fatalf("%s: got opcode 0x%02x, want 0x%02x", tt.name, tt.opcode, tt.want)
+		}
+		if name := opnames[tt.opcode]; name != tt.name {
+			t.Fatalf("opcode 0x%02x: got name %q, want %q", tt.opcode, name, tt.name)
+		}
+	}
+}
+
+// TestOpnamesComplete checks that the numeric instructions, which are
+// numbered without gaps, all have a name, and that no two opcodes share
+// one but the two forms of select
+func TestOpnamesComplete(t *testing.T) {
+	for opcode := I32Eqz; opcode <= I64Extend32S; opcode++ {
+		if opnames[opcode] == "" {
+			t.Fatalf("opcode 0x%02x has no name", opcode)
+		}
+	}
+	seen := map[string]int{}
+	for opcode, name := range opnames {
+		if name == "" || opcode == SelectT {
+			continue
+		}
+		if other, ok := seen[name]; ok {
+			t.Fatalf("opcodes 0x%02x and 0x%02x are both named %q", other, opcode, name)
+		}
+		seen[name] = opcode
+	}
+}
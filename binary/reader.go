@@ -4,46 +4,177 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"math"
+	"os"
+	"time"
 	"unicode/utf8"
 )
 
 type wasmReader struct {
-	data []byte
+	data      []byte
+	end       int // absolute offset of the end of data
+	opts      DecodeOptions
+	dataCount *uint32
+	arena     *arena // nil unless decoding with DecodeArena
+	secData   []byte // data from the id of the current section on
+	inSec     bool   // reading the content of section secID
+	secID     byte
+	stream    *streamReader // nil unless decoding with DecodeReader
+}
+
+// DecodeOptions controls decoding. Note that the zero value only
+// accepts MVP modules, use DefaultDecodeOptions to start from the
+// options Decode uses.
+type DecodeOptions struct {
+	Features Features
+	// RecordCodeOffsets records the absolute byte range of each
+	// function body in Code.Start and Code.End, and the offset of each
+	// instruction in Code.InstrOffsets
+	RecordCodeOffsets bool
+	// RecordInstrBytes keeps the bytes of each instruction in
+	// Instruction.Raw
+	RecordInstrBytes bool
+	// KeepRawSections keeps the bytes of each non-custom section in
+	// Module.RawSecs so that Encode can write back unchanged the sections
+	// whose fields were not modified. Each section is encoded once more
+	// while decoding to detect modifications later.
+	KeepRawSections bool
+	// SectionTimer, if set, is called with the time spent decoding each
+	// section
+	SectionTimer func(secID byte, elapsed time.Duration)
+	// AllowTrailingBytes stops decoding at the first bytes that do not
+	// start a well-formed section and keeps them in Module.Trailing
+	// instead of failing
+	AllowTrailingBytes bool
+	// MaxFuncBodyBytes bounds the size of each function body, locals
+	// included. Larger bodies fail with a *FuncBodyTooLargeError. 0 means
+	// no limit.
+	MaxFuncBodyBytes int
+	// These bound the number of entries of their sections, more fail
+	// with a *CountLimitError. 0 means no limit.
+	MaxImports      int
+	MaxGlobals      int
+	MaxElemSegments int
+	MaxDataSegments int
+}
+
+func DefaultDecodeOptions() DecodeOptions {
+	return DecodeOptions{
+		Features: AllFeatures(),
+	}
 }
 
 func DecodeFile(filename string) (Module, error) {
-	data, err := ioutil.ReadFile(filename)
+	return DecodeFileWithOptions(filename, DefaultDecodeOptions())
+}
+
+func DecodeFileWithOptions(filename string, opts DecodeOptions) (Module, error) {
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		return Module{}, err
 	}
 
-	return Decode(data)
+	return DecodeWithOptions(data, opts)
+}
+
+func Decode(data []byte) (Module, error) {
+	return DecodeWithOptions(data, DefaultDecodeOptions())
+}
+
+// DecodeReader decodes a module read from r section by section, the
+// input is never held in memory as a whole. A malformed module fails as
+// soon as the section at fault is read.
+func DecodeReader(r io.Reader) (Module, error) {
+	return DecodeReaderWithOptions(r, DefaultDecodeOptions())
+}
+
+// Sniff reads the magic number and version from the first 8 bytes of data
+// without looking at any section. ok is false if data is too short or the
+// magic number is wrong, the version is returned as is.
+func Sniff(data []byte) (magic, version uint32, ok bool) {
+	if len(data) < 8 {
+		return 0, 0, false
+	}
+	magic = binary.LittleEndian.Uint32(data)
+	version = binary.LittleEndian.Uint32(data[4:])
+	return magic, version, magic == MagicNumber
+}
+
+// IsComponent tells whether data starts with the preamble of a
+// component-model binary rather than a core module
+func IsComponent(data []byte) bool {
+	_, version, ok := Sniff(data)
+	return ok && version>>16 == ComponentLayer
+}
+
+func DecodeWithOptions(data []byte, opts DecodeOptions) (Module, error) {
+	return decode(data, opts, nil)
+}
+
+func decode(data []byte, opts DecodeOptions, a *arena) (Module, error) {
+	return (&wasmReader{
+		data:  data,
+		end:   len(data),
+		opts:  opts,
+		arena: a,
+	}).decode()
 }
 
-func Decode(data []byte) (module Module, err error) {
+func (reader *wasmReader) decode() (module Module, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			switch x := r.(type) {
 			case error:
-				err = x
+				err = reader.errorAt(x)
 			default:
 				err = errors.New("unknown error")
 			}
 		}
 	}()
 
-	reader := &wasmReader{data: data}
 	reader.readModule(&module)
 
 	return
 }
 
+// errorAt adds the current offset of reader to err, unless a reader
+// reading a part of the data, like a function body, already did
+func (reader *wasmReader) errorAt(err error) error {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return err
+	}
+	return &DecodeError{Offset: reader.offset(), InSection: reader.inSec, SecID: reader.secID, Err: err}
+}
+
+// recoverAt re-panics with the offset of reader added to the error, for
+// readers of a part of the data. Call it deferred.
+func (reader *wasmReader) recoverAt() {
+	if r := recover(); r != nil {
+		if err, ok := r.(error); ok {
+			panic(reader.errorAt(err))
+		}
+		panic(r)
+	}
+}
+
+// subReader reads data that was just read from reader
+func (reader *wasmReader) subReader(data []byte) *wasmReader {
+	subReader := *reader
+	subReader.data = data
+	subReader.end = reader.offset()
+	return &subReader
+}
+
 func (reader *wasmReader) remaining() int {
 	return len(reader.data)
 }
 
+func (reader *wasmReader) offset() int {
+	return reader.end - len(reader.data)
+}
+
 func (reader *wasmReader) readByte() byte {
 	if len(reader.data) < 1 {
 		panic(errUnexpectedEnd)
@@ -132,57 +263,161 @@ func (reader *wasmReader) readName() string {
 }
 
 func (reader *wasmReader) readModule(module *Module) {
+	module.Magic, module.Version = reader.readPreamble()
+	reader.readSections(module)
+	if len(module.FuncSec) != len(module.CodeSec) {
+		panic(funcCodeMismatch(len(module.FuncSec), len(module.CodeSec),
+			module.importedCount(ImportTagFunc)))
+	}
+	checkDataCount(module.DataCountSec, len(module.DataSec))
+	if reader.remaining() > 0 {
+		if !reader.opts.AllowTrailingBytes {
+			panic(errors.New("junk after last section"))
+		}
+		module.Trailing = reader.readTrailing()
+	}
+}
+
+// funcCodeMismatch describes a function section and a code section of
+// different lengths, the first entry without a counterpart is usually
+// where the module was truncated or edited
+func funcCodeMismatch(funcCount, codeCount, importedFuncCount int) error {
+	msg := fmt.Sprintf("function and code section have inconsistent lengths: %d functions, %d bodies",
+		funcCount, codeCount)
+	if funcCount > codeCount {
+		return fmt.Errorf("%s; function %d has no body", msg, importedFuncCount+codeCount)
+	}
+	return fmt.Errorf("%s; body %d has no function declaration", msg, funcCount)
+}
+
+// checkDataCount checks the data count section, if there is one, against
+// the number of data segments
+func checkDataCount(dataCount *uint32, segments int) {
+	if dataCount != nil && int(*dataCount) != segments {
+		panic(fmt.Errorf("data count and data section have inconsistent lengths: count %d, %d segments",
+			*dataCount, segments))
+	}
+}
+
+func (reader *wasmReader) readPreamble() (magic, version uint32) {
 	if reader.remaining() < 4 {
 		panic(errors.New("unexpected end of magic header"))
 	}
-	module.Magic = reader.readU32()
-	if module.Magic != MagicNumber {
+	magic = reader.readU32()
+	if magic != MagicNumber {
 		panic(errors.New("magic header not detected"))
 	}
 
 	if reader.remaining() < 4 {
 		panic(errors.New("unexpected end of binary version"))
 	}
-	module.Version = reader.readU32()
-	if module.Version != Version {
-		panic(fmt.Errorf("unknown binary version: %d", module.Version))
-	}
-
-	reader.readSections(module)
-	if len(module.FuncSec) != len(module.CodeSec) {
-		panic(errors.New("function and code section have inconsistent lengths"))
+	version = reader.readU32()
+	if version>>16 == ComponentLayer {
+		panic(errComponent)
 	}
-	if reader.remaining() > 0 {
-		panic(errors.New("junk after last section"))
+	if version != Version {
+		panic(fmt.Errorf("unknown binary version: %d", version))
 	}
+
+	return
 }
 
 func (reader *wasmReader) readSections(module *Module) {
+	reader.forEachSection(func(secID byte) {
+		if secID == SecCustomID {
+			module.CustomSecs = append(module.CustomSecs, reader.readCustomSec())
+		} else {
+			reader.readNonCustomSec(secID, module)
+			if reader.opts.KeepRawSections {
+				if module.RawSecs == nil {
+					module.RawSecs = make(map[byte][]byte)
+					module.rawSums = make(map[byte][32]byte)
+				}
+				module.RawSecs[secID] = reader.secData[:len(reader.secData)-reader.remaining()]
+				module.rawSums[secID] = secSum(*module, secID)
+			}
+		}
+	})
+}
+
+// forEachSection checks the id, order and size of every section and calls
+// read to read its content. The size of custom sections is left to read.
+func (reader *wasmReader) forEachSection(read func(secID byte)) {
+	if timer := reader.opts.SectionTimer; timer != nil {
+		untimedRead := read
+		read = func(secID byte) {
+			start := time.Now()
+			untimedRead(secID)
+			timer(secID, time.Since(start))
+		}
+	}
+
 	prevSecID := byte(0)
-	for reader.remaining() > 0 {
+	seen := make(map[byte]bool)
+	for reader.nextSection() {
+		if reader.opts.AllowTrailingBytes && !reader.atSection(prevSecID, seen) {
+			return
+		}
+		reader.secData = reader.data
 		secID := reader.readByte()
 		if secID == SecCustomID {
-			module.CustomSecs = append(module.CustomSecs, reader.readCustomSec())
+			reader.inSec, reader.secID = true, secID
+			read(secID)
+			reader.inSec = false
 			continue
 		}
 
-		if secID > SecDataID {
+		if secID > SecDataCountID {
 			panic(fmt.Errorf("malformed section id: %d", secID))
 		}
 
-		if secID <= prevSecID {
-			panic(fmt.Errorf("junk after last section, id: %d", secID))
+		if seen[secID] {
+			panic(fmt.Errorf("duplicate section id %d", secID))
+		}
+		seen[secID] = true
+		if secOrder(secID) < secOrder(prevSecID) {
+			panic(fmt.Errorf("section %d out of order (after %d)", secID, prevSecID))
 		}
 		prevSecID = secID
 
+		reader.inSec, reader.secID = true, secID
 		n := reader.readVarU32()
-		remainingBeforeRead := reader.remaining()
-		reader.readNonCustomSec(secID, module)
-		if reader.remaining()+int(n) != remainingBeforeRead {
+		start := reader.offset()
+		read(secID)
+		if reader.offset() != start+int(n) {
 			panic(fmt.Errorf("section size mismatch, id: %d", secID))
 		}
+		reader.inSec = false
+	}
+}
+
+// atSection reports whether the remaining data starts with a section that
+// may follow prevSecID: a known id, a size within the data and, for custom
+// sections, a name that fits in the section
+func (reader *wasmReader) atSection(prevSecID byte, seen map[byte]bool) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
 
+	peekReader := &wasmReader{data: reader.data}
+	secID := peekReader.readByte()
+	content := peekReader.readBytes()
+	if secID == SecCustomID {
+		(&wasmReader{data: content}).readName()
+		return true
 	}
+	return secID <= SecDataCountID && !seen[secID] &&
+		secOrder(secID) >= secOrder(prevSecID)
+}
+
+// DataCount 段的 id 是 12, 但它必须出现在 Element 段和 Code 段之间
+func secOrder(secID byte) int {
+	if secID == SecDataCountID {
+		return SecElemID*2 + 1
+	}
+	return int(secID) * 2
 }
 
 func (reader *wasmReader) readCustomSec() CustomSec {
@@ -196,48 +431,34 @@ func (reader *wasmReader) readCustomSec() CustomSec {
 }
 
 func (reader *wasmReader) readNonCustomSec(secID byte, module *Module) {
-	switch secID {
-	case SecTypeID:
-		module.TypeSec = reader.readTypeSec()
-	case SecImportID:
-		module.ImportSec = reader.readImportSec()
-	case SecFuncID:
-		module.FuncSec = reader.readIndices()
-	case SecTableID:
-		module.TableSec = reader.readTableSec()
-	case SecMemID:
-		module.MemSec = reader.readMemSec()
-	case SecGlobalID:
-		module.GlobalSec = reader.readGlobalSec()
-	case SecExportID:
-		module.ExportSec = reader.readExportSec()
-	case SecStartID:
-		module.StartSec = reader.readStartSec()
-	case SecElemID:
-		module.ElemSec = reader.readElemSec()
-	case SecCodeID:
+	if secID == SecCodeID {
 		module.CodeSec = reader.readCodeSec()
-	case SecDataID:
-		module.DataSec = reader.readDataSec()
+	} else {
+		reader.readSec(secID, moduleBuilder{module})
 	}
 }
 
-func (reader *wasmReader) readTypeSec() []FuncType {
-	vec := make([]FuncType, reader.readVarU32())
-	for i := range vec {
-		vec[i] = reader.readFuncType()
-	}
-	return vec
+// moduleBuilder is the Handler Decode reads the sections other than the
+// code section with, it adds each entry to the module
+type moduleBuilder struct {
+	*Module
 }
 
-func (reader *wasmReader) readImportSec() []Import {
-	vec := make([]Import, reader.readVarU32())
-	for i := range vec {
-		vec[i] = reader.readImport()
-	}
-
-	return vec
-}
+func (b moduleBuilder) OnCustomSec(sec CustomSec)            {}
+func (b moduleBuilder) OnType(ft FuncType)                   { b.TypeSec = append(b.TypeSec, ft) }
+func (b moduleBuilder) OnImport(imp Import)                  { b.ImportSec = append(b.ImportSec, imp) }
+func (b moduleBuilder) OnFunc(typeIdx TypeIdx)               { b.FuncSec = append(b.FuncSec, typeIdx) }
+func (b moduleBuilder) OnTable(tt TableType)                 { b.TableSec = append(b.TableSec, tt) }
+func (b moduleBuilder) OnMem(mt MemType)                     { b.MemSec = append(b.MemSec, mt) }
+func (b moduleBuilder) OnGlobal(g Global)                    { b.GlobalSec = append(b.GlobalSec, g) }
+func (b moduleBuilder) OnExport(exp Export)                  { b.ExportSec = append(b.ExportSec, exp) }
+func (b moduleBuilder) OnStart(idx FuncIdx)                  { b.StartSec = &idx }
+func (b moduleBuilder) OnElem(elem Elem)                     { b.ElemSec = append(b.ElemSec, elem) }
+func (b moduleBuilder) OnDataCount(n uint32)                 { b.DataCountSec = &n }
+func (b moduleBuilder) OnCodeStart(idx int, locals []Locals) {}
+func (b moduleBuilder) OnInstruction(instr Instruction)      {}
+func (b moduleBuilder) OnCodeEnd(idx int)                    {}
+func (b moduleBuilder) OnData(data Data)                     { b.DataSec = append(b.DataSec, data) }
 
 func (reader *wasmReader) readImport() Import {
 	return Import{
@@ -260,7 +481,7 @@ func (reader *wasmReader) readImportDesc() ImportDesc {
 		desc.Table = reader.readTableType()
 
 	case ImportTagMem:
-		desc.Mem = reader.readLimits()
+		desc.Mem = reader.readMemType()
 
 	case ImportTagGlobal:
 		desc.Global = reader.readGlobalType()
@@ -272,43 +493,10 @@ func (reader *wasmReader) readImportDesc() ImportDesc {
 	return desc
 }
 
-func (reader *wasmReader) readTableSec() []TableType {
-	vec := make([]TableType, reader.readVarU32())
-	for i := range vec {
-		vec[i] = reader.readTableType()
-	}
-
-	return vec
-}
-
-func (reader *wasmReader) readMemSec() []MemType {
-	vec := make([]MemType, reader.readVarU32())
-	for i := range vec {
-		vec[i] = reader.readLimits()
-	}
-
-	return vec
-}
-
-func (reader *wasmReader) readGlobalSec() []Global {
-	vec := make([]Global, reader.readVarU32())
-	for i := range vec {
-		vec[i] = Global{
-			Type: reader.readGlobalType(),
-			Init: reader.readExpr(),
-		}
-	}
-
-	return vec
-}
-
-func (reader *wasmReader) readExportSec() []Export {
-	vec := make([]Export, reader.readVarU32())
-	for i := range vec {
-		vec[i] = reader.readExport()
-	}
-
-	return vec
+func (reader *wasmReader) readMemType() MemType {
+	mt := reader.readLimits()
+	checkMemType(mt)
+	return mt
 }
 
 func (reader *wasmReader) readExport() Export {
@@ -341,49 +529,120 @@ func (reader *wasmReader) readStartSec() *uint32 {
 	return &idx
 }
 
-func (reader *wasmReader) readElemSec() []Elem {
-	vec := make([]Elem, reader.readVarU32())
-	for i := range vec {
-		vec[i] = reader.readElem()
+// readElem reads an element segment. Bit 0 of the flags marks a passive
+// or declarative segment, bit 1 an explicit table index (active) or a
+// declarative segment, bit 2 element expressions instead of indices.
+func (reader *wasmReader) readElem() Elem {
+	flags := reader.readVarU32()
+	if flags > 7 {
+		panic(fmt.Errorf("invalid element segment flags: %d", flags))
+	}
+	if flags != 0 {
+		reader.requireFeature(reader.opts.Features.BulkMemory, "bulk-memory")
 	}
 
-	return vec
-}
+	elem := Elem{}
+	switch {
+	case flags&1 == 0:
+		elem.Mode = ElemModeActive
+		if flags&2 != 0 {
+			elem.Table = reader.readVarU32()
+		}
+		elem.Offset = reader.readConstExpr()
+	case flags&2 == 0:
+		elem.Mode = ElemModePassive
+	default:
+		elem.Mode = ElemModeDeclarative
+	}
 
-func (reader *wasmReader) readElem() Elem {
-	return Elem{
-		Table:  reader.readVarU32(),
-		Offset: reader.readExpr(),
-		Init:   reader.readIndices(),
+	exprs := flags&4 != 0
+	elem.Type = FuncRef
+	if flags&3 != 0 {
+		// 0 和 4 没有元素类型, 隐含 funcref
+		if exprs {
+			elem.Type = reader.readRefType()
+		} else if kind := reader.readByte(); kind != 0x00 {
+			panic(fmt.Errorf("malformed element kind: %d", kind))
+		}
+	}
+
+	if exprs {
+		elem.Exprs = make([]Expr, reader.readVarU32())
+		for i := range elem.Exprs {
+			elem.Exprs[i] = reader.readConstExpr()
+		}
+	} else {
+		elem.Init = reader.readIndices()
 	}
+
+	return elem
+}
+
+func (reader *wasmReader) readDataCountSec() *uint32 {
+	reader.requireFeature(reader.opts.Features.BulkMemory, "bulk-memory")
+	n := reader.readVarU32()
+	return &n
 }
 
 func (reader *wasmReader) readCodeSec() []Code {
 	vec := make([]Code, reader.readVarU32())
 	for i := range vec {
-		vec[i] = reader.readCode()
+		vec[i] = reader.readCode(i)
 	}
 
 	return vec
 }
 
-func (reader *wasmReader) readCode() Code {
-	codeReader := &wasmReader{
-		data: reader.readBytes(),
+// readCount reads the length of a vector, which must not be more than
+// max unless max is 0
+func (reader *wasmReader) readCount(max int, what string) uint32 {
+	n := reader.readVarU32()
+	if max > 0 && uint64(n) > uint64(max) {
+		panic(&CountLimitError{What: what, Count: int(n), Max: max})
+	}
+	return n
+}
+
+// checkFuncBodySize checks the size of the code section entry i, about
+// to be read, against MaxFuncBodyBytes
+func (reader *wasmReader) checkFuncBodySize(i int) {
+	if max := reader.opts.MaxFuncBodyBytes; max > 0 {
+		size, _ := decodeVarUint(reader.data, 32)
+		if size > uint64(max) {
+			panic(&FuncBodyTooLargeError{Index: i, Size: int(size), Max: max})
+		}
 	}
-	code := Code{
-		Locals: codeReader.readLocalsVec(),
+}
+
+func (reader *wasmReader) readCode(i int) Code {
+	reader.checkFuncBodySize(i)
+	codeReader := reader.subReader(reader.readBytes())
+	defer codeReader.recoverAt()
+	code := Code{}
+	var offsets *[]int
+	if reader.opts.RecordCodeOffsets {
+		code.Start = codeReader.offset()
+		code.End = codeReader.end
+		offsets = &code.InstrOffsets
 	}
-	localCount := code.GetLocalCount()
-	if localCount >= math.MaxUint32 {
-		panic(fmt.Errorf("too many locals: %d", localCount))
+	code.Locals = codeReader.readLocalsVec()
+	checkLocalCount(code.GetLocalCount())
+	code.Expr = codeReader.readExpr(offsets)
+	if codeReader.remaining() > 0 {
+		panic(fmt.Errorf("function body %d: %d bytes after the final end", i, codeReader.remaining()))
 	}
 
 	return code
 }
 
 func (reader *wasmReader) readLocalsVec() []Locals {
-	vec := make([]Locals, reader.readVarU32())
+	n := reader.readVarU32()
+	var vec []Locals
+	if reader.arena != nil {
+		vec = reader.arena.locals.alloc(int(n))
+	} else {
+		vec = make([]Locals, n)
+	}
 	for i := range vec {
 		vec[i] = reader.readLocals()
 	}
@@ -398,26 +657,39 @@ func (reader *wasmReader) readLocals() Locals {
 	}
 }
 
-func (reader *wasmReader) readDataSec() []Data {
-	vec := make([]Data, reader.readVarU32())
-	for i := range vec {
-		vec[i] = reader.readData()
-	}
-
-	return vec
-}
-
+// readData reads a data segment. The flags are 0 for an active segment
+// of memory 0, 1 for a passive segment and 2 for an active segment with
+// an explicit memory index.
 func (reader *wasmReader) readData() Data {
-	return Data{
-		Mem:    reader.readVarU32(),
-		Offset: reader.readExpr(),
-		Init:   reader.readBytes(),
+	flags := reader.readVarU32()
+	data := Data{}
+	switch flags {
+	case 0:
+	case 1:
+		reader.requireFeature(reader.opts.Features.BulkMemory, "bulk-memory")
+		data.Mode = DataModePassive
+	case 2:
+		data.Mem = reader.readVarU32()
+	default:
+		panic(fmt.Errorf("invalid data segment flags: %d", flags))
+	}
+	if data.Mode == DataModeActive {
+		data.Offset = reader.readConstExpr()
 	}
+	data.Init = reader.readBytes()
+
+	return data
 }
 
 // 值类型
 func (reader *wasmReader) readValTypes() []ValType {
-	vec := make([]ValType, reader.readVarU32())
+	n := reader.readVarU32()
+	var vec []ValType
+	if reader.arena != nil {
+		vec = reader.arena.valTypes.alloc(int(n))
+	} else {
+		vec = make([]ValType, n)
+	}
 	for i := range vec {
 		vec[i] = reader.readValType()
 	}
@@ -427,16 +699,112 @@ func (reader *wasmReader) readValTypes() []ValType {
 
 func (reader *wasmReader) readValType() ValType {
 	vt := reader.readByte()
-	switch vt {
-	case ValTypeI32, ValTypeI64, ValTypeF32, ValTypeF64:
-	default:
-		panic(fmt.Errorf("malformed value type: %d", vt))
-	}
+	reader.checkValType(vt, "value type")
 
 	return vt
 }
 
+func (reader *wasmReader) checkValType(vt ValType, what string) {
+	info, ok := valTypes[vt]
+	if !ok {
+		panic(fmt.Errorf("malformed %s: %d", what, vt))
+	}
+	if info.enabled != nil {
+		reader.requireFeature(info.enabled(reader.opts.Features), info.feature)
+	}
+}
+
 // 实体类型
+
+// readRecType reads an entry of the type section, which is a single type
+// or, under the GC proposal, a recursion group of types. start is the
+// index of the first type read.
+func (reader *wasmReader) readRecType(start TypeIdx) []FuncType {
+	if len(reader.data) == 0 || reader.data[0] != RecTag {
+		return []FuncType{reader.readSubType()}
+	}
+	reader.requireFeature(reader.opts.Features.GC, "gc")
+	reader.readByte()
+
+	n := reader.readVarU32()
+	group := RecGroup{Start: start, Size: n}
+	types := make([]FuncType, n)
+	for i := range types {
+		types[i] = reader.readSubType()
+		types[i].RecGroup = group
+	}
+	return types
+}
+
+// readSubType reads a type, which the GC proposal allows to declare as a
+// subtype of others
+func (reader *wasmReader) readSubType() FuncType {
+	var sub byte
+	var supers []TypeIdx
+	if len(reader.data) > 0 && (reader.data[0] == SubTag || reader.data[0] == SubFinalTag) {
+		reader.requireFeature(reader.opts.Features.GC, "gc")
+		sub = reader.readByte()
+		supers = reader.readIndices()
+	}
+
+	var ft FuncType
+	if len(reader.data) > 0 && (reader.data[0] == StructTag || reader.data[0] == ArrayTag) {
+		reader.requireFeature(reader.opts.Features.GC, "gc")
+		ft.Tag = reader.readByte()
+		if ft.Tag == StructTag {
+			ft.Fields = make([]FieldType, reader.readVarU32())
+			for i := range ft.Fields {
+				ft.Fields[i] = reader.readFieldType()
+			}
+		} else {
+			ft.Fields = []FieldType{reader.readFieldType()}
+		}
+	} else {
+		ft = reader.readFuncType()
+	}
+	ft.Sub = sub
+	ft.Supers = supers
+	return ft
+}
+
+// readFieldType reads the storage type and mutability of a struct field
+// or array element
+func (reader *wasmReader) readFieldType() FieldType {
+	var field FieldType
+	switch b := reader.readByte(); {
+	case b == PackedI8 || b == PackedI16:
+		field.Type = b
+	case b == RefTag || b == RefNullTag:
+		field.Type = b
+		field.HeapType = reader.readHeapType()
+	case b >= 0x71 && b <= 0x73 || b >= 0x6A && b <= 0x6E:
+		// anyref 等的简写
+		field.Type = b
+	default:
+		reader.checkValType(b, "storage type")
+		field.Type = b
+	}
+
+	field.Mut = reader.readByte()
+	if field.Mut != MutConst && field.Mut != MutVar {
+		panic(fmt.Errorf("malformed mutability: %d", field.Mut))
+	}
+	return field
+}
+
+// readHeapType reads a type index, or an abstract heap type encoded as a
+// negative s33
+func (reader *wasmReader) readHeapType() int64 {
+	n, w := decodeVarInt(reader.data, 33)
+	reader.data = reader.data[w:]
+	if n < 0 {
+		if _, ok := heapTypeNames[byte(n&0x7F)]; !ok || n < -0x40 {
+			panic(fmt.Errorf("malformed heap type: %d", n))
+		}
+	}
+	return n
+}
+
 func (reader *wasmReader) readFuncType() FuncType {
 	ft := FuncType{
 		Tag:         reader.readByte(),
@@ -447,6 +815,9 @@ func (reader *wasmReader) readFuncType() FuncType {
 	if ft.Tag != FtTag {
 		panic(fmt.Errorf("invalid functype tag: %d", ft.Tag))
 	}
+	if len(ft.ResultTypes) > 1 {
+		reader.requireFeature(reader.opts.Features.MultiValue, "multi-value")
+	}
 
 	return ft
 }
@@ -456,7 +827,11 @@ func (reader *wasmReader) readTableType() TableType {
 		ElemType: reader.readByte(),
 		Limits:   reader.readLimits(),
 	}
-	if tt.ElemType != FuncRef {
+	switch tt.ElemType {
+	case FuncRef:
+	case ExternRef:
+		reader.requireFeature(reader.opts.Features.ReferenceTypes, "reference-types")
+	default:
 		panic(fmt.Errorf("invalid elemtype: %d", tt.ElemType))
 	}
 
@@ -494,7 +869,13 @@ func (reader *wasmReader) readLimits() Limits {
 
 // 索引
 func (reader *wasmReader) readIndices() []uint32 {
-	vec := make([]uint32, reader.readVarU32())
+	n := reader.readVarU32()
+	var vec []uint32
+	if reader.arena != nil {
+		vec = reader.arena.indices.alloc(int(n))
+	} else {
+		vec = make([]uint32, n)
+	}
 	for i := range vec {
 		vec[i] = reader.readVarU32()
 	}
@@ -503,9 +884,337 @@ func (reader *wasmReader) readIndices() []uint32 {
 }
 
 // 表达式 和 指令
-func (reader *wasmReader) readExpr() Expr {
-	for reader.readByte() != 0x0B {
+// readExpr reads an expression. If offsets is not nil, the absolute offset
+// of each instruction is appended to it.
+func (reader *wasmReader) readExpr(offsets *[]int) Expr {
+	var expr Expr
+	if reader.arena != nil {
+		// 先读到复用的缓冲区里, 长度确定后再从 arena 中分配
+		expr = reader.arena.exprBuf[:0]
+	}
+	start := reader.offset()
+	reader.readInstructions(func(instr Instruction) {
+		expr = append(expr, instr)
+		if offsets != nil {
+			*offsets = append(*offsets, start)
+			start = reader.offset()
+		}
+	})
+	if reader.arena != nil {
+		reader.arena.exprBuf = expr
+		expr = Expr(reader.arena.instrs.alloc(len(expr)))
+		copy(expr, reader.arena.exprBuf)
+	}
 
+	return expr
+}
+
+// readInstructions reads the instructions of an expression up to and
+// including its final End
+func (reader *wasmReader) readInstructions(fn func(instr Instruction)) {
+	depth := 0
+	for {
+		instr := reader.readInstruction()
+		fn(instr)
+		switch instr.Opcode {
+		case Block, Loop, If:
+			depth++
+		case End:
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
+	}
+}
+
+// readConstExpr reads an initializer expression. Which instructions are
+// constant is left to validation, only the arithmetic of the
+// extended-const proposal is checked here.
+func (reader *wasmReader) readConstExpr() Expr {
+	expr := reader.readExpr(nil)
+	for _, instr := range expr {
+		switch instr.Opcode {
+		case I32Add, I32Sub, I32Mul, I64Add, I64Sub, I64Mul:
+			reader.requireFeature(reader.opts.Features.ExtendedConst, "extended-const")
+		}
+	}
+
+	return expr
+}
+
+func (reader *wasmReader) readInstruction() (instr Instruction) {
+	if reader.opts.RecordInstrBytes {
+		start := reader.data
+		defer func() {
+			n := len(start) - len(reader.data)
+			instr.Raw = start[:n:n]
+		}()
+	}
+
+	instr.Opcode = reader.readByte()
+	if instr.Opcode == PrefixMisc {
+		instr.SubOpcode = reader.readVarU32()
+		instr.Args = reader.readMiscArgs(instr.SubOpcode)
+	} else if instr.Opcode == PrefixSIMD {
+		reader.requireFeature(reader.opts.Features.SIMD, "simd")
+		instr.SubOpcode = reader.readVarU32()
+		instr.Args = reader.readSIMDArgs(instr.SubOpcode)
+	} else if instr.Opcode == PrefixAtomic {
+		reader.requireFeature(reader.opts.Features.Threads, "threads")
+		instr.SubOpcode = reader.readVarU32()
+		instr.Args = reader.readAtomicArgs(instr.SubOpcode)
+	} else {
+		instr.Args = reader.readArgs(instr.Opcode)
+	}
+
+	return
+}
+
+func (reader *wasmReader) readArgs(opcode byte) interface{} {
+	switch opcode {
+	case Block, Loop, If:
+		return reader.readBlockType()
+	case Br, BrIf:
+		return reader.readVarU32()
+	case BrTable:
+		return BrTableArgs{
+			Labels:  reader.readIndices(),
+			Default: reader.readVarU32(),
+		}
+	case Call:
+		return reader.readVarU32()
+	case CallIndirect:
+		args := CallIndirectArgs{
+			Type:  reader.readVarU32(),
+			Table: reader.readVarU32(),
+		}
+		if args.Table != 0 {
+			reader.requireFeature(reader.opts.Features.ReferenceTypes, "reference-types")
+		}
+		return args
+	case SelectT:
+		reader.requireFeature(reader.opts.Features.ReferenceTypes, "reference-types")
+		return reader.readValTypes()
+	case LocalGet, LocalSet, LocalTee, GlobalGet, GlobalSet:
+		return reader.readVarU32()
+	case TableGet, TableSet:
+		reader.requireFeature(reader.opts.Features.ReferenceTypes, "reference-types")
+		return reader.readVarU32()
+	case MemorySize, MemoryGrow:
+		return reader.readZero()
+	case I32Const:
+		return reader.readVarS32()
+	case I64Const:
+		return reader.readVarS64()
+	case F32Const:
+		return reader.readF32()
+	case F64Const:
+		return reader.readF64()
+	case RefNull:
+		reader.requireFeature(reader.opts.Features.ReferenceTypes, "reference-types")
+		return reader.readRefType()
+	case RefFunc:
+		reader.requireFeature(reader.opts.Features.ReferenceTypes, "reference-types")
+		return reader.readVarU32()
+	case RefIsNull:
+		reader.requireFeature(reader.opts.Features.ReferenceTypes, "reference-types")
+		return nil
+	case Unreachable, Nop, Else, End, Return, Drop, Select:
+		return nil
+	}
+
+	switch {
+	case opcode >= I32Load && opcode <= I64Store32:
+		return reader.readMemArg()
+	case opcode >= I32Eqz && opcode <= F64ReinterpretI64:
+		return nil
+	case opcode >= I32Extend8S && opcode <= I64Extend32S:
+		reader.requireFeature(reader.opts.Features.SignExtension, "sign-extension")
+		return nil
+	}
+
+	panic(fmt.Errorf("illegal opcode: 0x%02x", opcode))
+}
+
+func (reader *wasmReader) readMiscArgs(subOpcode uint32) interface{} {
+	switch subOpcode {
+	case I32TruncSatF32S, I32TruncSatF32U, I32TruncSatF64S, I32TruncSatF64U,
+		I64TruncSatF32S, I64TruncSatF32U, I64TruncSatF64S, I64TruncSatF64U:
+		reader.requireFeature(reader.opts.Features.SatConversion, "sat-conversion")
+		return nil
+	case TableGrow, TableSize, TableFill:
+		reader.requireFeature(reader.opts.Features.ReferenceTypes, "reference-types")
+		return reader.readVarU32()
+	}
+
+	reader.requireFeature(reader.opts.Features.BulkMemory, "bulk-memory")
+	switch subOpcode {
+	case MemoryInit:
+		dataIdx := reader.readDataIdx()
+		reader.readZero()
+		return dataIdx
+	case DataDrop:
+		return reader.readDataIdx()
+	case MemoryCopy:
+		reader.readZero()
+		reader.readZero()
+		return nil
+	case MemoryFill:
+		reader.readZero()
+		return nil
+	case TableInit:
+		return TableInitArgs{
+			Elem:  reader.readVarU32(),
+			Table: reader.readVarU32(),
+		}
+	case ElemDrop:
+		return reader.readVarU32()
+	case TableCopy:
+		return TableCopyArgs{
+			Dst: reader.readVarU32(),
+			Src: reader.readVarU32(),
+		}
+	}
+
+	panic(fmt.Errorf("illegal opcode: 0x%02x 0x%02x", PrefixMisc, subOpcode))
+}
+
+func (reader *wasmReader) readSIMDArgs(subOpcode uint32) interface{} {
+	switch {
+	case subOpcode <= V128Store, subOpcode == V128Load32Zero, subOpcode == V128Load64Zero:
+		return reader.readMemArg()
+	case subOpcode == V128Const:
+		return V128(reader.readBytes16())
+	case subOpcode == I8x16Shuffle:
+		lanes := ShuffleArgs(reader.readBytes16())
+		for _, lane := range lanes {
+			if lane >= 32 {
+				panic(fmt.Errorf("invalid lane index %d for i8x16.shuffle", lane))
+			}
+		}
+		return lanes
+	case subOpcode >= I8x16ExtractLaneS && subOpcode <= F64x2ReplaceLane:
+		return reader.readLaneIdx(subOpcode)
+	case subOpcode >= V128Load8Lane && subOpcode <= V128Store64Lane:
+		return MemLaneArgs{
+			MemArg: reader.readMemArg(),
+			Lane:   reader.readLaneIdx(subOpcode),
+		}
+	}
+
+	if _, ok := simdOpnames[subOpcode]; !ok {
+		panic(fmt.Errorf("illegal opcode: 0x%02x 0x%02x", PrefixSIMD, subOpcode))
 	}
 	return nil
 }
+
+// readAtomicArgs reads the immediate of an atomic instruction. Unlike
+// other loads and stores, the alignment must be exactly natural.
+func (reader *wasmReader) readAtomicArgs(subOpcode uint32) interface{} {
+	if _, ok := atomicOpnames[subOpcode]; !ok {
+		panic(fmt.Errorf("illegal opcode: 0x%02x 0x%02x", PrefixAtomic, subOpcode))
+	}
+	if subOpcode == AtomicFence {
+		return reader.readZero()
+	}
+
+	memArg := reader.readMemArg()
+	if err := checkAtomicAlign(subOpcode, memArg); err != nil {
+		panic(err)
+	}
+	return memArg
+}
+
+// readLaneIdx reads the lane index of a *_lane instruction, which must be
+// below the lane count of the instruction's shape
+func (reader *wasmReader) readLaneIdx(subOpcode uint32) LaneIdx {
+	var lanes byte
+	switch subOpcode {
+	case I8x16ExtractLaneS, I8x16ExtractLaneU, I8x16ReplaceLane,
+		V128Load8Lane, V128Store8Lane:
+		lanes = 16
+	case I16x8ExtractLaneS, I16x8ExtractLaneU, I16x8ReplaceLane,
+		V128Load16Lane, V128Store16Lane:
+		lanes = 8
+	case I32x4ExtractLane, I32x4ReplaceLane, F32x4ExtractLane, F32x4ReplaceLane,
+		V128Load32Lane, V128Store32Lane:
+		lanes = 4
+	default:
+		lanes = 2
+	}
+
+	lane := reader.readByte()
+	if lane >= lanes {
+		panic(fmt.Errorf("invalid lane index %d for %s",
+			lane, simdOpnames[subOpcode]))
+	}
+	return lane
+}
+
+func (reader *wasmReader) readBytes16() (b [16]byte) {
+	if len(reader.data) < 16 {
+		panic(errUnexpectedEnd)
+	}
+	copy(b[:], reader.data)
+	reader.data = reader.data[16:]
+	return
+}
+
+// memory.init 和 data.drop 引用的数据段索引只能根据 DataCount 段检查,
+// 因为解码代码段时数据段还没有出现
+func (reader *wasmReader) readDataIdx() DataIdx {
+	idx := reader.readVarU32()
+	if reader.dataCount == nil {
+		panic(errors.New("data count section required"))
+	}
+	if idx >= *reader.dataCount {
+		panic(fmt.Errorf("unknown data segment %d (data count: %d)",
+			idx, *reader.dataCount))
+	}
+
+	return idx
+}
+
+func (reader *wasmReader) readBlockType() BlockType {
+	n, w := decodeVarInt(reader.data, 33)
+	reader.data = reader.data[w:]
+
+	bt := BlockType(n)
+	if vt, ok := bt.ValType(); ok {
+		reader.checkValType(vt, "block type")
+	} else if bt >= 0 {
+		reader.requireFeature(reader.opts.Features.MultiValue, "multi-value")
+	} else if bt != BlockTypeEmpty {
+		panic(fmt.Errorf("malformed block type: %d", bt))
+	}
+
+	return bt
+}
+
+func (reader *wasmReader) readMemArg() MemArg {
+	return MemArg{
+		Align:  reader.readVarU32(),
+		Offset: reader.readVarU32(),
+	}
+}
+
+func (reader *wasmReader) readZero() byte {
+	b := reader.readByte()
+	if b != 0 {
+		panic(fmt.Errorf("zero byte expected, got: %d", b))
+	}
+
+	return b
+}
+
+func (reader *wasmReader) readRefType() byte {
+	rt := reader.readByte()
+	switch rt {
+	case FuncRef, ExternRef:
+	default:
+		panic(fmt.Errorf("malformed reference type: %d", rt))
+	}
+
+	return rt
+}
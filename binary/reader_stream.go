@@ -0,0 +1,107 @@
+package binary
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// streamReader feeds a wasmReader from an io.Reader one section at a
+// time. offset counts the bytes read so far, it is the absolute offset of
+// the end of the data the wasmReader holds.
+type streamReader struct {
+	r      *bufio.Reader
+	offset int
+}
+
+func DecodeReaderWithOptions(r io.Reader, opts DecodeOptions) (Module, error) {
+	stream := &streamReader{r: bufio.NewReader(r)}
+	reader := &wasmReader{
+		opts:   opts,
+		stream: stream,
+	}
+	// 先只读取魔数和版本号, 段在 forEachSection 中逐个读取
+	reader.data = stream.readN(8)
+	reader.end = stream.offset
+	return reader.decode()
+}
+
+// nextSection reports whether there is a section left to read. Reading
+// from a stream, the next section is read in first once the data of the
+// previous one is consumed.
+func (reader *wasmReader) nextSection() bool {
+	if reader.stream != nil && reader.remaining() == 0 {
+		reader.data = reader.stream.readSection()
+		reader.end = reader.stream.offset
+	}
+	return reader.remaining() > 0
+}
+
+// readTrailing returns the data left after the last section, the rest of
+// the stream included
+func (reader *wasmReader) readTrailing() []byte {
+	if reader.stream == nil {
+		return reader.data
+	}
+	rest := reader.stream.readN(-1)
+	reader.end = reader.stream.offset
+	return append(reader.data, rest...)
+}
+
+// readSection reads the id, size and content of the next section, nil at
+// the end of the stream. A malformed size or a truncated content is not
+// reported here: what could be read is returned for the wasmReader to
+// fail on at the right offset.
+func (s *streamReader) readSection() []byte {
+	var buf bytes.Buffer
+	id, err := s.r.ReadByte()
+	if err == io.EOF {
+		return nil
+	}
+	s.check(err)
+	buf.WriteByte(id)
+
+	size := uint64(0)
+	for i := 0; i < 5; i++ {
+		b, err := s.r.ReadByte()
+		if err == io.EOF {
+			return s.consumed(&buf)
+		}
+		s.check(err)
+		buf.WriteByte(b)
+		size |= uint64(b&0x7f) << (i * 7)
+		if b&0x80 == 0 {
+			// 按实际读到的字节增长缓冲区, 而不是按声明的大小预先分配
+			_, err = buf.ReadFrom(io.LimitReader(s.r, int64(size)))
+			s.check(err)
+			break
+		}
+	}
+	return s.consumed(&buf)
+}
+
+// readN reads n bytes, fewer at the end of the stream, or all the bytes
+// left if n is negative
+func (s *streamReader) readN(n int64) []byte {
+	var r io.Reader = s.r
+	if n >= 0 {
+		r = io.LimitReader(s.r, n)
+	}
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(r)
+	s.check(err)
+	return s.consumed(&buf)
+}
+
+func (s *streamReader) consumed(buf *bytes.Buffer) []byte {
+	s.offset += buf.Len()
+	return buf.Bytes()
+}
+
+// check panics with read errors other than the end of the stream
+func (s *streamReader) check(err error) {
+	if err != nil && !errors.Is(err, io.EOF) {
+		panic(err)
+	}
+}
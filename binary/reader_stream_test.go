@@ -0,0 +1,112 @@
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecodeReader(t *testing.T) {
+	opts := DefaultDecodeOptions()
+	opts.RecordCodeOffsets = true
+	opts.RecordInstrBytes = true
+	opts.KeepRawSections = true
+	for _, name := range []string{"ch01_hw.wasm", "hw_rust.wasm"} {
+		data := readTestdata(t, name)
+		want, err := DecodeWithOptions(data, opts)
+		if err != nil {
+			t.Fatalf("%s: Decode: %v", name, err)
+		}
+		// one byte at a time, no read returns more than asked
+		m, err := DecodeReaderWithOptions(iotest.OneByteReader(bytes.NewReader(data)), opts)
+		if err != nil {
+			t.Fatalf("%s: DecodeReader: %v", name, err)
+		}
+		if !reflect.DeepEqual(m, want) {
+			t.Fatalf("%s: got a different module than Decode", name)
+		}
+	}
+}
+
+// TestDecodeReaderErrors checks that DecodeReader fails where Decode
+// does, with the same offset
+func TestDecodeReaderErrors(t *testing.T) {
+	types := sec(SecTypeID, 1, FtTag, 0, 0)
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{nil, "unexpected end of magic header"},
+		{[]byte{0x00, 0x61, 0x73}, "unexpected end of magic header"},
+		{[]byte{0x00, 0x61, 0x73, 0x6D, 0x01}, "unexpected end of binary version"},
+		{wasm(sec(13)), "malformed section id: 13"},
+		{wasm(types, types), "duplicate section id 1"},
+		{wasm(types, []byte{SecFuncID}), "unexpected end"},
+		{wasm(sec(SecTypeID, 1, FtTag, 0, 0, 0), types), "section size mismatch, id: 1"},
+		{wasm(types, []byte{SecFuncID, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}), "integer too large"},
+		{wasm(types, []byte{SecFuncID, 0xFF, 0xFF, 0xFF, 0xFF, 0x0F, 1}), "unexpected end"},
+		{wasm(types, []byte{SecFuncID, 0x80, 0x80}), "unexpected end"},
+		{wasm(types, []byte{0xFF}), "malformed section id: 255"},
+	}
+	for _, tt := range tests {
+		_, want := Decode(tt.data)
+		wantError(t, want, tt.want)
+		_, err := DecodeReader(bytes.NewReader(tt.data))
+		if err == nil || err.Error() != want.Error() {
+			t.Fatalf("got error %v, want %v", err, want)
+		}
+	}
+}
+
+// TestDecodeReaderStops checks that the stream is not read past the
+// section at fault, and that a huge declared section size is not
+// allocated up front
+func TestDecodeReaderStops(t *testing.T) {
+	errRead := errors.New("read past the malformed section")
+	bad := wasm(sec(SecTypeID, 1, FtTag, 0, 0), sec(13))
+	_, err := DecodeReader(io.MultiReader(bytes.NewReader(bad), iotest.ErrReader(errRead)))
+	wantError(t, err, "malformed section id: 13")
+
+	allocs := testing.AllocsPerRun(1, func() {
+		_, err := DecodeReader(bytes.NewReader(wasm([]byte{SecCustomID, 0xFF, 0xFF, 0xFF, 0xFF, 0x0F, 1, 'a'})))
+		wantError(t, err, "unexpected end")
+	})
+	if allocs > 100 {
+		t.Fatalf("got %v allocations, want a cheap failure", allocs)
+	}
+
+	// other read errors are returned, wrapped in a *DecodeError
+	good := wasm(sec(SecTypeID, 1, FtTag, 0, 0))
+	_, err = DecodeReader(io.MultiReader(bytes.NewReader(good), iotest.ErrReader(errRead)))
+	if !errors.Is(err, errRead) {
+		t.Fatalf("got error %v, want %v", err, errRead)
+	}
+}
+
+func TestDecodeReaderTrailing(t *testing.T) {
+	opts := DefaultDecodeOptions()
+	opts.AllowTrailingBytes = true
+	types := sec(SecTypeID, 1, FtTag, 0, 0)
+	for _, trailing := range [][]byte{
+		{0xFF, 1, 2, 3},
+		{SecFuncID, 10, 0},       // truncated
+		append(types, 1, 2),      // duplicate
+		{SecCustomID, 2, 5, 'a'}, // the name does not fit
+	} {
+		data := append(wasm(types), trailing...)
+		want, err := DecodeWithOptions(data, opts)
+		if err != nil {
+			t.Fatalf("%x: Decode: %v", trailing, err)
+		}
+		m, err := DecodeReaderWithOptions(iotest.HalfReader(bytes.NewReader(data)), opts)
+		if err != nil {
+			t.Fatalf("%x: DecodeReader: %v", trailing, err)
+		}
+		if !reflect.DeepEqual(m, want) || !bytes.Equal(m.Trailing, trailing) {
+			t.Fatalf("got trailing bytes %x, want %x", m.Trailing, trailing)
+		}
+	}
+}
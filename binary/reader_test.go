@@ -0,0 +1,590 @@
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// wasm returns a module made of the given sections, see sec
+func wasm(secs ...[]byte) []byte {
+	data := []byte{0x00, 0x61, 0x73, 0x6D, 0x01, 0x00, 0x00, 0x00}
+	for _, s := range secs {
+		data = append(data, s...)
+	}
+	return data
+}
+
+// sec returns section id with the given content, size included
+func sec(id byte, content ...byte) []byte {
+	s := append([]byte{id}, encodeVarUint(uint64(len(content)))...)
+	return append(s, content...)
+}
+
+// voidFunc is the type, function and code sections of one function of
+// type [] -> [] with the given body, end included
+func voidFunc(body ...byte) [][]byte {
+	code := append([]byte{0}, body...) // no locals
+	entry := append(encodeVarUint(uint64(len(code))), code...)
+	return [][]byte{
+		sec(SecTypeID, 1, FtTag, 0, 0),
+		sec(SecFuncID, 1, 0),
+		sec(SecCodeID, append([]byte{1}, entry...)...),
+	}
+}
+
+// decodeBody decodes the body of a voidFunc, a memory is added for the
+// instructions accessing it
+func decodeBody(body ...byte) (Expr, error) {
+	secs := voidFunc(body...)
+	m, err := Decode(wasm(secs[0], secs[1], sec(SecMemID, 1, 0, 1), secs[2]))
+	if err != nil {
+		return nil, err
+	}
+	return m.CodeSec[0].Expr, nil
+}
+
+func mustDecodeBody(t *testing.T, body ...byte) Expr {
+	t.Helper()
+	expr, err := decodeBody(body...)
+	if err != nil {
+		t.Fatalf("decoding %x: %v", body, err)
+	}
+	return expr
+}
+
+func mustDecode(t *testing.T, data []byte) Module {
+	t.Helper()
+	m, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	return m
+}
+
+func TestDecodeStartSection(t *testing.T) {
+	secs := voidFunc(End)
+	withStart := wasm(secs[0], secs[1], sec(SecStartID, 0), secs[2])
+	m := mustDecode(t, withStart)
+	if m.StartSec == nil || *m.StartSec != 0 {
+		t.Fatalf("got start %v, want function 0", m.StartSec)
+	}
+	m = mustDecode(t, wasm(secs...))
+	if m.StartSec != nil {
+		t.Fatalf("got start %d, want none", *m.StartSec)
+	}
+}
+
+func TestDecodeMVPOnly(t *testing.T) {
+	mvp := DefaultDecodeOptions()
+	mvp.Features = Features{}
+	tests := []struct {
+		name    string
+		data    []byte
+		feature string
+	}{
+		{"externref table", wasm(sec(SecTableID, 1, ExternRef, 0, 1)), "reference-types"},
+		{"ref.null", wasm(voidFunc(RefNull, FuncRef, Drop, End)...), "reference-types"},
+		{"v128.const", wasm(voidFunc(PrefixSIMD, V128Const, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, Drop, End)...), "simd"},
+		{"data count", wasm(sec(SecDataCountID, 0)), "bulk-memory"},
+	}
+	for _, tt := range tests {
+		if _, err := Decode(tt.data); err != nil {
+			t.Errorf("%s: got error %v with all features, want none", tt.name, err)
+		}
+		_, err := DecodeWithOptions(tt.data, mvp)
+		want := "feature " + tt.feature + " not enabled"
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, want)
+		}
+	}
+}
+
+func TestDecodeSectionOrder(t *testing.T) {
+	types := sec(SecTypeID, 0)
+	funcs := sec(SecFuncID, 0)
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"duplicate", wasm(types, types), "duplicate section id 1"},
+		{"duplicate apart", wasm(types, funcs, types), "duplicate section id 1"},
+		{"out of order", wasm(funcs, types), "section 1 out of order (after 3)"},
+		{"data count after code", wasm(sec(SecCodeID, 0), sec(SecDataCountID, 0)), "section 12 out of order (after 10)"},
+		{"unknown id", wasm(sec(13)), "malformed section id: 13"},
+	}
+	for _, tt := range tests {
+		_, err := Decode(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := Decode(wasm(types, sec(SecCustomID, 1, 'a'), funcs, sec(SecCustomID, 1, 'a'))); err != nil {
+		t.Errorf("repeated custom sections: got error %v, want none", err)
+	}
+}
+
+func TestDecodeSIMDImmediates(t *testing.T) {
+	var lanes [16]byte
+	for i := range lanes {
+		lanes[i] = byte(31 - i)
+	}
+	v := append([]byte{PrefixSIMD, V128Const}, lanes[:]...)
+	shuffle := append(append(append(v, v...), PrefixSIMD, I8x16Shuffle), lanes[:]...)
+	expr := mustDecodeBody(t, append(shuffle, Drop, End)...)
+	if got := expr[0].Args; got != V128(lanes) {
+		t.Errorf("v128.const: got %v, want %v", got, V128(lanes))
+	}
+	if got := expr[2].Args; got != ShuffleArgs(lanes) {
+		t.Errorf("i8x16.shuffle: got %v, want %v", got, ShuffleArgs(lanes))
+	}
+	lanes[15] = 32
+	_, err := decodeBody(append(append(append(v, v...), PrefixSIMD, I8x16Shuffle), lanes[:]...)...)
+	wantError(t, err, "invalid lane index 32 for i8x16.shuffle")
+
+	laneOps := []struct {
+		sub   byte
+		lanes byte
+		mem   bool
+	}{
+		{I8x16ExtractLaneS, 16, false},
+		{I8x16ReplaceLane, 16, false},
+		{I16x8ExtractLaneU, 8, false},
+		{I32x4ReplaceLane, 4, false},
+		{I64x2ExtractLane, 2, false},
+		{F32x4ExtractLane, 4, false},
+		{F64x2ReplaceLane, 2, false},
+		{V128Load8Lane, 16, true},
+		{V128Load16Lane, 8, true},
+		{V128Store32Lane, 4, true},
+		{V128Store64Lane, 2, true},
+	}
+	for _, op := range laneOps {
+		imm := func(lane byte) []byte {
+			if op.mem {
+				return []byte{PrefixSIMD, op.sub, 0, 16, lane, Unreachable, End}
+			}
+			return []byte{PrefixSIMD, op.sub, lane, Unreachable, End}
+		}
+		name := simdOpnames[uint32(op.sub)]
+		expr := mustDecodeBody(t, imm(op.lanes-1)...)
+		var got LaneIdx
+		if op.mem {
+			args := expr[0].Args.(MemLaneArgs)
+			if args.MemArg != (MemArg{Offset: 16}) {
+				t.Errorf("%s: got memarg %+v, want offset 16", name, args.MemArg)
+			}
+			got = args.Lane
+		} else {
+			got = expr[0].Args.(LaneIdx)
+		}
+		if got != op.lanes-1 {
+			t.Errorf("%s: got lane %d, want %d", name, got, op.lanes-1)
+		}
+		_, err := decodeBody(imm(op.lanes)...)
+		if err == nil || !strings.Contains(err.Error(), "invalid lane index") {
+			t.Errorf("%s lane %d: got error %v, want invalid lane index", name, op.lanes, err)
+		}
+	}
+}
+
+func TestDecodeIfElse(t *testing.T) {
+	expr := mustDecodeBody(t,
+		I32Const, 1, If, 0x40,
+		Nop,
+		Else,
+		I32Const, 0, If, 0x7F, I32Const, 2, Else, I32Const, 3, End, Drop,
+		End,
+		End)
+	want := []byte{I32Const, If, Nop, Else, I32Const, If, I32Const, Else, I32Const, End, Drop, End, End}
+	if len(expr) != len(want) {
+		t.Fatalf("got %d instructions, want %d", len(expr), len(want))
+	}
+	for i, instr := range expr {
+		if instr.Opcode != want[i] {
+			t.Fatalf("instruction %d: got %s, want opcode 0x%02x", i, instr.GetOpname(), want[i])
+		}
+	}
+	if expr[1].Args != BlockTypeEmpty || expr[5].Args != BlockTypeI32 {
+		t.Errorf("got block types %v and %v, want empty and i32", expr[1].Args, expr[5].Args)
+	}
+}
+
+func TestDecodeFuncCodeMismatch(t *testing.T) {
+	types := sec(SecTypeID, 1, FtTag, 0, 0)
+	imports := sec(SecImportID, 1, 1, 'm', 1, 'f', ImportTagFunc, 0)
+	body := []byte{2, 0, End}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{
+			"missing body",
+			wasm(types, imports, sec(SecFuncID, 2, 0, 0), sec(SecCodeID, append([]byte{1}, body...)...)),
+			"2 functions, 1 bodies; function 2 has no body",
+		},
+		{
+			"missing function",
+			wasm(types, sec(SecFuncID, 1, 0), sec(SecCodeID, append(append([]byte{2}, body...), body...)...)),
+			"1 functions, 2 bodies; body 1 has no function declaration",
+		},
+		{
+			"no code section",
+			wasm(types, sec(SecFuncID, 1, 0)),
+			"1 functions, 0 bodies; function 0 has no body",
+		},
+	}
+	for _, tt := range tests {
+		_, err := Decode(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeMemTypeBoundary(t *testing.T) {
+	// 65536 and 65537 as LEB128
+	maxPages := []byte{0x80, 0x80, 0x04}
+	overMax := []byte{0x81, 0x80, 0x04}
+	limits := func(tag byte, sizes ...[]byte) []byte {
+		b := []byte{tag}
+		for _, size := range sizes {
+			b = append(b, size...)
+		}
+		return b
+	}
+	tests := []struct {
+		name   string
+		limits []byte
+		ok     bool
+	}{
+		{"min 4GiB", limits(0, maxPages), true},
+		{"max 4GiB", limits(1, []byte{0}, maxPages), true},
+		{"min and max 4GiB", limits(1, maxPages, maxPages), true},
+		{"min over 4GiB", limits(0, overMax), false},
+		{"max over 4GiB", limits(1, []byte{0}, overMax), false},
+	}
+	for _, tt := range tests {
+		mem := sec(SecMemID, append([]byte{1}, tt.limits...)...)
+		imp := sec(SecImportID, append([]byte{1, 1, 'm', 1, 'm', ImportTagMem}, tt.limits...)...)
+		for _, data := range [][]byte{wasm(mem), wasm(imp)} {
+			_, err := Decode(data)
+			if tt.ok && err != nil {
+				t.Fatalf("%s: got error %v, want none", tt.name, err)
+			}
+			if !tt.ok {
+				wantError(t, err, "memory size must be at most 65536 pages")
+			}
+		}
+	}
+}
+
+func TestDecodeInstrOffsets(t *testing.T) {
+	data := wasm(voidFunc(Block, 0x40, I32Const, 0x80, 0x01, Drop, End, Nop, End)...)
+	opts := DefaultDecodeOptions()
+	opts.RecordCodeOffsets = true
+	opts.RecordInstrBytes = true
+	m, err := DecodeWithOptions(data, opts)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	code := m.CodeSec[0]
+	if len(code.InstrOffsets) != len(code.Expr) {
+		t.Fatalf("got %d offsets, want one per instruction, %d", len(code.InstrOffsets), len(code.Expr))
+	}
+	for i, instr := range code.Expr {
+		offset := code.InstrOffsets[i]
+		if got := data[offset : offset+len(instr.Raw)]; !bytes.Equal(got, instr.Raw) {
+			t.Fatalf("instruction %d: got %x at offset %d, want %x", i, got, offset, instr.Raw)
+		}
+	}
+	if last := code.InstrOffsets[len(code.InstrOffsets)-1]; last != code.End-1 {
+		t.Fatalf("got final end at offset %d, want %d", last, code.End-1)
+	}
+
+	if m = mustDecode(t, data); m.CodeSec[0].InstrOffsets != nil {
+		t.Fatalf("got offsets %v without RecordCodeOffsets, want none", m.CodeSec[0].InstrOffsets)
+	}
+}
+
+func TestDecodeMaxFuncBodyBytes(t *testing.T) {
+	// the body of the second function is 4 bytes: no locals, nop, nop, end
+	secs := voidFunc(Nop, End)
+	data := wasm(secs[0], sec(SecFuncID, 2, 0, 0), sec(SecCodeID, 2, 2, 0, End, 4, 0, Nop, Nop, End))
+	for _, max := range []int{0, 4, 5} {
+		opts := DefaultDecodeOptions()
+		opts.MaxFuncBodyBytes = max
+		if _, err := DecodeWithOptions(data, opts); err != nil {
+			t.Fatalf("limit %d: got error %v, want none", max, err)
+		}
+	}
+
+	opts := DefaultDecodeOptions()
+	opts.MaxFuncBodyBytes = 3
+	_, err := DecodeWithOptions(data, opts)
+	var tooLarge *FuncBodyTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("got error %v, want a *FuncBodyTooLargeError", err)
+	}
+	if want := (FuncBodyTooLargeError{Index: 1, Size: 4, Max: 3}); *tooLarge != want {
+		t.Fatalf("got %+v, want %+v", *tooLarge, want)
+	}
+}
+
+// TestDecodeMaxLocals checks that the local count is bounded by MaxLocals,
+// summed over the local declarations of a body, before anything is
+// allocated for it
+func TestDecodeMaxLocals(t *testing.T) {
+	// locals returns a module of one function declaring n i32 locals in
+	// each of the given groups
+	locals := func(ns ...uint64) []byte {
+		code := encodeVarUint(uint64(len(ns)))
+		for _, n := range ns {
+			code = append(append(code, encodeVarUint(n)...), ValTypeI32)
+		}
+		code = append(code, End)
+		entry := append(encodeVarUint(uint64(len(code))), code...)
+		secs := voidFunc(End)
+		return wasm(secs[0], secs[1], sec(SecCodeID, append([]byte{1}, entry...)...))
+	}
+
+	m := mustDecode(t, locals(MaxLocals-1, 1))
+	if n := len(m.CodeSec[0].ExpandedLocals()); n != MaxLocals {
+		t.Fatalf("got %d locals, want %d", n, MaxLocals)
+	}
+
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{locals(MaxLocals + 1), "too many locals: 50001"},
+		{locals(MaxLocals, 1), "too many locals: 50001"},
+		{locals(500000000), "too many locals: 500000000"},
+		{locals(math.MaxUint32, math.MaxUint32), "too many locals: 8589934590"},
+	}
+	for _, tt := range tests {
+		allocs := testing.AllocsPerRun(1, func() {
+			_, err := Decode(tt.data)
+			wantError(t, err, tt.want)
+		})
+		if allocs > 100 {
+			t.Fatalf("%s: got %v allocations, want a cheap failure", tt.want, allocs)
+		}
+		wantError(t, DecodeStream(tt.data, BaseHandler{}), tt.want)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("got no panic expanding %d locals, want one", MaxLocals+1)
+		}
+	}()
+	Code{Locals: []Locals{{N: MaxLocals + 1, Type: ValTypeI32}}}.ExpandedLocals()
+}
+
+func TestDecodeCountLimits(t *testing.T) {
+	types := sec(SecTypeID, 1, FtTag, 0, 0)
+	tests := []struct {
+		what  string
+		data  []byte
+		limit func(opts *DecodeOptions, max int)
+	}{
+		{
+			"imports",
+			wasm(types, sec(SecImportID, 2, 1, 'm', 1, 'a', ImportTagFunc, 0, 1, 'm', 1, 'b', ImportTagFunc, 0)),
+			func(opts *DecodeOptions, max int) { opts.MaxImports = max },
+		},
+		{
+			"globals",
+			wasm(sec(SecGlobalID, 2, ValTypeI32, 0, I32Const, 0, End, ValTypeI32, 0, I32Const, 0, End)),
+			func(opts *DecodeOptions, max int) { opts.MaxGlobals = max },
+		},
+		{
+			"element segments",
+			wasm(sec(SecElemID, 2, 1, 0, 0, 1, 0, 0)),
+			func(opts *DecodeOptions, max int) { opts.MaxElemSegments = max },
+		},
+		{
+			"data segments",
+			wasm(sec(SecDataID, 2, 1, 0, 1, 0)),
+			func(opts *DecodeOptions, max int) { opts.MaxDataSegments = max },
+		},
+	}
+	for _, tt := range tests {
+		for _, max := range []int{0, 2} {
+			opts := DefaultDecodeOptions()
+			tt.limit(&opts, max)
+			if _, err := DecodeWithOptions(tt.data, opts); err != nil {
+				t.Fatalf("%s: limit %d: got error %v, want none", tt.what, max, err)
+			}
+		}
+
+		opts := DefaultDecodeOptions()
+		tt.limit(&opts, 1)
+		_, err := DecodeWithOptions(tt.data, opts)
+		var tooMany *CountLimitError
+		if !errors.As(err, &tooMany) {
+			t.Fatalf("%s: got error %v, want a *CountLimitError", tt.what, err)
+		}
+		if want := (CountLimitError{What: tt.what, Count: 2, Max: 1}); *tooMany != want {
+			t.Fatalf("got %+v, want %+v", *tooMany, want)
+		}
+	}
+}
+
+// TestDecodeNestedExpr checks that readExpr stops at the end matching
+// the start of the expression, not at the first end, for function bodies
+// and constant expressions alike
+func TestDecodeNestedExpr(t *testing.T) {
+	body := mustDecodeBody(t, Block, 0x40, Loop, 0x40, I32Const, 1, If, 0x40, Nop, Else, End, End, End, End)
+	want := Expr{
+		{Opcode: Block, Args: BlockTypeEmpty},
+		{Opcode: Loop, Args: BlockTypeEmpty},
+		{Opcode: I32Const, Args: int32(1)},
+		{Opcode: If, Args: BlockTypeEmpty},
+		{Opcode: Nop},
+		{Opcode: Else},
+		{Opcode: End},
+		{Opcode: End},
+		{Opcode: End},
+		{Opcode: End},
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Fatalf("got %v, want %v", body, want)
+	}
+
+	// a global, an active element segment and an active data segment,
+	// each followed by another entry to check where the expression ended
+	m := mustDecode(t, wasm(
+		sec(SecTableID, 1, FuncRef, 0, 1),
+		sec(SecMemID, 1, 0, 1),
+		sec(SecGlobalID, 2, ValTypeI32, 0, I32Const, 42, End, ValTypeI64, 0, I64Const, 0x7F, End),
+		sec(SecElemID, 2, 0, I32Const, 1, End, 0, 0, I32Const, 2, End, 0),
+		sec(SecDataID, 2, 0, I32Const, 3, End, 1, 'a', 0, I32Const, 4, End, 0)))
+	exprs := []struct {
+		got  Expr
+		want Instruction
+	}{
+		{m.GlobalSec[0].Init, Instruction{Opcode: I32Const, Args: int32(42)}},
+		{m.GlobalSec[1].Init, Instruction{Opcode: I64Const, Args: int64(-1)}},
+		{m.ElemSec[0].Offset, Instruction{Opcode: I32Const, Args: int32(1)}},
+		{m.ElemSec[1].Offset, Instruction{Opcode: I32Const, Args: int32(2)}},
+		{m.DataSec[0].Offset, Instruction{Opcode: I32Const, Args: int32(3)}},
+		{m.DataSec[1].Offset, Instruction{Opcode: I32Const, Args: int32(4)}},
+	}
+	for i, e := range exprs {
+		if want := (Expr{e.want, {Opcode: End}}); !reflect.DeepEqual(e.got, want) {
+			t.Fatalf("expression %d: got %v, want %v", i, e.got, want)
+		}
+	}
+}
+
+// elemModule returns a module of a function, n tables of elemType and
+// the element section content elems
+func elemModule(elemType byte, n int, elems ...byte) []byte {
+	tables := []byte{byte(n)}
+	for i := 0; i < n; i++ {
+		tables = append(tables, elemType, 0, 4)
+	}
+	secs := voidFunc(End)
+	return wasm(secs[0], secs[1], sec(SecTableID, tables...), sec(SecElemID, elems...), secs[2])
+}
+
+func TestDecodeElemFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		elems []byte
+		want  Elem
+	}{
+		{"0: active, function indices", []byte{1, 0, I32Const, 1, End, 1, 0},
+			Elem{Type: FuncRef, Offset: Expr{{Opcode: I32Const, Args: int32(1)}, {Opcode: End}}, Init: []FuncIdx{0}}},
+		{"1: passive, function indices", []byte{1, 1, 0, 2, 0, 0},
+			Elem{Mode: ElemModePassive, Type: FuncRef, Init: []FuncIdx{0, 0}}},
+		{"2: active with a table, function indices", []byte{1, 2, 1, I32Const, 0, End, 0, 1, 0},
+			Elem{Table: 1, Type: FuncRef, Offset: Expr{{Opcode: I32Const, Args: int32(0)}, {Opcode: End}}, Init: []FuncIdx{0}}},
+		{"3: declarative, function indices", []byte{1, 3, 0, 1, 0},
+			Elem{Mode: ElemModeDeclarative, Type: FuncRef, Init: []FuncIdx{0}}},
+		{"4: active, expressions", []byte{1, 4, I32Const, 0, End, 2, RefFunc, 0, End, RefNull, FuncRef, End},
+			Elem{Type: FuncRef, Offset: Expr{{Opcode: I32Const, Args: int32(0)}, {Opcode: End}}, Exprs: []Expr{
+				{{Opcode: RefFunc, Args: uint32(0)}, {Opcode: End}},
+				{{Opcode: RefNull, Args: byte(FuncRef)}, {Opcode: End}},
+			}}},
+		{"5: passive, expressions", []byte{1, 5, FuncRef, 1, RefFunc, 0, End},
+			Elem{Mode: ElemModePassive, Type: FuncRef, Exprs: []Expr{{{Opcode: RefFunc, Args: uint32(0)}, {Opcode: End}}}}},
+		{"6: active with a table, expressions", []byte{1, 6, 1, I32Const, 0, End, FuncRef, 1, RefFunc, 0, End},
+			Elem{Table: 1, Type: FuncRef, Offset: Expr{{Opcode: I32Const, Args: int32(0)}, {Opcode: End}},
+				Exprs: []Expr{{{Opcode: RefFunc, Args: uint32(0)}, {Opcode: End}}}}},
+		{"7: declarative, expressions", []byte{1, 7, FuncRef, 1, RefFunc, 0, End},
+			Elem{Mode: ElemModeDeclarative, Type: FuncRef, Exprs: []Expr{{{Opcode: RefFunc, Args: uint32(0)}, {Opcode: End}}}}},
+	}
+	for _, tt := range tests {
+		data := elemModule(FuncRef, 2, tt.elems...)
+		m := mustDecode(t, data)
+		if !reflect.DeepEqual(m.ElemSec[0], tt.want) {
+			t.Fatalf("flags %s: got %+v, want %+v", tt.name, m.ElemSec[0], tt.want)
+		}
+		if err := m.Validate(); err != nil {
+			t.Fatalf("flags %s: got error %v, want none", tt.name, err)
+		}
+		if encoded := mustEncode(t, m); !bytes.Equal(encoded, data) {
+			t.Fatalf("flags %s: encoded % x, want % x", tt.name, encoded, data)
+		}
+	}
+
+	errs := []struct {
+		name  string
+		elems []byte
+		err   string
+	}{
+		{"flags 8", []byte{1, 8, 0}, "invalid element segment flags: 8"},
+		{"element kind 1", []byte{1, 1, 1, 0}, "malformed element kind: 1"},
+	}
+	for _, tt := range errs {
+		_, err := Decode(elemModule(FuncRef, 1, tt.elems...))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	opts := DefaultDecodeOptions()
+	opts.Features = Features{}
+	_, err := DecodeWithOptions(elemModule(FuncRef, 1, 1, 1, 0, 0), opts)
+	wantError(t, err, "bulk-memory")
+}
+
+func TestDecodeDataFlags(t *testing.T) {
+	mem := sec(SecMemID, 1, 0, 1)
+	data := wasm(mem, sec(SecDataID, 3,
+		0, I32Const, 8, End, 2, 'h', 'i', // active
+		1, 3, 'a', 'b', 'c', // passive
+		2, 0, I32Const, 0, End, 0)) // active with a memory index
+	m := mustDecode(t, data)
+	offset := func(n int32) Expr { return Expr{{Opcode: I32Const, Args: n}, {Opcode: End}} }
+	want := []Data{
+		{Offset: offset(8), Init: []byte("hi")},
+		{Mode: DataModePassive, Init: []byte("abc")},
+		{Offset: offset(0), Init: []byte{}},
+	}
+	if !reflect.DeepEqual(m.DataSec, want) {
+		t.Fatalf("got %+v, want %+v", m.DataSec, want)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("got error %v, want none", err)
+	}
+	// flags 2 with memory 0 is written as flags 0
+	encoded := mustEncode(t, m)
+	if m2 := mustDecode(t, encoded); !reflect.DeepEqual(m2.DataSec, want) {
+		t.Fatalf("got %+v after encoding, want %+v", m2.DataSec, want)
+	}
+
+	_, err := Decode(wasm(mem, sec(SecDataID, 1, 3, 0)))
+	wantError(t, err, "invalid data segment flags: 3")
+	opts := DefaultDecodeOptions()
+	opts.Features = Features{}
+	_, err = DecodeWithOptions(wasm(mem, sec(SecDataID, 1, 1, 0)), opts)
+	wantError(t, err, "bulk-memory")
+}
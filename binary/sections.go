@@ -0,0 +1,74 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+)
+
+var secNames = [...]string{
+	SecCustomID:    "custom",
+	SecTypeID:      "type",
+	SecImportID:    "import",
+	SecFuncID:      "function",
+	SecTableID:     "table",
+	SecMemID:       "memory",
+	SecGlobalID:    "global",
+	SecExportID:    "export",
+	SecStartID:     "start",
+	SecElemID:      "element",
+	SecCodeID:      "code",
+	SecDataID:      "data",
+	SecDataCountID: "datacount",
+}
+
+func SecIDToName(secID byte) string {
+	if int(secID) < len(secNames) {
+		return secNames[secID]
+	}
+	return fmt.Sprintf("unknown(%d)", secID)
+}
+
+func SecNameToID(name string) (byte, bool) {
+	for id, secName := range secNames {
+		if secName == name {
+			return byte(id), true
+		}
+	}
+	return 0, false
+}
+
+// SectionRange is where a section lies in a module binary
+type SectionRange struct {
+	ID           byte
+	Start        int // offset of the section id
+	ContentStart int // offset of the content, after the size
+	End          int
+}
+
+// SectionRanges splits data into sections without decoding their
+// content, so it also works for modules that fail to decode.
+func SectionRanges(data []byte) (ranges []SectionRange, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	reader := &wasmReader{data: data, end: len(data)}
+	reader.readPreamble()
+	for reader.remaining() > 0 {
+		sr := SectionRange{Start: reader.offset()}
+		sr.ID = reader.readByte()
+		content := reader.readBytes()
+		sr.End = reader.offset()
+		sr.ContentStart = sr.End - len(content)
+		ranges = append(ranges, sr)
+	}
+
+	return ranges, nil
+}
@@ -0,0 +1,199 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Handler receives the parts of a module from DecodeStream in the order
+// they appear in the binary. Function bodies are delivered instruction by
+// instruction between OnCodeStart and OnCodeEnd, idx being the index in
+// the code section.
+type Handler interface {
+	OnCustomSec(sec CustomSec)
+	OnType(ft FuncType)
+	OnImport(imp Import)
+	OnFunc(typeIdx TypeIdx)
+	OnTable(tt TableType)
+	OnMem(mt MemType)
+	OnGlobal(g Global)
+	OnExport(exp Export)
+	OnStart(idx FuncIdx)
+	OnElem(elem Elem)
+	OnDataCount(n uint32)
+	OnCodeStart(idx int, locals []Locals)
+	OnInstruction(instr Instruction)
+	OnCodeEnd(idx int)
+	OnData(data Data)
+}
+
+// BaseHandler ignores every event, embed it to implement only the
+// methods of Handler that are needed.
+type BaseHandler struct{}
+
+func (BaseHandler) OnCustomSec(sec CustomSec)            {}
+func (BaseHandler) OnType(ft FuncType)                   {}
+func (BaseHandler) OnImport(imp Import)                  {}
+func (BaseHandler) OnFunc(typeIdx TypeIdx)               {}
+func (BaseHandler) OnTable(tt TableType)                 {}
+func (BaseHandler) OnMem(mt MemType)                     {}
+func (BaseHandler) OnGlobal(g Global)                    {}
+func (BaseHandler) OnExport(exp Export)                  {}
+func (BaseHandler) OnStart(idx FuncIdx)                  {}
+func (BaseHandler) OnElem(elem Elem)                     {}
+func (BaseHandler) OnDataCount(n uint32)                 {}
+func (BaseHandler) OnCodeStart(idx int, locals []Locals) {}
+func (BaseHandler) OnInstruction(instr Instruction)      {}
+func (BaseHandler) OnCodeEnd(idx int)                    {}
+func (BaseHandler) OnData(data Data)                     {}
+
+// DecodeStream decodes data like Decode, but passes each part of the
+// module to h instead of building a Module. Events already delivered when
+// an error is found are not taken back.
+func DecodeStream(data []byte, h Handler) error {
+	return DecodeStreamWithOptions(data, DefaultDecodeOptions(), h)
+}
+
+func DecodeStreamWithOptions(data []byte, opts DecodeOptions, h Handler) (err error) {
+	reader := &wasmReader{
+		data: data,
+		end:  len(data),
+		opts: opts,
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			switch x := r.(type) {
+			case error:
+				err = reader.errorAt(x)
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	reader.readPreamble()
+
+	counter := &importCounter{Handler: h}
+	funcCount, codeCount, dataCount := 0, 0, 0
+	reader.forEachSection(func(secID byte) {
+		switch secID {
+		case SecCustomID:
+			h.OnCustomSec(reader.readCustomSec())
+		case SecCodeID:
+			codeCount = reader.readVec(0, "", func(i int) { reader.streamCode(i, h) })
+		case SecFuncID:
+			funcCount = reader.readSec(secID, h)
+		case SecDataID:
+			dataCount = reader.readSec(secID, h)
+		default:
+			reader.readSec(secID, counter)
+		}
+	})
+	if funcCount != codeCount {
+		panic(funcCodeMismatch(funcCount, codeCount, counter.funcs))
+	}
+	checkDataCount(reader.dataCount, dataCount)
+
+	return nil
+}
+
+// importCounter counts the function imports passed to the Handler it
+// wraps
+type importCounter struct {
+	Handler
+	funcs int
+}
+
+func (c *importCounter) OnImport(imp Import) {
+	if imp.Desc.Tag == ImportTagFunc {
+		c.funcs++
+	}
+	c.Handler.OnImport(imp)
+}
+
+// readVec reads the length of a vector, which must not be more than max
+// unless max is 0, then calls read with the index of each element. It
+// returns the length.
+func (reader *wasmReader) readVec(max int, what string, read func(i int)) int {
+	n := int(reader.readCount(max, what))
+	for i := 0; i < n; i++ {
+		read(i)
+	}
+	return n
+}
+
+// readSec passes the entries of a section other than the custom and
+// code sections to h and returns their number. Decode reads these
+// sections with it too, so both apply the same checks and limits.
+func (reader *wasmReader) readSec(secID byte, h Handler) int {
+	switch secID {
+	case SecTypeID:
+		var types TypeIdx
+		reader.readVec(0, "", func(int) {
+			for _, ft := range reader.readRecType(types) {
+				h.OnType(ft)
+				types++
+			}
+		})
+		return int(types)
+	case SecImportID:
+		return reader.readVec(reader.opts.MaxImports, "imports", func(int) {
+			h.OnImport(reader.readImport())
+		})
+	case SecFuncID:
+		return reader.readVec(0, "", func(int) { h.OnFunc(reader.readVarU32()) })
+	case SecTableID:
+		return reader.readVec(0, "", func(int) { h.OnTable(reader.readTableType()) })
+	case SecMemID:
+		return reader.readVec(0, "", func(int) { h.OnMem(reader.readMemType()) })
+	case SecGlobalID:
+		return reader.readVec(reader.opts.MaxGlobals, "globals", func(int) {
+			h.OnGlobal(Global{
+				Type: reader.readGlobalType(),
+				Init: reader.readConstExpr(),
+			})
+		})
+	case SecExportID:
+		names := make(map[string]bool)
+		return reader.readVec(0, "", func(int) {
+			exp := reader.readExport()
+			if names[exp.Name] {
+				panic(fmt.Errorf("duplicate export name: %q", exp.Name))
+			}
+			names[exp.Name] = true
+			h.OnExport(exp)
+		})
+	case SecStartID:
+		h.OnStart(*reader.readStartSec())
+		return 1
+	case SecElemID:
+		return reader.readVec(reader.opts.MaxElemSegments, "element segments", func(int) {
+			h.OnElem(reader.readElem())
+		})
+	case SecDataCountID:
+		reader.dataCount = reader.readDataCountSec()
+		h.OnDataCount(*reader.dataCount)
+		return 1
+	case SecDataID:
+		return reader.readVec(reader.opts.MaxDataSegments, "data segments", func(int) {
+			h.OnData(reader.readData())
+		})
+	}
+	return 0
+}
+
+// streamCode passes the body of the code section entry idx to h
+func (reader *wasmReader) streamCode(idx int, h Handler) {
+	reader.checkFuncBodySize(idx)
+	codeReader := reader.subReader(reader.readBytes())
+	defer codeReader.recoverAt()
+	locals := codeReader.readLocalsVec()
+	checkLocalCount(Code{Locals: locals}.GetLocalCount())
+
+	h.OnCodeStart(idx, locals)
+	codeReader.readInstructions(h.OnInstruction)
+	if codeReader.remaining() > 0 {
+		panic(fmt.Errorf("function body %d: %d bytes after the final end", idx, codeReader.remaining()))
+	}
+	h.OnCodeEnd(idx)
+}
@@ -0,0 +1,86 @@
+package binary
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recorder keeps the exports and instructions of the module it is
+// passed
+type recorder struct {
+	BaseHandler
+	exports []Export
+	instrs  []Instruction
+}
+
+func (r *recorder) OnExport(exp Export)             { r.exports = append(r.exports, exp) }
+func (r *recorder) OnInstruction(instr Instruction) { r.instrs = append(r.instrs, instr) }
+
+func TestDecodeStream(t *testing.T) {
+	secs := voidFunc(I32Const, 7, Drop, End)
+	data := wasm(secs[0], secs[1], sec(SecExportID, 1, 1, 'f', ExportTagFunc, 0), secs[2])
+	m := mustDecode(t, data)
+	r := &recorder{}
+	if err := DecodeStream(data, r); err != nil {
+		t.Fatalf("DecodeStream: %v", err)
+	}
+	if !reflect.DeepEqual(r.exports, m.ExportSec) {
+		t.Fatalf("got exports %v, want %v", r.exports, m.ExportSec)
+	}
+	if !reflect.DeepEqual(r.instrs, []Instruction(m.CodeSec[0].Expr)) {
+		t.Fatalf("got instructions %v, want %v", r.instrs, m.CodeSec[0].Expr)
+	}
+}
+
+// TestDecodeStreamChecks checks that DecodeStream rejects what Decode
+// rejects
+func TestDecodeStreamChecks(t *testing.T) {
+	secs := voidFunc(Nop, End)
+	twoImports := sec(SecImportID, 2,
+		1, 'm', 1, 'a', ImportTagFunc, 0,
+		1, 'm', 1, 'b', ImportTagFunc, 0)
+	tests := []struct {
+		name   string
+		data   []byte
+		limits func(opts *DecodeOptions)
+		want   interface{} // the error message or a pointer to its type
+	}{
+		{
+			name: "duplicate export",
+			data: wasm(secs[0], secs[1],
+				sec(SecExportID, 2, 1, 'f', ExportTagFunc, 0, 1, 'f', ExportTagFunc, 0), secs[2]),
+			want: `duplicate export name: "f"`,
+		},
+		{
+			name:   "body size",
+			data:   wasm(secs...),
+			limits: func(opts *DecodeOptions) { opts.MaxFuncBodyBytes = 2 },
+			want:   new(*FuncBodyTooLargeError),
+		},
+		{
+			name:   "import count",
+			data:   wasm(secs[0], twoImports),
+			limits: func(opts *DecodeOptions) { opts.MaxImports = 1 },
+			want:   new(*CountLimitError),
+		},
+	}
+	for _, tt := range tests {
+		opts := DefaultDecodeOptions()
+		if tt.limits != nil {
+			tt.limits(&opts)
+		}
+		_, decodeErr := DecodeWithOptions(tt.data, opts)
+		streamErr := DecodeStreamWithOptions(tt.data, opts, BaseHandler{})
+		for _, err := range []error{decodeErr, streamErr} {
+			if err == nil {
+				t.Fatalf("%s: got no error, want %v", tt.name, tt.want)
+			}
+			if msg, ok := tt.want.(string); ok {
+				wantError(t, err, msg)
+			} else if !errors.As(err, tt.want) {
+				t.Fatalf("%s: got %v, want a %T", tt.name, err, tt.want)
+			}
+		}
+	}
+}
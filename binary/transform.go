@@ -0,0 +1,102 @@
+package binary
+
+import "math/bits"
+
+// MapInstructions replaces each instruction of every function body with
+// the (possibly empty) list returned by fn and rebuilds Code.Expr.
+//
+// Branch label indices are relative to the enclosing blocks, so fn must
+// keep block/loop/if/else/end balanced: inserting or removing any of them
+// silently changes the target of existing br, br_if and br_table
+// instructions. The final End of each body must be kept as well.
+func (m *Module) MapInstructions(fn func(Instruction) []Instruction) {
+	for i := range m.CodeSec {
+		code := &m.CodeSec[i]
+		expr := make(Expr, 0, len(code.Expr))
+		for _, instr := range code.Expr {
+			expr = append(expr, fn(instr)...)
+		}
+		code.Expr = expr
+	}
+	m.MarkDirty(SecCodeID)
+}
+
+// NormalizeAlignments lowers every alignment hint larger than the natural
+// alignment of its load or store, which is illegal, to the natural one.
+// Smaller hints are legal and kept, except for atomic instructions which
+// get exactly the natural alignment. It returns how many were changed.
+func (m *Module) NormalizeAlignments() int {
+	changed := 0
+	for i := range m.CodeSec {
+		expr := m.CodeSec[i].Expr
+		for j := range expr {
+			size, ok := accessSize(expr[j])
+			if !ok {
+				continue
+			}
+			natural := uint32(bits.TrailingZeros32(size))
+			switch args := expr[j].Args.(type) {
+			case MemArg:
+				// atomic instructions only allow the natural alignment
+				if args.Align > natural || expr[j].Opcode == PrefixAtomic && args.Align != natural {
+					args.Align = natural
+					expr[j].Args = args
+					changed++
+				}
+			case MemLaneArgs:
+				if args.MemArg.Align > natural {
+					args.MemArg.Align = natural
+					expr[j].Args = args
+					changed++
+				}
+			}
+		}
+	}
+	if changed > 0 {
+		m.MarkDirty(SecCodeID)
+	}
+	return changed
+}
+
+// RewriteImportModule changes the module name of every import from
+// oldName to newName, e.g. to retarget "env" imports to another host. It
+// returns how many imports were changed.
+func (m *Module) RewriteImportModule(oldName, newName string) int {
+	changed := 0
+	for i := range m.ImportSec {
+		if m.ImportSec[i].Module == oldName {
+			m.ImportSec[i].Module = newName
+			changed++
+		}
+	}
+	if changed > 0 {
+		m.MarkDirty(SecImportID)
+	}
+	return changed
+}
+
+// NaturalAlignment returns log2 of the number of bytes a load or store
+// accesses, ok is false for instructions without a memarg
+func NaturalAlignment(instr Instruction) (align uint32, ok bool) {
+	size, ok := accessSize(instr)
+	return uint32(bits.TrailingZeros32(size)), ok
+}
+
+// accessSize returns how many bytes a load or store accesses, ok is false
+// for instructions without a memarg
+func accessSize(instr Instruction) (size uint32, ok bool) {
+	switch {
+	case instr.Opcode >= I32Load && instr.Opcode <= I64Store32:
+		return memAccessSize(instr.Opcode), true
+	case instr.Opcode == PrefixAtomic:
+		if instr.SubOpcode != AtomicFence {
+			return atomicAccessSize(instr.SubOpcode), true
+		}
+	case instr.Opcode == PrefixSIMD:
+		switch sub := instr.SubOpcode; {
+		case sub <= V128Store, sub >= V128Load8Lane && sub <= V128Load64Zero:
+			return simdAccessSize(sub), true
+		}
+	}
+	return 0, false
+}
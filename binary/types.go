@@ -10,22 +10,76 @@ type any = interface{}
 type ValType = byte
 
 const (
-	ValTypeI32 ValType = 0x7F
-	ValTypeI64 ValType = 0x7E
-	ValTypeF32 ValType = 0x7D
-	ValTypeF64 ValType = 0x7C
+	ValTypeI32  ValType = 0x7F
+	ValTypeI64  ValType = 0x7E
+	ValTypeF32  ValType = 0x7D
+	ValTypeF64  ValType = 0x7C
+	ValTypeV128 ValType = 0x7B
 
-	FtTag   = 0x60
-	FuncRef = 0x70
+	FtTag     = 0x60
+	FuncRef   = 0x70
+	ExternRef = 0x6F
 
 	MutConst byte = 0
 	MutVar   byte = 1
 )
 
+// GC 提案的类型段编码
+const (
+	RecTag      = 0x4E
+	SubTag      = 0x50
+	SubFinalTag = 0x4F
+	StructTag   = 0x5F
+	ArrayTag    = 0x5E
+
+	PackedI8   = 0x78
+	PackedI16  = 0x77
+	RefTag     = 0x64 // (ref ht)
+	RefNullTag = 0x63 // (ref null ht)
+)
+
+// FuncType is an entry of the type section. Under the GC proposal it may
+// also be a struct or array type, declared as a subtype and part of a
+// recursion group; such types are decoded but not validated or executed.
 type FuncType struct {
-	Tag         byte
+	Tag         byte // FtTag, StructTag or ArrayTag
 	ParamTypes  []ValType
 	ResultTypes []ValType
+	// GC 提案
+	Fields   []FieldType // the fields of a struct, the element of an array
+	Sub      byte        // SubTag or SubFinalTag if declared with sub, 0 otherwise
+	Supers   []TypeIdx
+	RecGroup RecGroup
+}
+
+// compTag returns ft's Tag, function types built without one included
+func (ft FuncType) compTag() byte {
+	if ft.Tag == 0 {
+		return FtTag
+	}
+	return ft.Tag
+}
+
+// Final reports whether ft can not have subtypes, which is the case
+// unless it is declared with sub and without final
+func (ft FuncType) Final() bool {
+	return ft.Sub != SubTag
+}
+
+// FieldType is a field of a GC struct or array type
+type FieldType struct {
+	Type ValType // a value type, PackedI8, PackedI16, RefTag or RefNullTag
+	// for RefTag and RefNullTag, a type index or, if negative, an abstract
+	// heap type as its s33 encoding, e.g. -0x10 for func
+	HeapType int64
+	Mut      byte
+}
+
+// RecGroup locates the recursion group a type belongs to, Size is 0 for
+// a type declared outside of a rec group
+type RecGroup struct {
+	Start TypeIdx
+	Size  uint32
 }
 
 type Limits struct {
@@ -36,6 +90,23 @@ type Limits struct {
 
 type MemType = Limits
 
+// MaxMemPages is the largest size of a 32-bit memory, 4GiB
+const MaxMemPages = 65536
+
+// checkMemType checks that the sizes of mt fit in 32-bit addresses
+func checkMemType(mt MemType) {
+	if mt.Min > MaxMemPages || mt.Tag == 1 && mt.Max > MaxMemPages {
+		panic(fmt.Errorf("memory size must be at most %d pages (4GiB)", MaxMemPages))
+	}
+}
+
+// checkLimits checks that the maximum of l, if any, is not below the minimum
+func checkLimits(l Limits) {
+	if l.Tag == 1 && l.Min > l.Max {
+		panic(fmt.Errorf("size minimum %d must not be greater than maximum %d", l.Min, l.Max))
+	}
+}
+
 type TableType struct {
 	ElemType byte
 	Limits   Limits
@@ -46,23 +117,58 @@ type GlobalType struct {
 	Mut     byte
 }
 
+type valTypeInfo struct {
+	name string
+	// the proposal that introduced the type, empty for MVP types
+	feature string
+	enabled func(f Features) bool
+}
+
+// valTypes is the only place value types are listed, both the decoder
+// and ValTypeToStr use it
+var valTypes = map[ValType]valTypeInfo{
+	ValTypeI32: {name: "i32"},
+	ValTypeI64: {name: "i64"},
+	ValTypeF32: {name: "f32"},
+	ValTypeF64: {name: "f64"},
+	ValTypeV128: {name: "v128", feature: "simd",
+		enabled: func(f Features) bool { return f.SIMD }},
+	FuncRef: {name: "funcref", feature: "reference-types",
+		enabled: func(f Features) bool { return f.ReferenceTypes }},
+	ExternRef: {name: "externref", feature: "reference-types",
+		enabled: func(f Features) bool { return f.ReferenceTypes }},
+}
+
+// RegisterValType makes the decoder accept vt regardless of Features and
+// names it in the text output. It is meant to be called from init
+// functions, it is not safe to call while modules are being decoded.
+func RegisterValType(vt ValType, name string) {
+	valTypes[vt] = valTypeInfo{name: name}
+}
+
 func ValTypeToStr(vt ValType) string {
-	switch vt {
-	case ValTypeI32:
-		return "i32"
-	case ValTypeI64:
-		return "i64"
-	case ValTypeF32:
-		return "f32"
-	case ValTypeF64:
-		return "f64"
-	default:
+	info, ok := valTypes[vt]
+	if !ok {
 		panic(fmt.Errorf("invalid valtype: %d", vt))
 	}
+	return info.name
 }
 
+// Equal compares the structure of two types. The GC subtyping and
+// recursion groups are not taken into account.
 func (ft FuncType) Equal(ft2 FuncType) bool {
 	//return reflect.DeepEqual(ft, ft2)
+	if ft.compTag() != ft2.compTag() {
+		return false
+	}
+	if len(ft.Fields) != len(ft2.Fields) {
+		return false
+	}
+	for i, field := range ft.Fields {
+		if field != ft2.Fields[i] {
+			return false
+		}
+	}
 	if len(ft.ParamTypes) != len(ft2.ParamTypes) {
 		return false
 	}
@@ -104,8 +210,72 @@ func (ft FuncType) GetSignature() string {
 }
 
 func (ft FuncType) String() string {
+	switch ft.Tag {
+	case StructTag:
+		fields := make([]string, len(ft.Fields))
+		for i, field := range ft.Fields {
+			fields[i] = field.String()
+		}
+		return "struct{" + strings.Join(fields, ", ") + "}"
+	case ArrayTag:
+		if len(ft.Fields) == 1 {
+			return "array{" + ft.Fields[0].String() + "}"
+		}
+	}
 	return ft.GetSignature()
 }
+
+func (field FieldType) String() string {
+	var s string
+	switch field.Type {
+	case PackedI8:
+		s = "i8"
+	case PackedI16:
+		s = "i16"
+	case RefTag, RefNullTag:
+		ht := fmt.Sprintf("%d", field.HeapType)
+		if field.HeapType < 0 {
+			ht = heapTypeNames[byte(field.HeapType&0x7F)]
+		}
+		if field.Type == RefNullTag {
+			s = "(ref null " + ht + ")"
+		} else {
+			s = "(ref " + ht + ")"
+		}
+	case 0x73:
+		s = "nullfuncref"
+	case 0x72:
+		s = "nullexternref"
+	case 0x71:
+		s = "nullref"
+	default:
+		if name, ok := heapTypeNames[field.Type]; ok {
+			s = name + "ref"
+		} else {
+			s = ValTypeToStr(field.Type)
+		}
+	}
+	if field.Mut == MutVar {
+		return "mut " + s
+	}
+	return s
+}
+
+// heapTypeNames names the abstract heap types of the GC proposal by their
+// encoding, which doubles as the nullable reference type shorthand
+var heapTypeNames = map[byte]string{
+	0x73: "nofunc",
+	0x72: "noextern",
+	0x71: "none",
+	0x70: "func",
+	0x6F: "extern",
+	0x6E: "any",
+	0x6D: "eq",
+	0x6C: "i31",
+	0x6B: "struct",
+	0x6A: "array",
+}
+
 func (gt GlobalType) String() string {
 	return fmt.Sprintf("{type: %s, mut: %d}",
 		ValTypeToStr(gt.ValType), gt.Mut)
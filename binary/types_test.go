@@ -0,0 +1,41 @@
+package binary
+
+import "testing"
+
+// valTypeName is ValTypeToStr without the panic
+func valTypeName(vt ValType) (name string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	return ValTypeToStr(vt), true
+}
+
+func TestValTypesDecodedAndNamed(t *testing.T) {
+	for b := 0; b < 0x80; b++ {
+		vt := ValType(b)
+		// a function type with a single parameter of type vt
+		_, err := Decode(wasm(sec(SecTypeID, 1, FtTag, 1, vt, 0)))
+		name, named := valTypeName(vt)
+		if (err == nil) != named {
+			t.Errorf("type 0x%02x: got decode error %v and name %q, want both or neither", b, err, name)
+		}
+	}
+}
+
+func TestRegisterValType(t *testing.T) {
+	const vt ValType = 0x6A
+	data := wasm(sec(SecTypeID, 1, FtTag, 1, vt, 0))
+	if _, err := Decode(data); err == nil {
+		t.Fatalf("got no error for type 0x%02x before registering it", vt)
+	}
+	RegisterValType(vt, "test")
+	defer delete(valTypes, vt)
+	if _, err := Decode(data); err != nil {
+		t.Fatalf("got error %v after registering the type, want none", err)
+	}
+	if name := ValTypeToStr(vt); name != "test" {
+		t.Fatalf("got name %q, want %q", name, "test")
+	}
+}
@@ -0,0 +1,969 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validate checks a module, decoded or built, with the features Decode
+// enables: every type must be a function type, the sections must agree
+// with each other and every function body must be well typed.
+func (m Module) Validate() error {
+	return m.ValidateWithFeatures(AllFeatures())
+}
+
+// ValidateWithFeatures is Validate for modules that may only use the
+// given features.
+func (m Module) ValidateWithFeatures(features Features) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	v := newValidator(m)
+	v.features = features
+	v.validateTypes()
+	v.validateStructure()
+	v.validateFeatures()
+	v.validateCustomSecs()
+	for i, g := range m.GlobalSec {
+		// globals are initialized in order, after the imported ones
+		idx := len(v.globals) - len(m.GlobalSec) + i
+		inContext(fmt.Sprintf("global %d", idx), func() {
+			v.validateConstExpr(g.Init, g.Type.ValType, idx)
+		})
+	}
+	for i, elem := range m.ElemSec {
+		inContext(fmt.Sprintf("elem %d", i), func() {
+			if elem.Mode == ElemModeActive {
+				v.validateConstExpr(elem.Offset, ValTypeI32, len(v.globals))
+			}
+			v.validateElemInit(elem)
+		})
+	}
+	for i, data := range m.DataSec {
+		inContext(fmt.Sprintf("data %d", i), func() {
+			switch data.Mode {
+			case DataModeActive:
+				if int(data.Mem) >= v.memCount {
+					panic(fmt.Errorf("unknown memory %d", data.Mem))
+				}
+				v.validateConstExpr(data.Offset, ValTypeI32, len(v.globals))
+			case DataModePassive:
+			default:
+				panic(fmt.Errorf("invalid data segment mode: %d", data.Mode))
+			}
+		})
+	}
+	for _, exp := range m.ExportSec {
+		inContext(fmt.Sprintf("export %q", exp.Name), func() {
+			v.validateExport(exp)
+		})
+	}
+	for i, code := range m.CodeSec {
+		if i >= len(m.FuncSec) {
+			break
+		}
+		idx := FuncIdx(v.importedFuncCount + i)
+		inContext(fmt.Sprintf("func %d", idx), func() {
+			v.validateCode(v.funcTypes[idx], code)
+		})
+	}
+
+	return nil
+}
+
+// MaxStackDepth returns the maximum height of the operand stack while
+// function fn runs, found by type checking its body. The body must be
+// valid, imported functions have no body.
+func (m Module) MaxStackDepth(fn FuncIdx) (depth int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	v := newValidator(m)
+	v.features = AllFeatures()
+	if int(fn) < v.importedFuncCount {
+		return 0, fmt.Errorf("function %d is imported", fn)
+	}
+	i := int(fn) - v.importedFuncCount
+	if i >= len(m.CodeSec) || int(fn) >= len(v.funcTypes) {
+		return 0, fmt.Errorf("unknown function %d", fn)
+	}
+	return v.validateCode(v.funcTypes[fn], m.CodeSec[i]), nil
+}
+
+// inContext runs fn and prefixes the error it panics with, if any, with
+// where it happened
+func inContext(where string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok {
+				panic(fmt.Errorf("%s: %w", where, err))
+			}
+			panic(r)
+		}
+	}()
+
+	fn()
+}
+
+type validator struct {
+	module            Module
+	importedFuncCount int
+	funcTypes         []FuncType
+	tables            []TableType
+	memCount          int
+	globals           []GlobalType
+	features          Features
+	standalone        bool // no module: every global and function index is known
+}
+
+func newValidator(m Module) *validator {
+	v := &validator{module: m}
+	for _, imp := range m.ImportSec {
+		switch imp.Desc.Tag {
+		case ImportTagFunc:
+			v.funcTypes = append(v.funcTypes, v.typeAt(imp.Desc.FuncType))
+			v.importedFuncCount++
+		case ImportTagTable:
+			v.tables = append(v.tables, imp.Desc.Table)
+		case ImportTagMem:
+			v.memCount++
+		case ImportTagGlobal:
+			v.globals = append(v.globals, imp.Desc.Global)
+		}
+	}
+	for _, typeIdx := range m.FuncSec {
+		v.funcTypes = append(v.funcTypes, v.typeAt(typeIdx))
+	}
+	v.tables = append(v.tables, m.TableSec...)
+	v.memCount += len(m.MemSec)
+	for _, g := range m.GlobalSec {
+		v.globals = append(v.globals, g.Type)
+	}
+
+	return v
+}
+
+func (v *validator) typeAt(idx TypeIdx) FuncType {
+	if int(idx) >= len(v.module.TypeSec) {
+		panic(fmt.Errorf("unknown type %d", idx))
+	}
+	return v.module.TypeSec[idx]
+}
+
+// validateTypes checks the tags again, the module may not come from the
+// decoder or may have been modified since
+func (v *validator) validateTypes() {
+	for i, ft := range v.module.TypeSec {
+		switch ft.Tag {
+		case FtTag:
+		case StructTag, ArrayTag:
+			panic(fmt.Errorf("type %d: GC struct and array types can only be decoded", i))
+		default:
+			panic(fmt.Errorf("type %d: invalid functype tag: 0x%02x", i, ft.Tag))
+		}
+		if len(ft.Supers) > 1 {
+			panic(fmt.Errorf("type %d: at most one supertype allowed", i))
+		}
+		for _, super := range ft.Supers {
+			if int(super) >= i {
+				panic(fmt.Errorf("type %d: supertype %d must be defined before it", i, super))
+			}
+			if v.module.TypeSec[super].Final() {
+				panic(fmt.Errorf("type %d: supertype %d is final", i, super))
+			}
+			if !ft.Equal(v.module.TypeSec[super]) {
+				panic(fmt.Errorf("type %d: type mismatch with supertype %d", i, super))
+			}
+		}
+	}
+}
+
+// validateStructure re-checks what the decoder checks across sections,
+// for modules that were built rather than decoded
+func (v *validator) validateStructure() {
+	m := v.module
+	if len(m.FuncSec) != len(m.CodeSec) {
+		panic(funcCodeMismatch(len(m.FuncSec), len(m.CodeSec), v.importedFuncCount))
+	}
+	if m.DataCountSec != nil && int(*m.DataCountSec) != len(m.DataSec) {
+		panic(fmt.Errorf("data count %d does not match the %d data segments",
+			*m.DataCountSec, len(m.DataSec)))
+	}
+	if v.memCount > 1 {
+		panic(fmt.Errorf("multiple memories: %d", v.memCount))
+	}
+	for i, tt := range v.tables {
+		inContext(fmt.Sprintf("table %d", i), func() {
+			checkLimits(tt.Limits)
+		})
+	}
+	var mems []MemType
+	for _, imp := range m.ImportSec {
+		if imp.Desc.Tag == ImportTagMem {
+			mems = append(mems, imp.Desc.Mem)
+		}
+	}
+	for i, mt := range append(mems, m.MemSec...) {
+		inContext(fmt.Sprintf("memory %d", i), func() {
+			checkMemType(mt)
+			checkLimits(mt)
+		})
+	}
+	if len(v.tables) > 1 && !v.features.ReferenceTypes {
+		panic(fmt.Errorf("multiple tables: %d", len(v.tables)))
+	}
+	if m.StartSec != nil {
+		idx := *m.StartSec
+		if int(idx) >= len(v.funcTypes) {
+			panic(fmt.Errorf("unknown start function %d", idx))
+		}
+		if ft := v.funcTypes[idx]; len(ft.ParamTypes) != 0 || len(ft.ResultTypes) != 0 {
+			panic(fmt.Errorf("start function %d must have type [] -> [], got %s -> %s",
+				idx, typesToStr(ft.ParamTypes), typesToStr(ft.ResultTypes)))
+		}
+	}
+}
+
+// validateCustomSecs checks the names of the custom sections. Any custom
+// section may repeat except the name section.
+func (v *validator) validateCustomSecs() {
+	nameSecs := 0
+	for _, cs := range v.module.CustomSecs {
+		if !utf8.ValidString(cs.Name) {
+			panic(fmt.Errorf("custom section %q: %w", cs.Name, errMalformedUTF8Encoding))
+		}
+		if cs.Name == "name" {
+			nameSecs++
+		}
+	}
+	if nameSecs > 1 {
+		panic(fmt.Errorf("%d name sections, at most one is allowed", nameSecs))
+	}
+}
+
+// elemRefType returns the type of the entries of elem, function indices
+// are funcref
+func elemRefType(elem Elem) ValType {
+	if elem.Exprs == nil {
+		return FuncRef
+	}
+	return elem.Type
+}
+
+// validateElemInit checks that the entries of elem are references of the
+// element type of its table, if it is active
+func (v *validator) validateElemInit(elem Elem) {
+	rt := elemRefType(elem)
+	if rt != FuncRef && rt != ExternRef {
+		panic(fmt.Errorf("malformed reference type: %d", rt))
+	}
+	switch elem.Mode {
+	case ElemModeActive:
+		if int(elem.Table) >= len(v.tables) {
+			panic(fmt.Errorf("unknown table %d", elem.Table))
+		}
+		if tt := v.tables[elem.Table]; tt.ElemType != rt {
+			panic(fmt.Errorf("type mismatch: %s entries in table %d of %s",
+				ValTypeToStr(rt), elem.Table, ValTypeToStr(tt.ElemType)))
+		}
+	case ElemModePassive, ElemModeDeclarative:
+	default:
+		panic(fmt.Errorf("invalid element segment mode: %d", elem.Mode))
+	}
+	for i, idx := range elem.Init {
+		if int(idx) >= len(v.funcTypes) {
+			panic(fmt.Errorf("entry %d: unknown function %d", i, idx))
+		}
+	}
+	for i, expr := range elem.Exprs {
+		inContext(fmt.Sprintf("entry %d", i), func() {
+			v.validateConstExpr(expr, rt, len(v.globals))
+		})
+	}
+}
+
+// validateExport checks that exp refers to an entity of its kind, which
+// may be imported: re-exporting an import uses the import's index
+func (v *validator) validateExport(exp Export) {
+	var kind string
+	var imported, total int
+	funcs, tables, mems, globals := v.module.ImportArity()
+	switch exp.Desc.Tag {
+	case ExportTagFunc:
+		kind, imported, total = "function", funcs, len(v.funcTypes)
+	case ExportTagTable:
+		kind, imported, total = "table", tables, len(v.tables)
+	case ExportTagMem:
+		kind, imported, total = "memory", mems, v.memCount
+	case ExportTagGlobal:
+		kind, imported, total = "global", globals, len(v.globals)
+	default:
+		panic(fmt.Errorf("invalid export tag: 0x%02x", exp.Desc.Tag))
+	}
+	if int(exp.Desc.Idx) >= total {
+		panic(fmt.Errorf("unknown %s %d (%d imported, %d defined)",
+			kind, exp.Desc.Idx, imported, total-imported))
+	}
+}
+
+// 函数体的类型检查, 按照规范附录中的算法实现
+
+// valTypeUnknown is the type of an operand popped from the polymorphic
+// stack of unreachable code, it matches every type
+const valTypeUnknown ValType = 0
+
+type ctrlFrame struct {
+	opcode      byte
+	startTypes  []ValType
+	endTypes    []ValType
+	height      int
+	unreachable bool
+}
+
+type codeValidator struct {
+	*validator
+	locals    []ValType
+	vals      []ValType
+	ctrls     []ctrlFrame
+	maxHeight int // highest operand stack in reachable code
+}
+
+// validateCode type checks a function body and returns the maximum height
+// of its operand stack
+func (v *validator) validateCode(ft FuncType, code Code) int {
+	cv := &codeValidator{validator: v}
+	cv.locals = append(cv.locals, ft.ParamTypes...)
+	cv.locals = append(cv.locals, code.ExpandedLocals()...)
+
+	cv.pushCtrl(Block, nil, ft.ResultTypes)
+	for pc, instr := range code.Expr {
+		if len(cv.ctrls) == 0 {
+			panic(fmt.Errorf("instruction %d after the end of the function", pc))
+		}
+		cv.validateInstr(instr)
+	}
+	if len(cv.ctrls) != 0 {
+		panic(errors.New("function body not terminated by end"))
+	}
+	return cv.maxHeight
+}
+
+// validateConstExpr checks that expr only holds constant instructions and
+// produces a single value of type vt. Only the first initializedGlobals
+// globals may be read. The arithmetic instructions need the
+// extended-const feature.
+func (v *validator) validateConstExpr(expr Expr, vt ValType, initializedGlobals int) {
+	cv := &codeValidator{validator: v}
+	cv.pushCtrl(Block, nil, []ValType{vt})
+	for _, instr := range expr {
+		if len(cv.ctrls) == 0 {
+			panic(errors.New("instructions after the end of the constant expression"))
+		}
+		switch instr.Opcode {
+		case I32Const, I64Const, F32Const, F64Const, RefNull, RefFunc, End:
+		case I32Add, I32Sub, I32Mul, I64Add, I64Sub, I64Mul:
+			requireFeature(v.features.ExtendedConst, "extended-const")
+		case GlobalGet:
+			idx := instr.Args.(uint32)
+			if cv.global(idx).Mut != MutConst {
+				panic(fmt.Errorf("constant expression reads mutable global %d", idx))
+			}
+			if int(idx) >= initializedGlobals {
+				panic(fmt.Errorf("constant expression reads global %d before it is initialized", idx))
+			}
+		case PrefixSIMD:
+			if instr.SubOpcode != V128Const {
+				panic(fmt.Errorf("constant expression required, got %s", instr.GetOpname()))
+			}
+		default:
+			panic(fmt.Errorf("constant expression required, got %s", instr.GetOpname()))
+		}
+		cv.validateInstr(instr)
+	}
+	if len(cv.ctrls) != 0 {
+		panic(errors.New("constant expression not terminated by end"))
+	}
+}
+
+// ValidateConstExpr checks that e is a constant expression producing a
+// value of type expected, using only the given features. There is no
+// module: global.get is taken to read an imported immutable global of the
+// type its use needs, and the function of ref.func is not checked.
+func ValidateConstExpr(e Expr, expected ValType, f Features) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	switch expected {
+	case FuncRef, ExternRef:
+		requireFeature(f.ReferenceTypes, "reference-types")
+	case ValTypeV128:
+		requireFeature(f.SIMD, "simd")
+	}
+
+	v := newValidator(Module{})
+	v.features = f
+	v.standalone = true
+	v.validateConstExpr(e, expected, math.MaxInt)
+
+	return nil
+}
+
+func (cv *codeValidator) pushVal(vt ValType) {
+	cv.vals = append(cv.vals, vt)
+	cv.updateMaxHeight()
+}
+
+func (cv *codeValidator) pushVals(vts []ValType) {
+	cv.vals = append(cv.vals, vts...)
+	cv.updateMaxHeight()
+}
+
+// updateMaxHeight ignores unreachable code, it never runs
+func (cv *codeValidator) updateMaxHeight() {
+	if len(cv.ctrls) > 0 && cv.ctrls[len(cv.ctrls)-1].unreachable {
+		return
+	}
+	if len(cv.vals) > cv.maxHeight {
+		cv.maxHeight = len(cv.vals)
+	}
+}
+
+func (cv *codeValidator) popVal() ValType {
+	frame := &cv.ctrls[len(cv.ctrls)-1]
+	if len(cv.vals) == frame.height {
+		if frame.unreachable {
+			return valTypeUnknown
+		}
+		panic(errors.New("type mismatch: operand stack underflow"))
+	}
+	vt := cv.vals[len(cv.vals)-1]
+	cv.vals = cv.vals[:len(cv.vals)-1]
+	return vt
+}
+
+// popExpect pops a value of type expected. It returns the type popped,
+// which is valTypeUnknown in unreachable code: br_table relies on that to
+// check the same operands against labels of different types.
+func (cv *codeValidator) popExpect(expected ValType) ValType {
+	actual := cv.popVal()
+	if actual != expected && actual != valTypeUnknown && expected != valTypeUnknown {
+		panic(fmt.Errorf("type mismatch: expected %s, got %s",
+			typeToStr(expected), typeToStr(actual)))
+	}
+	return actual
+}
+
+func (cv *codeValidator) popVals(vts []ValType) []ValType {
+	popped := make([]ValType, len(vts))
+	for i := len(vts) - 1; i >= 0; i-- {
+		popped[i] = cv.popExpect(vts[i])
+	}
+	return popped
+}
+
+func (cv *codeValidator) pushCtrl(opcode byte, in, out []ValType) {
+	cv.ctrls = append(cv.ctrls, ctrlFrame{
+		opcode:     opcode,
+		startTypes: in,
+		endTypes:   out,
+		height:     len(cv.vals),
+	})
+	cv.pushVals(in)
+}
+
+func (cv *codeValidator) popCtrl() ctrlFrame {
+	frame := cv.ctrls[len(cv.ctrls)-1]
+	cv.popVals(frame.endTypes)
+	if len(cv.vals) != frame.height {
+		panic(fmt.Errorf("type mismatch: %d extra values at the end of %s, expected %s",
+			len(cv.vals)-frame.height, opnames[frame.opcode], typesToStr(frame.endTypes)))
+	}
+	cv.ctrls = cv.ctrls[:len(cv.ctrls)-1]
+	return frame
+}
+
+func (cv *codeValidator) labelTypes(l LabelIdx) []ValType {
+	if int(l) >= len(cv.ctrls) {
+		panic(fmt.Errorf("unknown label %d", l))
+	}
+	frame := cv.ctrls[len(cv.ctrls)-1-int(l)]
+	if frame.opcode == Loop {
+		return frame.startTypes
+	}
+	return frame.endTypes
+}
+
+func (cv *codeValidator) setUnreachable() {
+	frame := &cv.ctrls[len(cv.ctrls)-1]
+	cv.vals = cv.vals[:frame.height]
+	frame.unreachable = true
+}
+
+func (cv *codeValidator) blockType(bt BlockType) (in, out []ValType) {
+	if bt == BlockTypeEmpty {
+		return nil, nil
+	}
+	if vt, ok := bt.ValType(); ok {
+		return nil, []ValType{vt}
+	}
+	// 多值提案: 非负的块类型是类型索引
+	if bt < 0 {
+		panic(fmt.Errorf("malformed block type: %d", bt))
+	}
+	if bt >= BlockType(len(cv.module.TypeSec)) {
+		panic(fmt.Errorf("block type refers to unknown type %d (%d types in module)",
+			bt, len(cv.module.TypeSec)))
+	}
+	ft := cv.module.TypeSec[bt]
+	return ft.ParamTypes, ft.ResultTypes
+}
+
+func (cv *codeValidator) validateInstr(instr Instruction) {
+	cv.requireInstrFeature(instr)
+	switch instr.Opcode {
+	case Unreachable:
+		cv.setUnreachable()
+	case Nop:
+	case Block, Loop:
+		in, out := cv.blockType(instr.Args.(BlockType))
+		cv.popVals(in)
+		cv.pushCtrl(instr.Opcode, in, out)
+	case If:
+		in, out := cv.blockType(instr.Args.(BlockType))
+		cv.popExpect(ValTypeI32)
+		cv.popVals(in)
+		cv.pushCtrl(If, in, out)
+	case Else:
+		frame := cv.popCtrl()
+		if frame.opcode != If {
+			panic(errors.New("else without matching if"))
+		}
+		cv.pushCtrl(Else, frame.startTypes, frame.endTypes)
+	case End:
+		frame := cv.popCtrl()
+		if frame.opcode == If && !typesEqual(frame.startTypes, frame.endTypes) {
+			// 没有 else 分支时, 条件为假会把参数原样作为结果
+			panic(fmt.Errorf("type mismatch: if without else must produce its parameters %s, expected %s",
+				typesToStr(frame.startTypes), typesToStr(frame.endTypes)))
+		}
+		cv.pushVals(frame.endTypes)
+	case Br:
+		cv.popVals(cv.labelTypes(instr.Args.(uint32)))
+		cv.setUnreachable()
+	case BrIf:
+		cv.popExpect(ValTypeI32)
+		types := cv.labelTypes(instr.Args.(uint32))
+		cv.popVals(types)
+		cv.pushVals(types)
+	case BrTable:
+		args := instr.Args.(BrTableArgs)
+		cv.popExpect(ValTypeI32)
+		defaultTypes := cv.labelTypes(args.Default)
+		for _, l := range args.Labels {
+			types := cv.labelTypes(l)
+			if len(types) != len(defaultTypes) {
+				panic(fmt.Errorf("type mismatch: br_table label %d carries %s, default %s",
+					l, typesToStr(types), typesToStr(defaultTypes)))
+			}
+			cv.pushVals(cv.popVals(types))
+		}
+		cv.popVals(defaultTypes)
+		cv.setUnreachable()
+	case Return:
+		cv.popVals(cv.ctrls[0].endTypes)
+		cv.setUnreachable()
+	case Call:
+		ft := cv.funcType(instr.Args.(uint32))
+		cv.popVals(ft.ParamTypes)
+		cv.pushVals(ft.ResultTypes)
+	case CallIndirect:
+		args := instr.Args.(CallIndirectArgs)
+		if cv.table(args.Table).ElemType != FuncRef {
+			panic(fmt.Errorf("call_indirect on table %d which is not a funcref table", args.Table))
+		}
+		ft := cv.typeAt(args.Type)
+		cv.popExpect(ValTypeI32)
+		cv.popVals(ft.ParamTypes)
+		cv.pushVals(ft.ResultTypes)
+	case Drop:
+		cv.popVal()
+	case Select:
+		cv.popExpect(ValTypeI32)
+		t1 := cv.popVal()
+		t2 := cv.popVal()
+		if isRefType(t1) || isRefType(t2) {
+			panic(errors.New("type mismatch: select without type on reference types"))
+		}
+		if t1 != t2 && t1 != valTypeUnknown && t2 != valTypeUnknown {
+			panic(fmt.Errorf("type mismatch: select operands %s and %s",
+				typeToStr(t1), typeToStr(t2)))
+		}
+		if t1 == valTypeUnknown {
+			t1 = t2
+		}
+		cv.pushVal(t1)
+	case SelectT:
+		types := instr.Args.([]ValType)
+		if len(types) != 1 {
+			panic(fmt.Errorf("invalid result arity %d for select", len(types)))
+		}
+		cv.popExpect(ValTypeI32)
+		cv.popExpect(types[0])
+		cv.popExpect(types[0])
+		cv.pushVal(types[0])
+	case LocalGet:
+		cv.pushVal(cv.local(instr.Args.(uint32)))
+	case LocalSet:
+		cv.popExpect(cv.local(instr.Args.(uint32)))
+	case LocalTee:
+		vt := cv.local(instr.Args.(uint32))
+		cv.popExpect(vt)
+		cv.pushVal(vt)
+	case GlobalGet:
+		cv.pushVal(cv.global(instr.Args.(uint32)).ValType)
+	case GlobalSet:
+		gt := cv.global(instr.Args.(uint32))
+		if gt.Mut != MutVar {
+			panic(fmt.Errorf("global %d is immutable", instr.Args.(uint32)))
+		}
+		cv.popExpect(gt.ValType)
+	case TableGet:
+		tt := cv.table(instr.Args.(uint32))
+		cv.popExpect(ValTypeI32)
+		cv.pushVal(tt.ElemType)
+	case TableSet:
+		tt := cv.table(instr.Args.(uint32))
+		cv.popExpect(tt.ElemType)
+		cv.popExpect(ValTypeI32)
+	case MemorySize:
+		cv.requireMemory(instr)
+		cv.pushVal(ValTypeI32)
+	case MemoryGrow:
+		cv.requireMemory(instr)
+		cv.popExpect(ValTypeI32)
+		cv.pushVal(ValTypeI32)
+	case I32Const:
+		cv.pushVal(ValTypeI32)
+	case I64Const:
+		cv.pushVal(ValTypeI64)
+	case F32Const:
+		cv.pushVal(ValTypeF32)
+	case F64Const:
+		cv.pushVal(ValTypeF64)
+	case RefNull:
+		cv.pushVal(instr.Args.(byte))
+	case RefIsNull:
+		if vt := cv.popVal(); vt != valTypeUnknown && !isRefType(vt) {
+			panic(fmt.Errorf("type mismatch: ref.is_null on %s", typeToStr(vt)))
+		}
+		cv.pushVal(ValTypeI32)
+	case RefFunc:
+		cv.funcType(instr.Args.(uint32))
+		cv.pushVal(FuncRef)
+	case PrefixMisc:
+		cv.validateMiscInstr(instr)
+	case PrefixSIMD:
+		cv.validateSIMDInstr(instr)
+	case PrefixAtomic:
+		cv.validateAtomicInstr(instr)
+	default:
+		switch {
+		case instr.Opcode >= I32Load && instr.Opcode <= I64Store32:
+			cv.validateMemInstr(instr)
+		default:
+			params, result := numericType(instr.Opcode)
+			cv.popVals(params)
+			cv.pushVal(result)
+		}
+	}
+}
+
+func (cv *codeValidator) validateMemInstr(instr Instruction) {
+	cv.requireMemory(instr)
+	cv.checkAlign(instr.Args.(MemArg), memAccessSize(instr.Opcode))
+
+	var vt ValType
+	switch instr.Opcode {
+	case I32Load, I32Load8S, I32Load8U, I32Load16S, I32Load16U,
+		I32Store, I32Store8, I32Store16:
+		vt = ValTypeI32
+	case F32Load, F32Store:
+		vt = ValTypeF32
+	case F64Load, F64Store:
+		vt = ValTypeF64
+	default:
+		vt = ValTypeI64
+	}
+
+	if instr.Opcode <= I64Load32U {
+		cv.popExpect(ValTypeI32)
+		cv.pushVal(vt)
+	} else {
+		cv.popExpect(vt)
+		cv.popExpect(ValTypeI32)
+	}
+}
+
+func memAccessSize(opcode byte) uint32 {
+	switch opcode {
+	case I32Load8S, I32Load8U, I64Load8S, I64Load8U, I32Store8, I64Store8:
+		return 1
+	case I32Load16S, I32Load16U, I64Load16S, I64Load16U, I32Store16, I64Store16:
+		return 2
+	case I32Load, F32Load, I64Load32S, I64Load32U, I32Store, F32Store, I64Store32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+func (cv *codeValidator) checkAlign(memArg MemArg, size uint32) {
+	if memArg.Align >= 32 || uint64(1)<<memArg.Align > uint64(size) {
+		panic(fmt.Errorf("alignment 2^%d must not be larger than natural %d",
+			memArg.Align, size))
+	}
+}
+
+func (cv *codeValidator) validateMiscInstr(instr Instruction) {
+	switch instr.SubOpcode {
+	case I32TruncSatF32S, I32TruncSatF32U:
+		cv.popExpect(ValTypeF32)
+		cv.pushVal(ValTypeI32)
+	case I32TruncSatF64S, I32TruncSatF64U:
+		cv.popExpect(ValTypeF64)
+		cv.pushVal(ValTypeI32)
+	case I64TruncSatF32S, I64TruncSatF32U:
+		cv.popExpect(ValTypeF32)
+		cv.pushVal(ValTypeI64)
+	case I64TruncSatF64S, I64TruncSatF64U:
+		cv.popExpect(ValTypeF64)
+		cv.pushVal(ValTypeI64)
+	case MemoryInit:
+		cv.requireMemory(instr)
+		cv.data(instr.Args.(uint32))
+		cv.popVals([]ValType{ValTypeI32, ValTypeI32, ValTypeI32})
+	case MemoryCopy, MemoryFill:
+		cv.requireMemory(instr)
+		cv.popVals([]ValType{ValTypeI32, ValTypeI32, ValTypeI32})
+	case DataDrop:
+		cv.data(instr.Args.(uint32))
+	case TableInit:
+		args := instr.Args.(TableInitArgs)
+		tt := cv.table(args.Table)
+		cv.elem(args.Elem, tt.ElemType)
+		cv.popVals([]ValType{ValTypeI32, ValTypeI32, ValTypeI32})
+	case ElemDrop:
+		cv.elem(instr.Args.(uint32), valTypeUnknown)
+	case TableCopy:
+		args := instr.Args.(TableCopyArgs)
+		if cv.table(args.Dst).ElemType != cv.table(args.Src).ElemType {
+			panic(fmt.Errorf("type mismatch: table.copy from table %d to table %d",
+				args.Src, args.Dst))
+		}
+		cv.popVals([]ValType{ValTypeI32, ValTypeI32, ValTypeI32})
+	case TableGrow:
+		tt := cv.table(instr.Args.(uint32))
+		cv.popVals([]ValType{tt.ElemType, ValTypeI32})
+		cv.pushVal(ValTypeI32)
+	case TableSize:
+		cv.table(instr.Args.(uint32))
+		cv.pushVal(ValTypeI32)
+	case TableFill:
+		tt := cv.table(instr.Args.(uint32))
+		cv.popVals([]ValType{ValTypeI32, tt.ElemType, ValTypeI32})
+	}
+}
+
+func (cv *codeValidator) funcType(idx FuncIdx) FuncType {
+	if cv.standalone {
+		return FuncType{Tag: FtTag}
+	}
+	if int(idx) >= len(cv.funcTypes) {
+		panic(fmt.Errorf("unknown function %d", idx))
+	}
+	return cv.funcTypes[idx]
+}
+
+func (cv *codeValidator) local(idx LocalIdx) ValType {
+	if int(idx) >= len(cv.locals) {
+		panic(fmt.Errorf("unknown local %d", idx))
+	}
+	return cv.locals[idx]
+}
+
+func (cv *codeValidator) global(idx GlobalIdx) GlobalType {
+	if cv.standalone {
+		return GlobalType{ValType: valTypeUnknown, Mut: MutConst}
+	}
+	if int(idx) >= len(cv.globals) {
+		panic(fmt.Errorf("unknown global %d", idx))
+	}
+	return cv.globals[idx]
+}
+
+func (cv *codeValidator) table(idx TableIdx) TableType {
+	if int(idx) >= len(cv.tables) {
+		panic(fmt.Errorf("unknown table %d", idx))
+	}
+	return cv.tables[idx]
+}
+
+// elem checks that the element segment exists and, unless elemType is
+// valTypeUnknown, that its entries are of type elemType
+func (cv *codeValidator) elem(idx ElemIdx, elemType ValType) {
+	if int(idx) >= len(cv.module.ElemSec) {
+		panic(fmt.Errorf("unknown elem segment %d", idx))
+	}
+	if rt := elemRefType(cv.module.ElemSec[idx]); elemType != valTypeUnknown && elemType != rt {
+		panic(fmt.Errorf("type mismatch: elem segment %d holds %s, table holds %s",
+			idx, ValTypeToStr(rt), ValTypeToStr(elemType)))
+	}
+}
+
+// data checks that the data segment exists. The declared data count is
+// used when there is one, it is what the decoder checks the index
+// against before the data section is read.
+func (cv *codeValidator) data(idx DataIdx) {
+	count := uint32(len(cv.module.DataSec))
+	if cv.module.DataCountSec != nil {
+		count = *cv.module.DataCountSec
+	}
+	if idx >= count {
+		panic(fmt.Errorf("unknown data segment %d (data count: %d)", idx, count))
+	}
+}
+
+// requireMemory checks that there is a memory for instr to access, the
+// module must import or define one
+func (cv *codeValidator) requireMemory(instr Instruction) {
+	if cv.memCount == 0 {
+		panic(fmt.Errorf("unknown memory 0: %s in a module without memory", instr.GetOpname()))
+	}
+}
+
+// numericType returns the operand and result types of a numeric
+// instruction
+func numericType(opcode byte) ([]ValType, ValType) {
+	i32, i64, f32, f64 := ValTypeI32, ValTypeI64, ValTypeF32, ValTypeF64
+	switch {
+	case opcode == I32Eqz:
+		return []ValType{i32}, i32
+	case opcode >= I32Eq && opcode <= I32GeU:
+		return []ValType{i32, i32}, i32
+	case opcode == I64Eqz:
+		return []ValType{i64}, i32
+	case opcode >= I64Eq && opcode <= I64GeU:
+		return []ValType{i64, i64}, i32
+	case opcode >= F32Eq && opcode <= F32Ge:
+		return []ValType{f32, f32}, i32
+	case opcode >= F64Eq && opcode <= F64Ge:
+		return []ValType{f64, f64}, i32
+	case opcode >= I32Clz && opcode <= I32PopCnt:
+		return []ValType{i32}, i32
+	case opcode >= I32Add && opcode <= I32Rotr:
+		return []ValType{i32, i32}, i32
+	case opcode >= I64Clz && opcode <= I64PopCnt:
+		return []ValType{i64}, i64
+	case opcode >= I64Add && opcode <= I64Rotr:
+		return []ValType{i64, i64}, i64
+	case opcode >= F32Abs && opcode <= F32Sqrt:
+		return []ValType{f32}, f32
+	case opcode >= F32Add && opcode <= F32CopySign:
+		return []ValType{f32, f32}, f32
+	case opcode >= F64Abs && opcode <= F64Sqrt:
+		return []ValType{f64}, f64
+	case opcode >= F64Add && opcode <= F64CopySign:
+		return []ValType{f64, f64}, f64
+	}
+
+	switch opcode {
+	case I32WrapI64:
+		return []ValType{i64}, i32
+	case I32TruncF32S, I32TruncF32U, I32ReinterpretF32:
+		return []ValType{f32}, i32
+	case I32TruncF64S, I32TruncF64U:
+		return []ValType{f64}, i32
+	case I64ExtendI32S, I64ExtendI32U:
+		return []ValType{i32}, i64
+	case I64TruncF32S, I64TruncF32U:
+		return []ValType{f32}, i64
+	case I64TruncF64S, I64TruncF64U, I64ReinterpretF64:
+		return []ValType{f64}, i64
+	case F32ConvertI32S, F32ConvertI32U, F32ReinterpretI32:
+		return []ValType{i32}, f32
+	case F32ConvertI64S, F32ConvertI64U:
+		return []ValType{i64}, f32
+	case F32DemoteF64:
+		return []ValType{f64}, f32
+	case F64ConvertI32S, F64ConvertI32U:
+		return []ValType{i32}, f64
+	case F64ConvertI64S, F64ConvertI64U, F64ReinterpretI64:
+		return []ValType{i64}, f64
+	case F64PromoteF32:
+		return []ValType{f32}, f64
+	case I32Extend8S, I32Extend16S:
+		return []ValType{i32}, i32
+	case I64Extend8S, I64Extend16S, I64Extend32S:
+		return []ValType{i64}, i64
+	}
+
+	panic(fmt.Errorf("illegal opcode: 0x%02x", opcode))
+}
+
+func isRefType(vt ValType) bool {
+	return vt == FuncRef || vt == ExternRef
+}
+
+func typesEqual(a, b []ValType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func typeToStr(vt ValType) string {
+	if vt == valTypeUnknown {
+		return "unknown"
+	}
+	return ValTypeToStr(vt)
+}
+
+func typesToStr(vts []ValType) string {
+	strs := make([]string, len(vts))
+	for i, vt := range vts {
+		strs[i] = typeToStr(vt)
+	}
+	return "[" + strings.Join(strs, " ") + "]"
+}
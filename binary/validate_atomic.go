@@ -0,0 +1,71 @@
+package binary
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// validateAtomicInstr types the instructions of the threads proposal
+func (cv *codeValidator) validateAtomicInstr(instr Instruction) {
+	sub := instr.SubOpcode
+	if sub == AtomicFence {
+		return
+	}
+
+	cv.requireMemory(instr)
+	if err := checkAtomicAlign(sub, instr.Args.(MemArg)); err != nil {
+		panic(err)
+	}
+
+	i32, i64 := ValTypeI32, ValTypeI64
+	vt := atomicValType(sub)
+	switch {
+	case sub == MemoryAtomicNotify:
+		cv.popVals([]ValType{i32, i32})
+		cv.pushVal(i32)
+	case sub == MemoryAtomicWait32:
+		cv.popVals([]ValType{i32, i32, i64})
+		cv.pushVal(i32)
+	case sub == MemoryAtomicWait64:
+		cv.popVals([]ValType{i32, i64, i64})
+		cv.pushVal(i32)
+	case sub < I32AtomicStore:
+		cv.popExpect(i32)
+		cv.pushVal(vt)
+	case sub < I32AtomicRmwAdd:
+		cv.popVals([]ValType{i32, vt})
+	case sub < I32AtomicRmwCmpxchg:
+		cv.popVals([]ValType{i32, vt})
+		cv.pushVal(vt)
+	default:
+		cv.popVals([]ValType{i32, vt, vt})
+		cv.pushVal(vt)
+	}
+}
+
+// atomicAccessSize returns how many bytes an atomic instruction accesses
+func atomicAccessSize(sub uint32) uint32 {
+	switch sub {
+	case MemoryAtomicNotify, MemoryAtomicWait32:
+		return 4
+	case MemoryAtomicWait64:
+		return 8
+	}
+	return [...]uint32{4, 8, 1, 2, 1, 2, 4}[(sub-I32AtomicLoad)%7]
+}
+
+// atomicValType returns the type of the value an atomic load, store or
+// read-modify-write works on
+func atomicValType(sub uint32) ValType {
+	return [...]ValType{ValTypeI32, ValTypeI64, ValTypeI32, ValTypeI32,
+		ValTypeI64, ValTypeI64, ValTypeI64}[(sub-I32AtomicLoad)%7]
+}
+
+func checkAtomicAlign(sub uint32, memArg MemArg) error {
+	natural := uint32(bits.TrailingZeros32(atomicAccessSize(sub)))
+	if memArg.Align != natural {
+		return fmt.Errorf("alignment of %s must be exactly natural 2^%d, got 2^%d",
+			atomicOpnames[sub], natural, memArg.Align)
+	}
+	return nil
+}
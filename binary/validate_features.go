@@ -0,0 +1,117 @@
+package binary
+
+import "fmt"
+
+// requireFeature panics if a proposal the module uses is not enabled
+func requireFeature(enabled bool, name string) {
+	if !enabled {
+		panic(fmt.Errorf("feature %s not enabled", name))
+	}
+}
+
+func (v *validator) requireValType(vt ValType) {
+	if info, ok := valTypes[vt]; ok && info.enabled != nil {
+		requireFeature(info.enabled(v.features), info.feature)
+	}
+}
+
+func (v *validator) requireValTypes(vts []ValType) {
+	for _, vt := range vts {
+		v.requireValType(vt)
+	}
+}
+
+// validateFeatures checks that the types and segments of the module only
+// use the enabled proposals, like the decoder does. The instructions are
+// checked by requireInstrFeature.
+func (v *validator) validateFeatures() {
+	m, f := v.module, v.features
+	for i, ft := range m.TypeSec {
+		inContext(fmt.Sprintf("type %d", i), func() {
+			if ft.Sub != 0 || ft.RecGroup.Size > 0 {
+				requireFeature(f.GC, "gc")
+			}
+			v.requireValTypes(ft.ParamTypes)
+			v.requireValTypes(ft.ResultTypes)
+			if len(ft.ResultTypes) > 1 {
+				requireFeature(f.MultiValue, "multi-value")
+			}
+		})
+	}
+	for i, tt := range v.tables {
+		inContext(fmt.Sprintf("table %d", i), func() {
+			v.requireValType(tt.ElemType)
+		})
+	}
+	for i, gt := range v.globals {
+		inContext(fmt.Sprintf("global %d", i), func() {
+			v.requireValType(gt.ValType)
+		})
+	}
+	if m.DataCountSec != nil {
+		requireFeature(f.BulkMemory, "bulk-memory")
+	}
+	for i, elem := range m.ElemSec {
+		inContext(fmt.Sprintf("elem %d", i), func() {
+			// only the encoding of MVP segments has no flags
+			if elem.Mode != ElemModeActive || elem.Table != 0 || elem.Exprs != nil {
+				requireFeature(f.BulkMemory, "bulk-memory")
+			}
+			if elem.Exprs != nil {
+				v.requireValType(elem.Type)
+			}
+		})
+	}
+	for i, data := range m.DataSec {
+		if data.Mode == DataModePassive {
+			inContext(fmt.Sprintf("data %d", i), func() {
+				requireFeature(f.BulkMemory, "bulk-memory")
+			})
+		}
+	}
+	for i, code := range m.CodeSec {
+		inContext(fmt.Sprintf("func %d", v.importedFuncCount+i), func() {
+			for _, locals := range code.Locals {
+				v.requireValType(locals.Type)
+			}
+		})
+	}
+}
+
+// requireInstrFeature checks that the proposal instr belongs to, if any,
+// is enabled
+func (v *validator) requireInstrFeature(instr Instruction) {
+	f := v.features
+	switch instr.Opcode {
+	case Block, Loop, If:
+		bt := instr.Args.(BlockType)
+		if vt, ok := bt.ValType(); ok {
+			v.requireValType(vt)
+		} else if bt >= 0 {
+			requireFeature(f.MultiValue, "multi-value")
+		}
+	case CallIndirect:
+		if instr.Args.(CallIndirectArgs).Table != 0 {
+			requireFeature(f.ReferenceTypes, "reference-types")
+		}
+	case SelectT, TableGet, TableSet, RefNull, RefIsNull, RefFunc:
+		requireFeature(f.ReferenceTypes, "reference-types")
+	case PrefixMisc:
+		switch sub := instr.SubOpcode; {
+		case sub <= I64TruncSatF64U:
+			requireFeature(f.SatConversion, "sat-conversion")
+		case sub == TableGrow || sub == TableSize || sub == TableFill:
+			requireFeature(f.ReferenceTypes, "reference-types")
+		default:
+			requireFeature(f.BulkMemory, "bulk-memory")
+		}
+	case PrefixSIMD:
+		requireFeature(f.SIMD, "simd")
+	case PrefixAtomic:
+		requireFeature(f.Threads, "threads")
+	default:
+		if instr.Opcode >= I32Extend8S && instr.Opcode <= I64Extend32S {
+			requireFeature(f.SignExtension, "sign-extension")
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package binary
+
+import "fmt"
+
+// validateSIMDInstr types SIMD instructions, the memory accesses by their
+// access size and the others by simdSigs
+func (cv *codeValidator) validateSIMDInstr(instr Instruction) {
+	i32, v128 := ValTypeI32, ValTypeV128
+
+	switch sub := instr.SubOpcode; sub {
+	case V128Load, V128Load8x8S, V128Load8x8U, V128Load16x4S, V128Load16x4U,
+		V128Load32x2S, V128Load32x2U, V128Load8Splat, V128Load16Splat,
+		V128Load32Splat, V128Load64Splat, V128Load32Zero, V128Load64Zero:
+		cv.requireMemory(instr)
+		cv.checkAlign(instr.Args.(MemArg), simdAccessSize(sub))
+		cv.popExpect(i32)
+		cv.pushVal(v128)
+	case V128Store:
+		cv.requireMemory(instr)
+		cv.checkAlign(instr.Args.(MemArg), 16)
+		cv.popVals([]ValType{i32, v128})
+	case V128Load8Lane, V128Load16Lane, V128Load32Lane, V128Load64Lane:
+		cv.requireMemory(instr)
+		cv.checkAlign(instr.Args.(MemLaneArgs).MemArg, simdAccessSize(sub))
+		cv.popVals([]ValType{i32, v128})
+		cv.pushVal(v128)
+	case V128Store8Lane, V128Store16Lane, V128Store32Lane, V128Store64Lane:
+		cv.requireMemory(instr)
+		cv.checkAlign(instr.Args.(MemLaneArgs).MemArg, simdAccessSize(sub))
+		cv.popVals([]ValType{i32, v128})
+	default:
+		sig, ok := simdSigs[sub]
+		if !ok {
+			panic(fmt.Errorf("unknown SIMD instruction: 0x%02x", sub))
+		}
+		cv.popVals(sig.params)
+		cv.pushVal(sig.result)
+	}
+}
+
+// simdAccessSize returns how many bytes a SIMD load or store accesses
+func simdAccessSize(sub uint32) uint32 {
+	switch sub {
+	case V128Load8Splat, V128Load8Lane, V128Store8Lane:
+		return 1
+	case V128Load16Splat, V128Load16Lane, V128Store16Lane:
+		return 2
+	case V128Load32Splat, V128Load32Lane, V128Store32Lane, V128Load32Zero:
+		return 4
+	case V128Load, V128Store:
+		return 16
+	default:
+		return 8
+	}
+}
+
+type simdSig struct {
+	params []ValType
+	result ValType
+}
+
+var (
+	paramsI32  = []ValType{ValTypeI32}
+	paramsI64  = []ValType{ValTypeI64}
+	paramsF32  = []ValType{ValTypeF32}
+	paramsF64  = []ValType{ValTypeF64}
+	paramsV    = []ValType{ValTypeV128}
+	paramsVV   = []ValType{ValTypeV128, ValTypeV128}
+	paramsVVV  = []ValType{ValTypeV128, ValTypeV128, ValTypeV128}
+	paramsVI32 = []ValType{ValTypeV128, ValTypeI32}
+	paramsVI64 = []ValType{ValTypeV128, ValTypeI64}
+	paramsVF32 = []ValType{ValTypeV128, ValTypeF32}
+	paramsVF64 = []ValType{ValTypeV128, ValTypeF64}
+)
+
+// simdSigs gives the operand and result types of the SIMD instructions
+// that don't access memory. i8 and i16 lanes are i32 values.
+var simdSigs = map[uint32]simdSig{
+	V128Const:                 {nil, ValTypeV128},
+	I8x16Shuffle:              {paramsVV, ValTypeV128},
+	I8x16Swizzle:              {paramsVV, ValTypeV128},
+	I8x16Splat:                {paramsI32, ValTypeV128},
+	I16x8Splat:                {paramsI32, ValTypeV128},
+	I32x4Splat:                {paramsI32, ValTypeV128},
+	I64x2Splat:                {paramsI64, ValTypeV128},
+	F32x4Splat:                {paramsF32, ValTypeV128},
+	F64x2Splat:                {paramsF64, ValTypeV128},
+	I8x16ExtractLaneS:         {paramsV, ValTypeI32},
+	I8x16ExtractLaneU:         {paramsV, ValTypeI32},
+	I8x16ReplaceLane:          {paramsVI32, ValTypeV128},
+	I16x8ExtractLaneS:         {paramsV, ValTypeI32},
+	I16x8ExtractLaneU:         {paramsV, ValTypeI32},
+	I16x8ReplaceLane:          {paramsVI32, ValTypeV128},
+	I32x4ExtractLane:          {paramsV, ValTypeI32},
+	I32x4ReplaceLane:          {paramsVI32, ValTypeV128},
+	I64x2ExtractLane:          {paramsV, ValTypeI64},
+	I64x2ReplaceLane:          {paramsVI64, ValTypeV128},
+	F32x4ExtractLane:          {paramsV, ValTypeF32},
+	F32x4ReplaceLane:          {paramsVF32, ValTypeV128},
+	F64x2ExtractLane:          {paramsV, ValTypeF64},
+	F64x2ReplaceLane:          {paramsVF64, ValTypeV128},
+	I8x16Eq:                   {paramsVV, ValTypeV128},
+	I8x16Ne:                   {paramsVV, ValTypeV128},
+	I8x16LtS:                  {paramsVV, ValTypeV128},
+	I8x16LtU:                  {paramsVV, ValTypeV128},
+	I8x16GtS:                  {paramsVV, ValTypeV128},
+	I8x16GtU:                  {paramsVV, ValTypeV128},
+	I8x16LeS:                  {paramsVV, ValTypeV128},
+	I8x16LeU:                  {paramsVV, ValTypeV128},
+	I8x16GeS:                  {paramsVV, ValTypeV128},
+	I8x16GeU:                  {paramsVV, ValTypeV128},
+	I16x8Eq:                   {paramsVV, ValTypeV128},
+	I16x8Ne:                   {paramsVV, ValTypeV128},
+	I16x8LtS:                  {paramsVV, ValTypeV128},
+	I16x8LtU:                  {paramsVV, ValTypeV128},
+	I16x8GtS:                  {paramsVV, ValTypeV128},
+	I16x8GtU:                  {paramsVV, ValTypeV128},
+	I16x8LeS:                  {paramsVV, ValTypeV128},
+	I16x8LeU:                  {paramsVV, ValTypeV128},
+	I16x8GeS:                  {paramsVV, ValTypeV128},
+	I16x8GeU:                  {paramsVV, ValTypeV128},
+	I32x4Eq:                   {paramsVV, ValTypeV128},
+	I32x4Ne:                   {paramsVV, ValTypeV128},
+	I32x4LtS:                  {paramsVV, ValTypeV128},
+	I32x4LtU:                  {paramsVV, ValTypeV128},
+	I32x4GtS:                  {paramsVV, ValTypeV128},
+	I32x4GtU:                  {paramsVV, ValTypeV128},
+	I32x4LeS:                  {paramsVV, ValTypeV128},
+	I32x4LeU:                  {paramsVV, ValTypeV128},
+	I32x4GeS:                  {paramsVV, ValTypeV128},
+	I32x4GeU:                  {paramsVV, ValTypeV128},
+	F32x4Eq:                   {paramsVV, ValTypeV128},
+	F32x4Ne:                   {paramsVV, ValTypeV128},
+	F32x4Lt:                   {paramsVV, ValTypeV128},
+	F32x4Gt:                   {paramsVV, ValTypeV128},
+	F32x4Le:                   {paramsVV, ValTypeV128},
+	F32x4Ge:                   {paramsVV, ValTypeV128},
+	F64x2Eq:                   {paramsVV, ValTypeV128},
+	F64x2Ne:                   {paramsVV, ValTypeV128},
+	F64x2Lt:                   {paramsVV, ValTypeV128},
+	F64x2Gt:                   {paramsVV, ValTypeV128},
+	F64x2Le:                   {paramsVV, ValTypeV128},
+	F64x2Ge:                   {paramsVV, ValTypeV128},
+	V128Not:                   {paramsV, ValTypeV128},
+	V128And:                   {paramsVV, ValTypeV128},
+	V128Andnot:                {paramsVV, ValTypeV128},
+	V128Or:                    {paramsVV, ValTypeV128},
+	V128Xor:                   {paramsVV, ValTypeV128},
+	V128Bitselect:             {paramsVVV, ValTypeV128},
+	V128AnyTrue:               {paramsV, ValTypeI32},
+	F32x4DemoteF64x2Zero:      {paramsV, ValTypeV128},
+	F64x2PromoteLowF32x4:      {paramsV, ValTypeV128},
+	I8x16Abs:                  {paramsV, ValTypeV128},
+	I8x16Neg:                  {paramsV, ValTypeV128},
+	I8x16Popcnt:               {paramsV, ValTypeV128},
+	I8x16AllTrue:              {paramsV, ValTypeI32},
+	I8x16Bitmask:              {paramsV, ValTypeI32},
+	I8x16NarrowI16x8S:         {paramsVV, ValTypeV128},
+	I8x16NarrowI16x8U:         {paramsVV, ValTypeV128},
+	F32x4Ceil:                 {paramsV, ValTypeV128},
+	F32x4Floor:                {paramsV, ValTypeV128},
+	F32x4Trunc:                {paramsV, ValTypeV128},
+	F32x4Nearest:              {paramsV, ValTypeV128},
+	I8x16Shl:                  {paramsVI32, ValTypeV128},
+	I8x16ShrS:                 {paramsVI32, ValTypeV128},
+	I8x16ShrU:                 {paramsVI32, ValTypeV128},
+	I8x16Add:                  {paramsVV, ValTypeV128},
+	I8x16AddSatS:              {paramsVV, ValTypeV128},
+	I8x16AddSatU:              {paramsVV, ValTypeV128},
+	I8x16Sub:                  {paramsVV, ValTypeV128},
+	I8x16SubSatS:              {paramsVV, ValTypeV128},
+	I8x16SubSatU:              {paramsVV, ValTypeV128},
+	F64x2Ceil:                 {paramsV, ValTypeV128},
+	F64x2Floor:                {paramsV, ValTypeV128},
+	I8x16MinS:                 {paramsVV, ValTypeV128},
+	I8x16MinU:                 {paramsVV, ValTypeV128},
+	I8x16MaxS:                 {paramsVV, ValTypeV128},
+	I8x16MaxU:                 {paramsVV, ValTypeV128},
+	F64x2Trunc:                {paramsV, ValTypeV128},
+	I8x16AvgrU:                {paramsVV, ValTypeV128},
+	I16x8ExtaddPairwiseI8x16S: {paramsV, ValTypeV128},
+	I16x8ExtaddPairwiseI8x16U: {paramsV, ValTypeV128},
+	I32x4ExtaddPairwiseI16x8S: {paramsV, ValTypeV128},
+	I32x4ExtaddPairwiseI16x8U: {paramsV, ValTypeV128},
+	I16x8Abs:                  {paramsV, ValTypeV128},
+	I16x8Neg:                  {paramsV, ValTypeV128},
+	I16x8Q15mulrSatS:          {paramsVV, ValTypeV128},
+	I16x8AllTrue:              {paramsV, ValTypeI32},
+	I16x8Bitmask:              {paramsV, ValTypeI32},
+	I16x8NarrowI32x4S:         {paramsVV, ValTypeV128},
+	I16x8NarrowI32x4U:         {paramsVV, ValTypeV128},
+	I16x8ExtendLowI8x16S:      {paramsV, ValTypeV128},
+	I16x8ExtendHighI8x16S:     {paramsV, ValTypeV128},
+	I16x8ExtendLowI8x16U:      {paramsV, ValTypeV128},
+	I16x8ExtendHighI8x16U:     {paramsV, ValTypeV128},
+	I16x8Shl:                  {paramsVI32, ValTypeV128},
+	I16x8ShrS:                 {paramsVI32, ValTypeV128},
+	I16x8ShrU:                 {paramsVI32, ValTypeV128},
+	I16x8Add:                  {paramsVV, ValTypeV128},
+	I16x8AddSatS:              {paramsVV, ValTypeV128},
+	I16x8AddSatU:              {paramsVV, ValTypeV128},
+	I16x8Sub:                  {paramsVV, ValTypeV128},
+	I16x8SubSatS:              {paramsVV, ValTypeV128},
+	I16x8SubSatU:              {paramsVV, ValTypeV128},
+	F64x2Nearest:              {paramsV, ValTypeV128},
+	I16x8Mul:                  {paramsVV, ValTypeV128},
+	I16x8MinS:                 {paramsVV, ValTypeV128},
+	I16x8MinU:                 {paramsVV, ValTypeV128},
+	I16x8MaxS:                 {paramsVV, ValTypeV128},
+	I16x8MaxU:                 {paramsVV, ValTypeV128},
+	I16x8AvgrU:                {paramsVV, ValTypeV128},
+	I16x8ExtmulLowI8x16S:      {paramsVV, ValTypeV128},
+	I16x8ExtmulHighI8x16S:     {paramsVV, ValTypeV128},
+	I16x8ExtmulLowI8x16U:      {paramsVV, ValTypeV128},
+	I16x8ExtmulHighI8x16U:     {paramsVV, ValTypeV128},
+	I32x4Abs:                  {paramsV, ValTypeV128},
+	I32x4Neg:                  {paramsV, ValTypeV128},
+	I32x4AllTrue:              {paramsV, ValTypeI32},
+	I32x4Bitmask:              {paramsV, ValTypeI32},
+	I32x4ExtendLowI16x8S:      {paramsV, ValTypeV128},
+	I32x4ExtendHighI16x8S:     {paramsV, ValTypeV128},
+	I32x4ExtendLowI16x8U:      {paramsV, ValTypeV128},
+	I32x4ExtendHighI16x8U:     {paramsV, ValTypeV128},
+	I32x4Shl:                  {paramsVI32, ValTypeV128},
+	I32x4ShrS:                 {paramsVI32, ValTypeV128},
+	I32x4ShrU:                 {paramsVI32, ValTypeV128},
+	I32x4Add:                  {paramsVV, ValTypeV128},
+	I32x4Sub:                  {paramsVV, ValTypeV128},
+	I32x4Mul:                  {paramsVV, ValTypeV128},
+	I32x4MinS:                 {paramsVV, ValTypeV128},
+	I32x4MinU:                 {paramsVV, ValTypeV128},
+	I32x4MaxS:                 {paramsVV, ValTypeV128},
+	I32x4MaxU:                 {paramsVV, ValTypeV128},
+	I32x4DotI16x8S:            {paramsVV, ValTypeV128},
+	I32x4ExtmulLowI16x8S:      {paramsVV, ValTypeV128},
+	I32x4ExtmulHighI16x8S:     {paramsVV, ValTypeV128},
+	I32x4ExtmulLowI16x8U:      {paramsVV, ValTypeV128},
+	I32x4ExtmulHighI16x8U:     {paramsVV, ValTypeV128},
+	I64x2Abs:                  {paramsV, ValTypeV128},
+	I64x2Neg:                  {paramsV, ValTypeV128},
+	I64x2AllTrue:              {paramsV, ValTypeI32},
+	I64x2Bitmask:              {paramsV, ValTypeI32},
+	I64x2ExtendLowI32x4S:      {paramsV, ValTypeV128},
+	I64x2ExtendHighI32x4S:     {paramsV, ValTypeV128},
+	I64x2ExtendLowI32x4U:      {paramsV, ValTypeV128},
+	I64x2ExtendHighI32x4U:     {paramsV, ValTypeV128},
+	I64x2Shl:                  {paramsVI32, ValTypeV128},
+	I64x2ShrS:                 {paramsVI32, ValTypeV128},
+	I64x2ShrU:                 {paramsVI32, ValTypeV128},
+	I64x2Add:                  {paramsVV, ValTypeV128},
+	I64x2Sub:                  {paramsVV, ValTypeV128},
+	I64x2Mul:                  {paramsVV, ValTypeV128},
+	I64x2Eq:                   {paramsVV, ValTypeV128},
+	I64x2Ne:                   {paramsVV, ValTypeV128},
+	I64x2LtS:                  {paramsVV, ValTypeV128},
+	I64x2GtS:                  {paramsVV, ValTypeV128},
+	I64x2LeS:                  {paramsVV, ValTypeV128},
+	I64x2GeS:                  {paramsVV, ValTypeV128},
+	I64x2ExtmulLowI32x4S:      {paramsVV, ValTypeV128},
+	I64x2ExtmulHighI32x4S:     {paramsVV, ValTypeV128},
+	I64x2ExtmulLowI32x4U:      {paramsVV, ValTypeV128},
+	I64x2ExtmulHighI32x4U:     {paramsVV, ValTypeV128},
+	F32x4Abs:                  {paramsV, ValTypeV128},
+	F32x4Neg:                  {paramsV, ValTypeV128},
+	F32x4Sqrt:                 {paramsV, ValTypeV128},
+	F32x4Add:                  {paramsVV, ValTypeV128},
+	F32x4Sub:                  {paramsVV, ValTypeV128},
+	F32x4Mul:                  {paramsVV, ValTypeV128},
+	F32x4Div:                  {paramsVV, ValTypeV128},
+	F32x4Min:                  {paramsVV, ValTypeV128},
+	F32x4Max:                  {paramsVV, ValTypeV128},
+	F32x4Pmin:                 {paramsVV, ValTypeV128},
+	F32x4Pmax:                 {paramsVV, ValTypeV128},
+	F64x2Abs:                  {paramsV, ValTypeV128},
+	F64x2Neg:                  {paramsV, ValTypeV128},
+	F64x2Sqrt:                 {paramsV, ValTypeV128},
+	F64x2Add:                  {paramsVV, ValTypeV128},
+	F64x2Sub:                  {paramsVV, ValTypeV128},
+	F64x2Mul:                  {paramsVV, ValTypeV128},
+	F64x2Div:                  {paramsVV, ValTypeV128},
+	F64x2Min:                  {paramsVV, ValTypeV128},
+	F64x2Max:                  {paramsVV, ValTypeV128},
+	F64x2Pmin:                 {paramsVV, ValTypeV128},
+	F64x2Pmax:                 {paramsVV, ValTypeV128},
+	I32x4TruncSatF32x4S:       {paramsV, ValTypeV128},
+	I32x4TruncSatF32x4U:       {paramsV, ValTypeV128},
+	F32x4ConvertI32x4S:        {paramsV, ValTypeV128},
+	F32x4ConvertI32x4U:        {paramsV, ValTypeV128},
+	I32x4TruncSatF64x2SZero:   {paramsV, ValTypeV128},
+	I32x4TruncSatF64x2UZero:   {paramsV, ValTypeV128},
+	F64x2ConvertLowI32x4S:     {paramsV, ValTypeV128},
+	F64x2ConvertLowI32x4U:     {paramsV, ValTypeV128},
+}
@@ -0,0 +1,548 @@
+package binary
+
+import (
+	"strings"
+	"testing"
+)
+
+func i32Const(v int32) Instruction {
+	return Instruction{Opcode: I32Const, Args: v}
+}
+
+func misc(sub uint32, args interface{}) Instruction {
+	return Instruction{Opcode: PrefixMisc, SubOpcode: sub, Args: args}
+}
+
+// voidModule returns a module with a memory and one function of type
+// [] -> [] with the given body, the final end added
+func voidModule(body ...Instruction) Module {
+	return Module{
+		TypeSec: []FuncType{{Tag: FtTag}},
+		FuncSec: []TypeIdx{0},
+		MemSec:  []MemType{{Min: 1}},
+		CodeSec: []Code{{Expr: append(body, Instruction{Opcode: End})}},
+	}
+}
+
+// wantError checks that err is not nil and mentions want
+func wantError(t *testing.T, err error, want string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("got no error, want %q", want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("got error %q, want %q", err, want)
+	}
+}
+
+func TestDecodeDataIdxAgainstDataCount(t *testing.T) {
+	body := []byte{0, 0x41, 0, 0x41, 0, 0x41, 0, PrefixMisc, MemoryInit, 1, 0, End}
+	data := wasm(
+		sec(SecTypeID, 1, FtTag, 0, 0),
+		sec(SecFuncID, 1, 0),
+		sec(SecMemID, 1, 0, 1),
+		sec(SecDataCountID, 1),
+		sec(SecCodeID, append([]byte{1, byte(len(body))}, body...)...),
+		sec(SecDataID, 1, 1, 0),
+	)
+	_, err := Decode(data)
+	wantError(t, err, "unknown data segment 1 (data count: 1)")
+}
+
+func TestValidateDataIdxAgainstDataCount(t *testing.T) {
+	count := uint32(1)
+	m := voidModule(i32Const(0), i32Const(0), i32Const(0), misc(MemoryInit, uint32(1)))
+	m.DataCountSec = &count
+	m.DataSec = []Data{{Mode: DataModePassive}}
+	wantError(t, m.Validate(), "unknown data segment 1 (data count: 1)")
+
+	m = voidModule(misc(DataDrop, uint32(0)))
+	m.DataSec = []Data{{Mode: DataModePassive}}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("data.drop 0 of 1 segment: %v", err)
+	}
+}
+
+func TestSIMDSigsCoverOpnames(t *testing.T) {
+	for sub, name := range simdOpnames {
+		_, typed := simdSigs[sub]
+		memory := strings.HasPrefix(name, "v128.load") || strings.HasPrefix(name, "v128.store")
+		if typed == memory {
+			t.Errorf("%s (0x%02x): got typed by simdSigs %v, want %v", name, sub, typed, !memory)
+		}
+	}
+	for sub := range simdSigs {
+		if _, ok := simdOpnames[sub]; !ok {
+			t.Errorf("simdSigs types unknown instruction 0x%02x", sub)
+		}
+	}
+}
+
+func TestValidateSIMD(t *testing.T) {
+	simd := func(sub uint32, args interface{}) Instruction {
+		return Instruction{Opcode: PrefixSIMD, SubOpcode: sub, Args: args}
+	}
+	drop := Instruction{Opcode: Drop}
+	v128 := simd(V128Const, V128{})
+	tests := []struct {
+		name string
+		body []Instruction
+		err  string
+	}{
+		{"splat", []Instruction{{Opcode: I64Const, Args: int64(1)}, simd(I64x2Splat, nil), drop}, ""},
+		{"splat of wrong type", []Instruction{i32Const(1), simd(I64x2Splat, nil), drop}, "type mismatch"},
+		{"extract_lane", []Instruction{v128, simd(F32x4ExtractLane, byte(3)), {Opcode: F32Neg}, drop}, ""},
+		{"bitselect", []Instruction{v128, v128, v128, simd(V128Bitselect, nil), drop}, ""},
+		{"bitselect of two", []Instruction{v128, v128, simd(V128Bitselect, nil), drop}, "type mismatch"},
+		{"shift", []Instruction{v128, i32Const(1), simd(I16x8Shl, nil), drop}, ""},
+		{"bitmask", []Instruction{v128, simd(I32x4Bitmask, nil), {Opcode: I32Eqz}, drop}, ""},
+		{"load", []Instruction{i32Const(0), simd(V128Load16x4S, MemArg{Align: 3}), drop}, ""},
+		{"overaligned load", []Instruction{i32Const(0), simd(V128Load16x4S, MemArg{Align: 4}), drop}, "alignment"},
+	}
+	for _, tt := range tests {
+		err := voidModule(tt.body...).Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: got error %v, want none", tt.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestValidateIfElse(t *testing.T) {
+	ifI32 := Instruction{Opcode: If, Args: BlockTypeI32}
+	els := Instruction{Opcode: Else}
+	end := Instruction{Opcode: End}
+	drop := Instruction{Opcode: Drop}
+	f32 := Instruction{Opcode: F32Const, Args: float32(0)}
+	tests := []struct {
+		name string
+		body []Instruction
+		err  string
+	}{
+		{"both arms", []Instruction{i32Const(1), ifI32, i32Const(2), els, i32Const(3), end, drop}, ""},
+		{"no else", []Instruction{i32Const(1), {Opcode: If, Args: BlockTypeEmpty}, {Opcode: Nop}, end}, ""},
+		{"no else with result", []Instruction{i32Const(1), ifI32, i32Const(2), end, drop}, "type mismatch"},
+		{"else of wrong type", []Instruction{i32Const(1), ifI32, i32Const(2), els, f32, end, drop}, "type mismatch"},
+		{"then missing result", []Instruction{i32Const(1), ifI32, els, i32Const(3), end, drop}, "type mismatch"},
+		{"no condition", []Instruction{ifI32, i32Const(2), els, i32Const(3), end, drop}, "type mismatch"},
+	}
+	for _, tt := range tests {
+		err := voidModule(tt.body...).Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: got error %v, want none", tt.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestValidateGlobalInitOrder(t *testing.T) {
+	const0 := GlobalType{ValType: ValTypeI32, Mut: MutConst}
+	getGlobal := func(idx uint32) Expr {
+		return Expr{{Opcode: GlobalGet, Args: idx}, {Opcode: End}}
+	}
+	m := Module{
+		ImportSec: []Import{{Module: "env", Name: "g", Desc: ImportDesc{Tag: ImportTagGlobal, Global: const0}}},
+		GlobalSec: []Global{{Type: const0, Init: getGlobal(0)}},
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("global 1 reading imported global 0: got error %v, want none", err)
+	}
+	m.GlobalSec = []Global{
+		{Type: const0, Init: getGlobal(2)},
+		{Type: const0, Init: Expr{i32Const(1), {Opcode: End}}},
+	}
+	wantError(t, m.Validate(), "global 1: constant expression reads global 2 before it is initialized")
+}
+
+func TestAtomicAlign(t *testing.T) {
+	tests := []struct {
+		sub     uint32
+		natural uint32
+		body    []Instruction // operands
+	}{
+		{I32AtomicLoad, 2, []Instruction{i32Const(0)}},
+		{I32AtomicLoad + 1, 3, []Instruction{i32Const(0)}},                // i64.atomic.load
+		{I32AtomicStore + 2, 0, []Instruction{i32Const(0), i32Const(0)}},  // i32.atomic.store8
+		{I32AtomicRmwAdd + 3, 1, []Instruction{i32Const(0), i32Const(0)}}, // i32.atomic.rmw16.add_u
+		{I64AtomicRmw32CmpxchgU, 2, []Instruction{i32Const(0), {Opcode: I64Const, Args: int64(0)}, {Opcode: I64Const, Args: int64(0)}}},
+		{MemoryAtomicNotify, 2, []Instruction{i32Const(0), i32Const(0)}},
+		{MemoryAtomicWait64, 3, []Instruction{i32Const(0), {Opcode: I64Const, Args: int64(0)}, {Opcode: I64Const, Args: int64(0)}}},
+	}
+	for _, tt := range tests {
+		name := atomicOpnames[tt.sub]
+		for _, align := range []uint32{0, 1, 2, 3, 4} {
+			// the decoder checks the alignment without typing the operands
+			_, decodeErr := decodeBody(PrefixAtomic, byte(tt.sub), byte(align), 0, End)
+			body := append(append([]Instruction{}, tt.body...),
+				Instruction{Opcode: PrefixAtomic, SubOpcode: tt.sub, Args: MemArg{Align: align}})
+			if tt.sub < I32AtomicStore || tt.sub >= I32AtomicRmwAdd {
+				// loads, read-modify-writes, notify and wait have a result
+				body = append(body, Instruction{Opcode: Drop})
+			}
+			validateErr := voidModule(body...).Validate()
+			if align == tt.natural {
+				if decodeErr != nil || validateErr != nil {
+					t.Errorf("%s align %d: got errors %v and %v, want none", name, align, decodeErr, validateErr)
+				}
+				continue
+			}
+			for _, err := range []error{decodeErr, validateErr} {
+				if err == nil || !strings.Contains(err.Error(), "must be exactly natural") {
+					t.Errorf("%s align %d: got error %v, want an alignment error", name, align, err)
+				}
+			}
+		}
+	}
+}
+
+func TestValidateCustomSecNames(t *testing.T) {
+	m := voidModule()
+	m.CustomSecs = []CustomSec{{Name: "producers"}, {Name: "producers"}, {Name: "name"}}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("repeated custom sections: got error %v, want none", err)
+	}
+	m.CustomSecs = append(m.CustomSecs, CustomSec{Name: "name"})
+	wantError(t, m.Validate(), "2 name sections, at most one is allowed")
+	m.CustomSecs = []CustomSec{{Name: "\xff"}}
+	wantError(t, m.Validate(), "malformed UTF-8")
+}
+
+func TestValidateMVPOnly(t *testing.T) {
+	i64 := Instruction{Opcode: I64Const, Args: int64(0)}
+	v128 := Instruction{Opcode: PrefixSIMD, SubOpcode: V128Const, Args: V128{}}
+	drop := Instruction{Opcode: Drop}
+	withTypes := func(m Module, ft FuncType) Module {
+		m.TypeSec = append(m.TypeSec, ft)
+		return m
+	}
+	passiveData := voidModule()
+	passiveData.DataSec = []Data{{Mode: DataModePassive}}
+	tests := []struct {
+		name    string
+		m       Module
+		feature string
+	}{
+		{"simd", voidModule(v128, drop), "simd"},
+		{"v128 local", func() Module {
+			m := voidModule()
+			m.CodeSec[0].Locals = []Locals{{N: 1, Type: ValTypeV128}}
+			return m
+		}(), "simd"},
+		{"memory.copy", voidModule(i32Const(0), i32Const(0), i32Const(0), misc(MemoryCopy, nil)), "bulk-memory"},
+		{"passive data", passiveData, "bulk-memory"},
+		{"atomic", voidModule(i32Const(0), Instruction{Opcode: PrefixAtomic, SubOpcode: I32AtomicLoad, Args: MemArg{Align: 2}}, drop), "threads"},
+		{"ref.null", voidModule(Instruction{Opcode: RefNull, Args: byte(ExternRef)}, drop), "reference-types"},
+		{"externref param", withTypes(voidModule(), FuncType{Tag: FtTag, ParamTypes: []ValType{ExternRef}}), "reference-types"},
+		{"multi-value", withTypes(voidModule(), FuncType{Tag: FtTag, ResultTypes: []ValType{ValTypeI32, ValTypeI32}}), "multi-value"},
+		{"block type index", voidModule(Instruction{Opcode: Block, Args: BlockType(0)}, Instruction{Opcode: End}), "multi-value"},
+		{"sign-extension", voidModule(i64, Instruction{Opcode: I64Extend32S}, drop), "sign-extension"},
+		{"sat-conversion", voidModule(Instruction{Opcode: F32Const, Args: float32(0)}, misc(I32TruncSatF32S, nil), drop), "sat-conversion"},
+	}
+	for _, tt := range tests {
+		if err := tt.m.Validate(); err != nil {
+			t.Errorf("%s: got error %v with all features, want none", tt.name, err)
+		}
+		err := tt.m.ValidateWithFeatures(Features{})
+		want := "feature " + tt.feature + " not enabled"
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, want)
+		}
+	}
+	if err := voidModule(i32Const(0), drop).ValidateWithFeatures(Features{}); err != nil {
+		t.Errorf("MVP module: got error %v, want none", err)
+	}
+}
+
+// TestValidateConstExprIndices checks that any global or function index
+// is accepted without a module, however large
+func TestValidateConstExprIndices(t *testing.T) {
+	end := Instruction{Opcode: End}
+	const idx uint32 = 0xFFFFFFFF
+	tests := []struct {
+		expr     Expr
+		expected ValType
+	}{
+		{Expr{{Opcode: GlobalGet, Args: idx}, end}, ValTypeI64},
+		{Expr{{Opcode: RefFunc, Args: idx}, end}, FuncRef},
+	}
+	for _, tt := range tests {
+		allocs := testing.AllocsPerRun(1, func() {
+			if err := ValidateConstExpr(tt.expr, tt.expected, AllFeatures()); err != nil {
+				t.Fatalf("%s: got error %v, want none", tt.expr[0].GetOpname(), err)
+			}
+		})
+		if allocs > 100 {
+			t.Fatalf("%s: got %v allocations, want a few", tt.expr[0].GetOpname(), allocs)
+		}
+	}
+	err := ValidateConstExpr(Expr{{Opcode: GlobalGet, Args: idx}, end}, ValTypeI32, Features{})
+	if err != nil {
+		t.Fatalf("got error %v for an MVP global.get, want none", err)
+	}
+}
+
+func TestValidateMemTypeBoundary(t *testing.T) {
+	tests := []struct {
+		mt MemType
+		ok bool
+	}{
+		{MemType{Min: MaxMemPages}, true},
+		{MemType{Tag: 1, Max: MaxMemPages}, true},
+		{MemType{Min: MaxMemPages + 1}, false},
+		{MemType{Tag: 1, Max: MaxMemPages + 1}, false},
+	}
+	for _, tt := range tests {
+		defined := Module{MemSec: []MemType{tt.mt}}
+		imported := Module{ImportSec: []Import{{Module: "m", Name: "m", Desc: ImportDesc{Tag: ImportTagMem, Mem: tt.mt}}}}
+		for _, m := range []Module{defined, imported} {
+			err := m.Validate()
+			if tt.ok && err != nil {
+				t.Fatalf("%v: got error %v, want none", tt.mt, err)
+			}
+			if !tt.ok {
+				wantError(t, err, "memory size must be at most 65536 pages")
+			}
+		}
+	}
+}
+
+func TestValidateBlockTypeIndex(t *testing.T) {
+	end := Instruction{Opcode: End}
+	tests := []struct {
+		name string
+		body []Instruction
+		err  string
+	}{
+		{"block of type 0", []Instruction{{Opcode: Block, Args: BlockType(0)}, end}, ""},
+		{"block of type 1", []Instruction{i32Const(1), {Opcode: Block, Args: BlockType(1)}, end, {Opcode: Drop}}, ""},
+		{"block of unknown type", []Instruction{{Opcode: Block, Args: BlockType(2)}, end},
+			"block type refers to unknown type 2 (2 types in module)"},
+		{"loop of unknown type", []Instruction{{Opcode: Loop, Args: BlockType(1 << 32)}, end},
+			"block type refers to unknown type 4294967296"},
+		{"if of unknown type", []Instruction{i32Const(1), {Opcode: If, Args: BlockType(2)}, end},
+			"block type refers to unknown type 2"},
+	}
+	for _, tt := range tests {
+		m := voidModule(tt.body...)
+		m.TypeSec = append(m.TypeSec, FuncType{Tag: FtTag, ParamTypes: []ValType{ValTypeI32}, ResultTypes: []ValType{ValTypeI32}})
+		err := m.Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Fatalf("%s: got error %v, want none", tt.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+// TestValidatePolymorphicStack runs the cases of the spec's
+// unreached-valid and unreached-invalid tests: after unreachable any
+// operand can be popped, but only from the current block
+func TestValidatePolymorphicStack(t *testing.T) {
+	unreachable := Instruction{Opcode: Unreachable}
+	drop := Instruction{Opcode: Drop}
+	sel := Instruction{Opcode: Select}
+	end := Instruction{Opcode: End}
+	block := Instruction{Opcode: Block, Args: BlockTypeEmpty}
+	i64 := Instruction{Opcode: I64Const, Args: int64(0)}
+	f32 := Instruction{Opcode: F32Const, Args: float32(0)}
+	refNull := Instruction{Opcode: RefNull, Args: byte(FuncRef)}
+	tests := []struct {
+		name string
+		body []Instruction
+		err  string
+	}{
+		{"drop drop", []Instruction{unreachable, drop, drop}, ""},
+		{"select", []Instruction{unreachable, sel, drop}, ""},
+		{"select of i32", []Instruction{unreachable, i32Const(0), sel, drop}, ""},
+		{"select of i64", []Instruction{unreachable, i64, i32Const(1), sel, {Opcode: I64Eqz}, drop}, ""},
+		{"select of i64 and unknown", []Instruction{unreachable, i64, sel, drop}, "type mismatch: expected i32, got i64"},
+		{"binary op", []Instruction{unreachable, {Opcode: I32Add}, drop}, ""},
+		{"binary op with one operand", []Instruction{unreachable, i32Const(0), {Opcode: I32Add}, drop}, ""},
+		{"binary op on wrong type", []Instruction{unreachable, i64, {Opcode: I32Add}}, "type mismatch: expected i32, got i64"},
+		{"br_table", []Instruction{unreachable, {Opcode: BrTable, Args: BrTableArgs{Labels: []LabelIdx{0}}}}, ""},
+		{"br after unreachable", []Instruction{unreachable, {Opcode: Br, Args: uint32(0)}, {Opcode: I32Add}, drop}, ""},
+		{"select of different types", []Instruction{unreachable, f32, i64, i32Const(1), sel}, "type mismatch: select operands"},
+		{"select of references", []Instruction{unreachable, refNull, refNull, i32Const(1), sel, drop}, "select without type on reference types"},
+		{"extra value", []Instruction{unreachable, i32Const(0)}, "type mismatch: 1 extra values"},
+		{"drop in new block", []Instruction{unreachable, block, drop, end}, "operand stack underflow"},
+		{"drop after block", []Instruction{block, unreachable, end, drop}, "operand stack underflow"},
+	}
+	for _, tt := range tests {
+		err := voidModule(tt.body...).Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Fatalf("%s: got error %v, want none", tt.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestValidateConstInits(t *testing.T) {
+	end := Instruction{Opcode: End}
+	i64 := Instruction{Opcode: I64Const, Args: int64(0)}
+	global := func(vt ValType, init ...Instruction) Global {
+		return Global{Type: GlobalType{ValType: vt}, Init: append(init, end)}
+	}
+	tests := []struct {
+		name   string
+		modify func(m *Module)
+		err    string
+	}{
+		{"i32 global", func(m *Module) { m.GlobalSec = []Global{global(ValTypeI32, i32Const(1))} }, ""},
+		{"global of the wrong type", func(m *Module) { m.GlobalSec = []Global{global(ValTypeI32, i64)} },
+			"type mismatch: expected i32, got i64"},
+		{"non-constant global", func(m *Module) {
+			m.GlobalSec = []Global{global(ValTypeI32, i32Const(1), i32Const(2), Instruction{Opcode: I32DivS})}
+		}, "constant expression required, got i32.div_s"},
+		{"global without value", func(m *Module) { m.GlobalSec = []Global{global(ValTypeI32)} },
+			"operand stack underflow"},
+		{"global with two values", func(m *Module) { m.GlobalSec = []Global{global(ValTypeI32, i32Const(1), i32Const(2))} },
+			"1 extra values"},
+		{"i64 data offset", func(m *Module) { m.DataSec = []Data{{Offset: Expr{i64, end}}} },
+			"type mismatch: expected i32, got i64"},
+		{"i64 elem offset", func(m *Module) {
+			m.TableSec = []TableType{{ElemType: FuncRef, Limits: Limits{Min: 1}}}
+			m.ElemSec = []Elem{{Type: FuncRef, Offset: Expr{i64, end}, Init: []FuncIdx{0}}}
+		}, "type mismatch: expected i32, got i64"},
+		{"local.get in data offset", func(m *Module) {
+			m.DataSec = []Data{{Offset: Expr{{Opcode: LocalGet, Args: uint32(0)}, end}}}
+		}, "constant expression required, got local.get"},
+	}
+	for _, tt := range tests {
+		m := voidModule()
+		tt.modify(&m)
+		err := m.Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Fatalf("%s: got error %v, want none", tt.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestValidateLimits(t *testing.T) {
+	table := func(l Limits) Module {
+		return Module{TableSec: []TableType{{ElemType: FuncRef, Limits: l}}}
+	}
+	importedTable := func(l Limits) Module {
+		return Module{ImportSec: []Import{{Module: "m", Name: "t",
+			Desc: ImportDesc{Tag: ImportTagTable, Table: TableType{ElemType: FuncRef, Limits: l}}}}}
+	}
+	mem := func(l Limits) Module { return Module{MemSec: []MemType{l}} }
+	tests := []struct {
+		name string
+		m    Module
+		err  string
+	}{
+		{"memory min = max", mem(Limits{Tag: 1, Min: 3, Max: 3}), ""},
+		{"memory min > max", mem(Limits{Tag: 1, Min: 10, Max: 1}), "size minimum 10 must not be greater than maximum 1"},
+		{"table without max", table(Limits{Min: 2}), ""},
+		{"table min > max", table(Limits{Tag: 1, Min: 2, Max: 1}), "size minimum 2 must not be greater than maximum 1"},
+		{"imported table min > max", importedTable(Limits{Tag: 1, Min: 2, Max: 1}),
+			"size minimum 2 must not be greater than maximum 1"},
+	}
+	for _, tt := range tests {
+		err := tt.m.Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Fatalf("%s: got error %v, want none", tt.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestValidateStart(t *testing.T) {
+	tests := []struct {
+		name  string
+		start FuncIdx
+		err   string
+	}{
+		{"void function", 1, ""},
+		{"imported function with a parameter", 0, "start function 0 must have type [] -> [], got [i32] -> []"},
+		{"function with a result", 2, "start function 2 must have type [] -> [], got [] -> [i64]"},
+		{"unknown function", 3, "unknown start function 3"},
+	}
+	for _, tt := range tests {
+		m := voidModule()
+		m.TypeSec = append(m.TypeSec,
+			FuncType{Tag: FtTag, ParamTypes: []ValType{ValTypeI32}},
+			FuncType{Tag: FtTag, ResultTypes: []ValType{ValTypeI64}})
+		m.ImportSec = []Import{{Module: "m", Name: "f", Desc: ImportDesc{Tag: ImportTagFunc, FuncType: 1}}}
+		m.FuncSec = append(m.FuncSec, 2)
+		m.CodeSec = append(m.CodeSec, Code{Expr: Expr{{Opcode: I64Const, Args: int64(0)}, {Opcode: End}}})
+		start := tt.start
+		m.StartSec = &start
+		err := m.Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Fatalf("%s: got error %v, want none", tt.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+// TestValidateElemTypes checks that element segments are only copied into
+// tables of their type
+func TestValidateElemTypes(t *testing.T) {
+	ext := ValType(ExternRef)
+	nullExtern := Expr{{Opcode: RefNull, Args: byte(ExternRef)}, {Opcode: End}}
+	passive := func(vt ValType) Elem {
+		if vt == FuncRef {
+			return Elem{Mode: ElemModePassive, Type: FuncRef, Init: []FuncIdx{0}}
+		}
+		return Elem{Mode: ElemModePassive, Type: vt, Exprs: []Expr{nullExtern}}
+	}
+	tableInit := misc(TableInit, TableInitArgs{Elem: 0, Table: 0})
+	tests := []struct {
+		name  string
+		table ValType
+		elem  Elem
+		err   string
+	}{
+		{"externref into externref", ext, passive(ext), ""},
+		{"funcref into funcref", FuncRef, passive(FuncRef), ""},
+		{"externref into funcref", FuncRef, passive(ext), "type mismatch: elem segment 0 holds externref, table holds funcref"},
+		{"funcref into externref", ext, passive(FuncRef), "type mismatch: elem segment 0 holds funcref, table holds externref"},
+		{"active externref into funcref", FuncRef,
+			Elem{Type: ext, Offset: Expr{i32Const(0), {Opcode: End}}, Exprs: []Expr{nullExtern}},
+			"type mismatch: externref entries in table 0 of funcref"},
+	}
+	for _, tt := range tests {
+		m := voidModule(i32Const(0), i32Const(0), i32Const(0), tableInit)
+		m.TableSec = []TableType{{ElemType: tt.table, Limits: Limits{Min: 1}}}
+		m.ElemSec = []Elem{tt.elem}
+		err := m.Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Fatalf("%s: got error %v, want none", tt.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestValidateDataMemory(t *testing.T) {
+	active := Module{DataSec: []Data{{Offset: Expr{{Opcode: I32Const, Args: int32(0)}, {Opcode: End}}}}}
+	wantError(t, active.Validate(), "data 0: unknown memory 0")
+	passive := Module{DataSec: []Data{{Mode: DataModePassive}}}
+	if err := passive.Validate(); err != nil {
+		t.Fatalf("got error %v for a passive segment without memory, want none", err)
+	}
+}
@@ -0,0 +1,605 @@
+package binary
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+type wasmWriter struct {
+	data []byte
+	opts EncodeOptions
+}
+
+// EncodeOptions controls where Encode puts the sections that the spec
+// leaves free. The zero value writes the data count section if the module
+// has one and the custom sections after all the others.
+type EncodeOptions struct {
+	// CustomSecsAfter maps custom section names to the id of the section
+	// they are written after, SecCustomID puts them before all sections.
+	// The custom sections placed after the same section keep their order.
+	CustomSecsAfter map[string]byte
+	DataCount       DataCountMode
+}
+
+type DataCountMode int
+
+const (
+	DataCountAsIs   DataCountMode = iota // write Module.DataCountSec if not nil
+	DataCountAlways                      // write the number of data segments
+	DataCountNever
+)
+
+func Encode(module Module) (data []byte, err error) {
+	return EncodeWithOptions(module, EncodeOptions{})
+}
+
+func EncodeFile(filename string, module Module) error {
+	data, err := Encode(module)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+func EncodeWithOptions(module Module, opts EncodeOptions) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	checkEncodeOptions(module, opts)
+	writer := &wasmWriter{opts: opts}
+	writer.writeModule(module)
+
+	return writer.data, nil
+}
+
+func (writer *wasmWriter) writeByte(b byte) {
+	writer.data = append(writer.data, b)
+}
+
+func (writer *wasmWriter) writeU32(n uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], n)
+	writer.data = append(writer.data, buf[:]...)
+}
+
+func (writer *wasmWriter) writeU64(n uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], n)
+	writer.data = append(writer.data, buf[:]...)
+}
+
+func (writer *wasmWriter) writeF32(f float32) {
+	writer.writeU32(math.Float32bits(f))
+}
+
+func (writer *wasmWriter) writeF64(f float64) {
+	writer.writeU64(math.Float64bits(f))
+}
+
+func (writer *wasmWriter) writeVarU32(n uint32) {
+	writer.data = append(writer.data, encodeVarUint(uint64(n))...)
+}
+
+func (writer *wasmWriter) writeVarU64(n uint64) {
+	writer.data = append(writer.data, encodeVarUint(n)...)
+}
+
+func (writer *wasmWriter) writeVarS32(n int32) {
+	writer.data = append(writer.data, encodeVarInt(int64(n))...)
+}
+
+func (writer *wasmWriter) writeVarS64(n int64) {
+	writer.data = append(writer.data, encodeVarInt(n)...)
+}
+
+func (writer *wasmWriter) writeBytes(bytes []byte) {
+	writer.writeVarU32(uint32(len(bytes)))
+	writer.data = append(writer.data, bytes...)
+}
+
+func (writer *wasmWriter) writeName(name string) {
+	writer.writeBytes([]byte(name))
+}
+
+func (writer *wasmWriter) writeModule(module Module) {
+	writer.writeU32(MagicNumber)
+	writer.writeU32(Version)
+	writer.writeSections(module)
+}
+
+// checkEncodeOptions checks that opts keep the known sections in order and
+// don't drop a data count section the code needs
+func checkEncodeOptions(module Module, opts EncodeOptions) {
+	for name, secID := range opts.CustomSecsAfter {
+		if secID > SecDataCountID {
+			panic(fmt.Errorf("custom section %q placed after unknown section %d", name, secID))
+		}
+	}
+	if opts.DataCount == DataCountNever {
+		for _, code := range module.CodeSec {
+			for _, instr := range code.Expr {
+				if instr.Opcode == PrefixMisc &&
+					(instr.SubOpcode == MemoryInit || instr.SubOpcode == DataDrop) {
+					panic(fmt.Errorf("%s needs the data count section", instr.GetOpname()))
+				}
+			}
+		}
+	}
+}
+
+func (writer *wasmWriter) writeSections(module Module) {
+	writer.writeCustomSecsAfter(module, SecCustomID)
+	for _, secID := range []byte{SecTypeID, SecImportID, SecFuncID, SecTableID,
+		SecMemID, SecGlobalID, SecExportID, SecStartID, SecElemID} {
+		writer.writeSecOrRaw(module, secID)
+	}
+	// DataCount 段的 id 是 12, 但要写在 Element 段和 Code 段之间
+	if writer.opts.DataCount == DataCountAlways && module.DataCountSec == nil {
+		dataCount := uint32(len(module.DataSec))
+		module.DataCountSec = &dataCount
+	}
+	if writer.opts.DataCount == DataCountNever {
+		writer.writeCustomSecsAfter(module, SecDataCountID)
+	} else {
+		writer.writeSecOrRaw(module, SecDataCountID)
+	}
+	writer.writeSecOrRaw(module, SecCodeID)
+	writer.writeSecOrRaw(module, SecDataID)
+	for _, cs := range module.CustomSecs {
+		if _, ok := writer.opts.CustomSecsAfter[cs.Name]; !ok {
+			writer.writeCustomSec(cs)
+		}
+	}
+	writer.data = append(writer.data, module.Trailing...)
+}
+
+// secContent tells whether module has the non-custom section secID and
+// returns the function writing its content from the decoded fields
+func secContent(module Module, secID byte) (present bool, writeContent func(secWriter *wasmWriter)) {
+	switch secID {
+	case SecTypeID:
+		return len(module.TypeSec) > 0, func(w *wasmWriter) { w.writeTypeSec(module.TypeSec) }
+	case SecImportID:
+		return len(module.ImportSec) > 0, func(w *wasmWriter) { w.writeImportSec(module.ImportSec) }
+	case SecFuncID:
+		return len(module.FuncSec) > 0, func(w *wasmWriter) { w.writeIndices(module.FuncSec) }
+	case SecTableID:
+		return len(module.TableSec) > 0, func(w *wasmWriter) { w.writeTableSec(module.TableSec) }
+	case SecMemID:
+		return len(module.MemSec) > 0, func(w *wasmWriter) { w.writeMemSec(module.MemSec) }
+	case SecGlobalID:
+		return len(module.GlobalSec) > 0, func(w *wasmWriter) { w.writeGlobalSec(module.GlobalSec) }
+	case SecExportID:
+		return len(module.ExportSec) > 0, func(w *wasmWriter) { w.writeExportSec(module.ExportSec) }
+	case SecStartID:
+		// a nil StartSec means "no start section", which is different
+		// from a start section pointing at function 0
+		return module.StartSec != nil, func(w *wasmWriter) { w.writeVarU32(*module.StartSec) }
+	case SecElemID:
+		return len(module.ElemSec) > 0, func(w *wasmWriter) { w.writeElemSec(module.ElemSec) }
+	case SecDataCountID:
+		return module.DataCountSec != nil, func(w *wasmWriter) { w.writeVarU32(*module.DataCountSec) }
+	case SecCodeID:
+		return len(module.CodeSec) > 0, func(w *wasmWriter) { w.writeCodeSec(module.CodeSec) }
+	case SecDataID:
+		return len(module.DataSec) > 0, func(w *wasmWriter) { w.writeDataSec(module.DataSec) }
+	}
+	panic(fmt.Errorf("unknown section id %d", secID))
+}
+
+// secSum returns the SHA-256 of section secID as written from the decoded
+// fields of module, a section that is not present has the sum of no bytes
+func secSum(module Module, secID byte) [32]byte {
+	secWriter := &wasmWriter{}
+	if present, writeContent := secContent(module, secID); present {
+		writeContent(secWriter)
+	}
+	return sha256.Sum256(secWriter.data)
+}
+
+// writeCustomSecsAfter writes the custom sections EncodeOptions places
+// after section secID
+func (writer *wasmWriter) writeCustomSecsAfter(module Module, secID byte) {
+	for _, cs := range module.CustomSecs {
+		if after, ok := writer.opts.CustomSecsAfter[cs.Name]; ok && after == secID {
+			writer.writeCustomSec(cs)
+		}
+	}
+}
+
+// writeCustomSec writes a custom section, its size covers the length of
+// the name and the name as well as the bytes
+func (writer *wasmWriter) writeCustomSec(cs CustomSec) {
+	writer.writeSec(SecCustomID, func(secWriter *wasmWriter) {
+		secWriter.writeName(cs.Name)
+		secWriter.data = append(secWriter.data, cs.Bytes...)
+	})
+}
+
+// writeSecOrRaw writes section secID, from its raw bytes if the decoder
+// kept them and the decoded fields still encode as they did when it was
+// decoded
+func (writer *wasmWriter) writeSecOrRaw(module Module, secID byte) {
+	present, writeContent := secContent(module, secID)
+	raw, ok := module.RawSecs[secID]
+	if sum, decoded := module.rawSums[secID]; ok && decoded && sum != secSum(module, secID) {
+		ok = false // 字段被修改过
+	}
+	if ok {
+		writer.data = append(writer.data, raw...)
+	} else if present {
+		writer.writeSec(secID, writeContent)
+	}
+	writer.writeCustomSecsAfter(module, secID)
+}
+
+func (writer *wasmWriter) writeSec(secID byte, writeContent func(secWriter *wasmWriter)) {
+	secWriter := &wasmWriter{}
+	writeContent(secWriter)
+	writer.writeByte(secID)
+	writer.writeBytes(secWriter.data)
+}
+
+func (writer *wasmWriter) writeTypeSec(vec []FuncType) {
+	// 递归组整体算作一项
+	var groups [][]FuncType
+	for i := 0; i < len(vec); {
+		n := 1
+		if group := vec[i].RecGroup; group.Size > 0 && int(group.Start) == i {
+			n = int(group.Size)
+			if i+n > len(vec) {
+				panic(fmt.Errorf("type %d: rec group of %d types out of bounds", i, n))
+			}
+		}
+		groups = append(groups, vec[i:i+n])
+		i += n
+	}
+
+	writer.writeVarU32(uint32(len(groups)))
+	for _, group := range groups {
+		if group[0].RecGroup.Size > 0 {
+			writer.writeByte(RecTag)
+			writer.writeVarU32(uint32(len(group)))
+		}
+		for _, ft := range group {
+			writer.writeSubType(ft)
+		}
+	}
+}
+
+func (writer *wasmWriter) writeSubType(ft FuncType) {
+	if ft.Sub != 0 {
+		writer.writeByte(ft.Sub)
+		writer.writeIndices(ft.Supers)
+	}
+	switch ft.Tag {
+	case StructTag:
+		writer.writeByte(StructTag)
+		writer.writeVarU32(uint32(len(ft.Fields)))
+		for _, field := range ft.Fields {
+			writer.writeFieldType(field)
+		}
+	case ArrayTag:
+		writer.writeByte(ArrayTag)
+		writer.writeFieldType(ft.Fields[0])
+	default:
+		writer.writeFuncType(ft)
+	}
+}
+
+func (writer *wasmWriter) writeFieldType(field FieldType) {
+	writer.writeByte(field.Type)
+	if field.Type == RefTag || field.Type == RefNullTag {
+		writer.writeVarS64(field.HeapType)
+	}
+	writer.writeByte(field.Mut)
+}
+
+func (writer *wasmWriter) writeImportSec(vec []Import) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, imp := range vec {
+		writer.writeName(imp.Module)
+		writer.writeName(imp.Name)
+		writer.writeImportDesc(imp.Desc)
+	}
+}
+
+func (writer *wasmWriter) writeImportDesc(desc ImportDesc) {
+	writer.writeByte(desc.Tag)
+
+	switch desc.Tag {
+	case ImportTagFunc:
+		writer.writeVarU32(desc.FuncType)
+	case ImportTagTable:
+		writer.writeTableType(desc.Table)
+	case ImportTagMem:
+		writer.writeLimits(desc.Mem)
+	case ImportTagGlobal:
+		writer.writeGlobalType(desc.Global)
+	default:
+		panic(fmt.Errorf("invalid import desc tag: %d", desc.Tag))
+	}
+}
+
+func (writer *wasmWriter) writeTableSec(vec []TableType) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, tt := range vec {
+		writer.writeTableType(tt)
+	}
+}
+
+func (writer *wasmWriter) writeMemSec(vec []MemType) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, limits := range vec {
+		writer.writeLimits(limits)
+	}
+}
+
+func (writer *wasmWriter) writeGlobalSec(vec []Global) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, g := range vec {
+		writer.writeGlobalType(g.Type)
+		writer.writeExpr(g.Init)
+	}
+}
+
+func (writer *wasmWriter) writeExportSec(vec []Export) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, exp := range vec {
+		writer.writeName(exp.Name)
+		writer.writeByte(exp.Desc.Tag)
+		writer.writeVarU32(exp.Desc.Idx)
+	}
+}
+
+func (writer *wasmWriter) writeElemSec(vec []Elem) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, elem := range vec {
+		writer.writeElem(elem)
+	}
+}
+
+// writeElem writes elem with the MVP encoding if it can, see readElem for
+// the flags
+func (writer *wasmWriter) writeElem(elem Elem) {
+	exprs := elem.Exprs != nil
+	var flags uint32
+	switch elem.Mode {
+	case ElemModePassive:
+		flags = 1
+	case ElemModeDeclarative:
+		flags = 3
+	default:
+		if elem.Table != 0 || exprs && elem.Type != FuncRef {
+			flags = 2
+		}
+	}
+	if exprs {
+		flags |= 4
+	}
+
+	writer.writeVarU32(flags)
+	if flags&3 == 2 {
+		writer.writeVarU32(elem.Table)
+	}
+	if flags&1 == 0 {
+		writer.writeExpr(elem.Offset)
+	}
+	if flags&3 != 0 {
+		if exprs {
+			writer.writeByte(elem.Type)
+		} else {
+			writer.writeByte(0x00) // elemkind funcref
+		}
+	}
+	if exprs {
+		writer.writeVarU32(uint32(len(elem.Exprs)))
+		for _, expr := range elem.Exprs {
+			writer.writeExpr(expr)
+		}
+	} else {
+		writer.writeIndices(elem.Init)
+	}
+}
+
+func (writer *wasmWriter) writeCodeSec(vec []Code) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, code := range vec {
+		codeWriter := &wasmWriter{}
+		codeWriter.writeLocalsVec(code.Locals)
+		codeWriter.writeExpr(code.Expr)
+		writer.writeBytes(codeWriter.data)
+	}
+}
+
+func (writer *wasmWriter) writeLocalsVec(vec []Locals) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, locals := range vec {
+		writer.writeVarU32(locals.N)
+		writer.writeByte(locals.Type)
+	}
+}
+
+func (writer *wasmWriter) writeDataSec(vec []Data) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, data := range vec {
+		switch {
+		case data.Mode == DataModePassive:
+			writer.writeByte(1)
+		case data.Mem != 0:
+			writer.writeByte(2)
+			writer.writeVarU32(data.Mem)
+		default:
+			writer.writeByte(0)
+		}
+		if data.Mode != DataModePassive {
+			writer.writeExpr(data.Offset)
+		}
+		writer.writeBytes(data.Init)
+	}
+}
+
+// 值类型
+func (writer *wasmWriter) writeValTypes(vec []ValType) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, vt := range vec {
+		writer.writeByte(vt)
+	}
+}
+
+// 实体类型
+func (writer *wasmWriter) writeFuncType(ft FuncType) {
+	writer.writeByte(FtTag)
+	writer.writeValTypes(ft.ParamTypes)
+	writer.writeValTypes(ft.ResultTypes)
+}
+
+func (writer *wasmWriter) writeTableType(tt TableType) {
+	writer.writeByte(tt.ElemType)
+	writer.writeLimits(tt.Limits)
+}
+
+func (writer *wasmWriter) writeGlobalType(gt GlobalType) {
+	writer.writeByte(gt.ValType)
+	writer.writeByte(gt.Mut)
+}
+
+func (writer *wasmWriter) writeLimits(limits Limits) {
+	writer.writeByte(limits.Tag)
+	writer.writeVarU32(limits.Min)
+	if limits.Tag == 1 {
+		writer.writeVarU32(limits.Max)
+	}
+}
+
+// 索引
+func (writer *wasmWriter) writeIndices(vec []uint32) {
+	writer.writeVarU32(uint32(len(vec)))
+	for _, idx := range vec {
+		writer.writeVarU32(idx)
+	}
+}
+
+// 表达式 和 指令
+func (writer *wasmWriter) writeExpr(expr Expr) {
+	for _, instr := range expr {
+		writer.writeInstruction(instr)
+	}
+}
+
+func (writer *wasmWriter) writeInstruction(instr Instruction) {
+	writer.writeByte(instr.Opcode)
+	switch instr.Opcode {
+	case PrefixMisc:
+		writer.writeVarU32(instr.SubOpcode)
+		writer.writeMiscArgs(instr.SubOpcode, instr.Args)
+	case PrefixSIMD:
+		writer.writeVarU32(instr.SubOpcode)
+		writer.writeSIMDArgs(instr.SubOpcode, instr.Args)
+	case PrefixAtomic:
+		writer.writeVarU32(instr.SubOpcode)
+		if instr.SubOpcode == AtomicFence {
+			writer.writeByte(0)
+		} else {
+			writer.writeMemArg(instr.Args.(MemArg))
+		}
+	default:
+		writer.writeArgs(instr.Opcode, instr.Args)
+	}
+}
+
+func (writer *wasmWriter) writeArgs(opcode byte, args interface{}) {
+	switch opcode {
+	case Block, Loop, If:
+		writer.writeVarS64(int64(args.(BlockType)))
+	case BrTable:
+		brTableArgs := args.(BrTableArgs)
+		writer.writeIndices(brTableArgs.Labels)
+		writer.writeVarU32(brTableArgs.Default)
+	case Br, BrIf, Call, RefFunc, TableGet, TableSet,
+		LocalGet, LocalSet, LocalTee, GlobalGet, GlobalSet:
+		writer.writeVarU32(args.(uint32))
+	case CallIndirect:
+		callArgs := args.(CallIndirectArgs)
+		writer.writeVarU32(callArgs.Type)
+		writer.writeVarU32(callArgs.Table)
+	case SelectT:
+		writer.writeValTypes(args.([]ValType))
+	case MemorySize, MemoryGrow:
+		writer.writeByte(0)
+	case I32Const:
+		writer.writeVarS32(args.(int32))
+	case I64Const:
+		writer.writeVarS64(args.(int64))
+	case F32Const:
+		writer.writeF32(args.(float32))
+	case F64Const:
+		writer.writeF64(args.(float64))
+	case RefNull:
+		writer.writeByte(args.(ValType))
+	default:
+		if opcode >= I32Load && opcode <= I64Store32 {
+			writer.writeMemArg(args.(MemArg))
+		}
+	}
+}
+
+func (writer *wasmWriter) writeMiscArgs(subOpcode uint32, args interface{}) {
+	switch subOpcode {
+	case TableGrow, TableSize, TableFill, DataDrop, ElemDrop:
+		writer.writeVarU32(args.(uint32))
+	case MemoryInit:
+		writer.writeVarU32(args.(uint32))
+		writer.writeByte(0)
+	case MemoryCopy:
+		writer.writeByte(0)
+		writer.writeByte(0)
+	case MemoryFill:
+		writer.writeByte(0)
+	case TableInit:
+		initArgs := args.(TableInitArgs)
+		writer.writeVarU32(initArgs.Elem)
+		writer.writeVarU32(initArgs.Table)
+	case TableCopy:
+		copyArgs := args.(TableCopyArgs)
+		writer.writeVarU32(copyArgs.Dst)
+		writer.writeVarU32(copyArgs.Src)
+	}
+}
+
+func (writer *wasmWriter) writeSIMDArgs(subOpcode uint32, args interface{}) {
+	switch x := args.(type) {
+	case MemArg:
+		writer.writeMemArg(x)
+	case V128:
+		writer.data = append(writer.data, x[:]...)
+	case ShuffleArgs:
+		writer.data = append(writer.data, x[:]...)
+	case LaneIdx:
+		writer.writeByte(x)
+	case MemLaneArgs:
+		writer.writeMemArg(x.MemArg)
+		writer.writeByte(x.Lane)
+	case nil:
+	default:
+		panic(fmt.Errorf("invalid immediate %T for %s", args, simdOpnames[subOpcode]))
+	}
+}
+
+func (writer *wasmWriter) writeMemArg(memArg MemArg) {
+	writer.writeVarU32(memArg.Align)
+	writer.writeVarU32(memArg.Offset)
+}
@@ -0,0 +1,114 @@
+package binary
+
+import (
+	"bytes"
+	"testing"
+)
+
+func mustEncode(t *testing.T, m Module) []byte {
+	t.Helper()
+	data, err := Encode(m)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return data
+}
+
+func TestEncodeStartSection(t *testing.T) {
+	secs := voidFunc(End)
+	noStart := wasm(secs...)
+	withStart := wasm(secs[0], secs[1], sec(SecStartID, 0), secs[2])
+
+	for _, want := range [][]byte{noStart, withStart} {
+		got := mustEncode(t, mustDecode(t, want))
+		if !bytes.Equal(got, want) {
+			t.Errorf("got %x, want %x", got, want)
+		}
+	}
+}
+
+func TestEncodeCustomSec(t *testing.T) {
+	big := bytes.Repeat([]byte{0xAB}, 200)
+	tests := []struct {
+		name string
+		cs   CustomSec
+		want []byte
+	}{
+		// the size covers the name length, the name and the bytes
+		{"empty name", CustomSec{Bytes: []byte("abc")}, []byte{SecCustomID, 4, 0, 'a', 'b', 'c'}},
+		{"empty", CustomSec{}, []byte{SecCustomID, 1, 0}},
+		{"large body", CustomSec{Name: "big", Bytes: big},
+			append([]byte{SecCustomID, 0xCC, 0x01, 3, 'b', 'i', 'g'}, big...)},
+	}
+	for _, tt := range tests {
+		want := wasm(tt.want)
+		got := mustEncode(t, Module{Magic: MagicNumber, Version: Version, CustomSecs: []CustomSec{tt.cs}})
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %x, want %x", tt.name, got, want)
+		}
+		if got := mustEncode(t, mustDecode(t, want)); !bytes.Equal(got, want) {
+			t.Errorf("%s: round trip: got %x, want %x", tt.name, got, want)
+		}
+	}
+}
+
+func TestEncodeRawSections(t *testing.T) {
+	// i32.const 1 with a padded immediate, which Encode would shorten
+	secs := voidFunc(I32Const, 0x81, 0x80, 0x00, Drop, End)
+	data := wasm(secs[0], secs[1], sec(SecExportID, 1, 1, 'f', ExportTagFunc, 0), secs[2])
+	opts := DefaultDecodeOptions()
+	opts.KeepRawSections = true
+	decode := func() Module {
+		m, err := DecodeWithOptions(data, opts)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		return m
+	}
+
+	m := decode()
+	if got := mustEncode(t, m); !bytes.Equal(got, data) {
+		t.Fatalf("unmodified: got %x, want %x", got, data)
+	}
+
+	// modified without MarkDirty
+	m.CodeSec[0].Expr[0].Args = int32(2)
+	m.ExportSec[0].Name = "g"
+	got := mustDecode(t, mustEncode(t, m))
+	if got.CodeSec[0].Expr[0].Args != int32(2) || got.ExportSec[0].Name != "g" {
+		t.Fatalf("modified: got %v and export %q, want i32.const 2 and export \"g\"",
+			got.CodeSec[0].Expr[0], got.ExportSec[0].Name)
+	}
+
+	// removed section
+	m = decode()
+	m.ExportSec = nil
+	if got := mustDecode(t, mustEncode(t, m)); len(got.ExportSec) != 0 {
+		t.Fatalf("removed: got exports %v, want none", got.ExportSec)
+	}
+
+	// MarkDirty leaves copies alone
+	m = decode()
+	m2 := m
+	m2.MarkDirty(SecCodeID)
+	if _, ok := m.RawSecs[SecCodeID]; !ok {
+		t.Fatalf("got the raw code section removed from the copy, want it kept")
+	}
+	if got := mustEncode(t, m2); bytes.Equal(got, data) {
+		t.Fatalf("dirty: got the raw code section, want it encoded from the fields")
+	}
+}
+
+func TestDataCountPosition(t *testing.T) {
+	secs := voidFunc(I32Const, 0, I32Const, 0, I32Const, 0, PrefixMisc, MemoryInit, 0, 0, End)
+	elems := sec(SecElemID, 1, 1, 0, 0) // passive, no functions
+	dataCount := sec(SecDataCountID, 1)
+	data := wasm(secs[0], secs[1], sec(SecMemID, 1, 0, 1), elems, dataCount, secs[2],
+		sec(SecDataID, 1, 1, 0))
+	if got := mustEncode(t, mustDecode(t, data)); !bytes.Equal(got, data) {
+		t.Fatalf("got %x, want %x", got, data)
+	}
+
+	_, err := Decode(wasm(secs[0], secs[1], dataCount, elems))
+	wantError(t, err, "section 9 out of order (after 12)")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+// writeCallGraph writes the call graph of module in the Graphviz DOT
+// language. Imported functions are drawn as grey boxes. With indirect,
+// functions using call_indirect get an edge to a node named "indirect".
+func writeCallGraph(w io.Writer, module binary.Module, indirect bool) {
+	cg := module.CallGraph()
+	names := module.FuncNames()
+	importedFuncs := module.ImportedFuncCount()
+
+	fmt.Fprintln(w, "digraph callgraph {")
+	fmt.Fprintln(w, "  node [shape=ellipse];")
+	funcCount := importedFuncs + len(module.FuncSec)
+	for i := 0; i < funcCount; i++ {
+		label := fmt.Sprintf("func[%d]", i)
+		if name, ok := names[binary.FuncIdx(i)]; ok {
+			label += " " + name
+		}
+		if i < importedFuncs {
+			fmt.Fprintf(w, "  f%d [label=%s, shape=box, style=filled, fillcolor=lightgrey];\n", i, dotQuote(label))
+		} else {
+			fmt.Fprintf(w, "  f%d [label=%s];\n", i, dotQuote(label))
+		}
+	}
+	if indirect && len(cg.Indirect) > 0 {
+		fmt.Fprintln(w, "  indirect [label=\"call_indirect\", shape=diamond];")
+	}
+
+	for i := importedFuncs; i < funcCount; i++ {
+		caller := binary.FuncIdx(i)
+		for _, callee := range cg.Calls[caller] {
+			fmt.Fprintf(w, "  f%d -> f%d;\n", caller, callee)
+		}
+		if indirect && cg.Indirect[caller] {
+			fmt.Fprintf(w, "  f%d -> indirect [style=dashed];\n", caller)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// dotQuote quotes s as a DOT string, %q would escape non-ASCII runes in a
+// way Graphviz does not understand
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
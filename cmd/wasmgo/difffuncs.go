@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+type diffFunc struct {
+	idx        binary.FuncIdx
+	exportName string
+	debugName  string // from the name section
+	body       []byte
+	code       binary.Code
+	match      *diffFunc
+}
+
+func (f *diffFunc) String() string {
+	name := f.exportName
+	if name == "" {
+		name = f.debugName
+	}
+	if name == "" {
+		return fmt.Sprintf("func[%d]", f.idx)
+	}
+	return fmt.Sprintf("func[%d] %s", f.idx, name)
+}
+
+type diffModule struct {
+	module binary.Module
+	funcs  []*diffFunc // defined functions only
+}
+
+func loadDiffModule(filename string, opts binary.DecodeOptions) (*diffModule, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	opts.RecordCodeOffsets = true
+	module, err := binary.DecodeWithOptions(data, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	importedFuncCount := 0
+	for _, imp := range module.ImportSec {
+		if imp.Desc.Tag == binary.ImportTagFunc {
+			importedFuncCount++
+		}
+	}
+	exportNames := make(map[binary.FuncIdx]string)
+	for _, exp := range module.ExportSec {
+		if _, ok := exportNames[exp.Desc.Idx]; !ok && exp.Desc.Tag == binary.ExportTagFunc {
+			exportNames[exp.Desc.Idx] = exp.Name
+		}
+	}
+	debugNames := module.FuncNames()
+
+	dm := &diffModule{module: module}
+	for i, code := range module.CodeSec {
+		idx := binary.FuncIdx(importedFuncCount + i)
+		dm.funcs = append(dm.funcs, &diffFunc{
+			idx:        idx,
+			exportName: exportNames[idx],
+			debugName:  debugNames[idx],
+			body:       data[code.Start:code.End],
+			code:       code,
+		})
+	}
+
+	return dm, nil
+}
+
+// diffFuncs matches the defined functions of a and b by export name, then
+// by name section name, then by identical body, and prints the functions
+// that were added, removed or changed.
+func diffFuncs(filenameA, filenameB string, opts binary.DecodeOptions) error {
+	a, err := loadDiffModule(filenameA, opts)
+	if err != nil {
+		return err
+	}
+	b, err := loadDiffModule(filenameB, opts)
+	if err != nil {
+		return err
+	}
+
+	matchFuncs(a, b, func(f *diffFunc) string { return f.exportName })
+	matchFuncs(a, b, func(f *diffFunc) string { return f.debugName })
+	matchFuncs(a, b, func(f *diffFunc) string { return string(f.body) })
+
+	funcMap := a.funcIdxMap(b)
+	removed, added, changed, unchanged := 0, 0, 0, 0
+	for _, f := range a.funcs {
+		switch {
+		case f.match == nil:
+			fmt.Printf("- %s\n", f)
+			removed++
+		case !sameBody(f, f.match, funcMap):
+			fmt.Printf("~ %s -> %s\n", f, f.match)
+			changed++
+		default:
+			unchanged++
+		}
+	}
+	for _, f := range b.funcs {
+		if f.match == nil {
+			fmt.Printf("+ %s\n", f)
+			added++
+		}
+	}
+	fmt.Printf("%d added, %d removed, %d changed, %d unchanged\n",
+		added, removed, changed, unchanged)
+
+	return nil
+}
+
+// matchFuncs pairs the still unmatched functions of a and b whose keys
+// are equal, empty keys and keys that aren't unique are ignored
+func matchFuncs(a, b *diffModule, key func(f *diffFunc) string) {
+	index := func(m *diffModule) map[string]*diffFunc {
+		funcs := make(map[string]*diffFunc)
+		for _, f := range m.funcs {
+			k := key(f)
+			if f.match != nil || k == "" {
+				continue
+			}
+			if _, ok := funcs[k]; ok {
+				funcs[k] = nil
+			} else {
+				funcs[k] = f
+			}
+		}
+		return funcs
+	}
+
+	funcsB := index(b)
+	for k, f := range index(a) {
+		if g := funcsB[k]; f != nil && g != nil {
+			f.match = g
+			g.match = f
+		}
+	}
+}
+
+// funcIdxMap maps the function indices of a to those of b, imports are
+// matched by module and name
+func (a *diffModule) funcIdxMap(b *diffModule) map[binary.FuncIdx]binary.FuncIdx {
+	funcMap := make(map[binary.FuncIdx]binary.FuncIdx)
+
+	importsB := make(map[string]binary.FuncIdx)
+	idx := binary.FuncIdx(0)
+	for _, imp := range b.module.ImportSec {
+		if imp.Desc.Tag == binary.ImportTagFunc {
+			importsB[imp.Module+"."+imp.Name] = idx
+			idx++
+		}
+	}
+	idx = 0
+	for _, imp := range a.module.ImportSec {
+		if imp.Desc.Tag == binary.ImportTagFunc {
+			if idxB, ok := importsB[imp.Module+"."+imp.Name]; ok {
+				funcMap[idx] = idxB
+			}
+			idx++
+		}
+	}
+
+	for _, f := range a.funcs {
+		if f.match != nil {
+			funcMap[f.idx] = f.match.idx
+		}
+	}
+
+	return funcMap
+}
+
+// sameBody reports whether f and g are equal once the function indices
+// of f are translated to those of g, so pure reindexing is not a change
+func sameBody(f, g *diffFunc, funcMap map[binary.FuncIdx]binary.FuncIdx) bool {
+	if string(f.body) == string(g.body) {
+		return true
+	}
+	if !reflect.DeepEqual(f.code.Locals, g.code.Locals) ||
+		len(f.code.Expr) != len(g.code.Expr) {
+		return false
+	}
+
+	for i, instrA := range f.code.Expr {
+		instrB := g.code.Expr[i]
+		if instrA.Opcode != instrB.Opcode || instrA.SubOpcode != instrB.SubOpcode {
+			return false
+		}
+		switch instrA.Opcode {
+		case binary.Call, binary.RefFunc:
+			idx, ok := funcMap[instrA.Args.(uint32)]
+			if !ok || idx != instrB.Args.(uint32) {
+				return false
+			}
+		default:
+			if !reflect.DeepEqual(instrA.Args, instrB.Args) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
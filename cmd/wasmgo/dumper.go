@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/aiialzy/wasmer/binary"
+	"github.com/aiialzy/wasmer/text"
 )
 
 type dumper struct {
@@ -17,7 +19,18 @@ type dumper struct {
 func (d *dumper) dumpTypeSec() {
 	fmt.Printf("Type[%d]:\n", len(d.module.TypeSec))
 	for i, ft := range d.module.TypeSec {
-		fmt.Printf("  type[%d]: %s\n", i, ft)
+		fmt.Printf("  type[%d]: %s", i, ft)
+		if ft.Sub != 0 {
+			if ft.Final() {
+				fmt.Printf(", sub final %v", ft.Supers)
+			} else {
+				fmt.Printf(", sub %v", ft.Supers)
+			}
+		}
+		if group := ft.RecGroup; group.Size > 0 {
+			fmt.Printf(", rec[%d..%d]", group.Start, group.Start+group.Size-1)
+		}
+		fmt.Println()
 	}
 }
 
@@ -26,8 +39,9 @@ func (d *dumper) dumpImportSec() {
 	for _, imp := range d.module.ImportSec {
 		switch imp.Desc.Tag {
 		case binary.ImportTagFunc:
-			fmt.Printf("  func[%d]: %s.%s, sig=%d\n",
-				d.importedFuncCount, imp.Module, imp.Name, imp.Desc.FuncType)
+			fmt.Printf("  func[%d]: %s.%s, sig=%d %s\n",
+				d.importedFuncCount, imp.Module, imp.Name, imp.Desc.FuncType,
+				d.signature(imp.Desc.FuncType))
 			d.importedFuncCount++
 		case binary.ImportTagTable:
 			fmt.Printf("  table[%d]: %s.%s, %s\n",
@@ -49,16 +63,16 @@ func (d *dumper) dumpImportSec() {
 func (d *dumper) dumpFuncSec() {
 	fmt.Printf("Function[%d]:\n", len(d.module.FuncSec))
 	for i, sig := range d.module.FuncSec {
-		fmt.Printf("  func[%d]: sig=%d\n",
-			d.importedFuncCount+i, sig)
+		fmt.Printf("  func[%d]: sig=%d %s\n",
+			d.importedFuncCount+i, sig, d.signature(sig))
 	}
 }
 
 func (d *dumper) dumpTableSec() {
 	fmt.Printf("Table[%d]:\n", len(d.module.TableSec))
 	for i, t := range d.module.TableSec {
-		fmt.Printf("  table[%d]: %s\n",
-			d.importedTableCount+i, t.Limits)
+		fmt.Printf("  table[%d]: %s, %s\n",
+			d.importedTableCount+i, binary.ValTypeToStr(t.ElemType), t.Limits)
 	}
 }
 
@@ -73,8 +87,8 @@ func (d *dumper) dumpMemSec() {
 func (d *dumper) dumpGlobalSec() {
 	fmt.Printf("Global[%d]:\n", len(d.module.GlobalSec))
 	for i, g := range d.module.GlobalSec {
-		fmt.Printf("  global[%d]: %s\n",
-			d.importedGlobalCount+i, g.Type)
+		fmt.Printf("  global[%d]: %s, init %s\n",
+			d.importedGlobalCount+i, g.Type, exprToStr(g.Init))
 	}
 }
 
@@ -104,14 +118,36 @@ func (d *dumper) dumpStartSec() {
 func (d *dumper) dumpElemSec() {
 	fmt.Printf("Element[%d]:\n", len(d.module.ElemSec))
 	for i, elem := range d.module.ElemSec {
-		fmt.Printf("  elem[%d]: table=%d\n", i, elem.Table) // TODO
+		switch elem.Mode {
+		case binary.ElemModePassive:
+			fmt.Printf("  elem[%d]: passive", i)
+		case binary.ElemModeDeclarative:
+			fmt.Printf("  elem[%d]: declarative", i)
+		default:
+			fmt.Printf("  elem[%d]: table=%d", i, elem.Table)
+		}
+		if elem.Exprs != nil {
+			fmt.Printf(", type=%s, count=%d", binary.ValTypeToStr(elem.Type), len(elem.Exprs))
+		} else {
+			fmt.Printf(", count=%d", len(elem.Init))
+		}
+		if elem.Mode == binary.ElemModeActive {
+			fmt.Printf(", init %s", exprToStr(elem.Offset))
+		}
+		fmt.Println()
+		for j, idx := range elem.Init {
+			fmt.Printf("    - elem[%d] = func[%d]\n", j, idx)
+		}
+		for j, expr := range elem.Exprs {
+			fmt.Printf("    - elem[%d] = %s\n", j, exprToStr(expr))
+		}
 	}
 }
 
 func (d *dumper) dumpCodeSec() {
 	fmt.Printf("Code[%d]:\n", len(d.module.CodeSec))
 	for i, code := range d.module.CodeSec {
-		fmt.Printf("  func[%d]: locals=[", d.importedFuncCount+i) // TODO
+		fmt.Printf("  func[%d]: instrs=%d, locals=[", d.importedFuncCount+i, len(code.Expr))
 		if len(code.Locals) > 0 {
 			for i, locals := range code.Locals {
 				if i > 0 {
@@ -128,15 +164,40 @@ func (d *dumper) dumpCodeSec() {
 func (d *dumper) dumpDataSec() {
 	fmt.Printf("Data[%d]:\n", len(d.module.DataSec))
 	for i, data := range d.module.DataSec {
-		fmt.Printf("  data[%d]: mem=%d\n", i, data.Mem) // TODO
+		if data.Mode == binary.DataModePassive {
+			fmt.Printf("  data[%d]: passive, size=%d\n", i, len(data.Init))
+			continue
+		}
+		fmt.Printf("  data[%d]: mem=%d, size=%d, init %s\n",
+			i, data.Mem, len(data.Init), exprToStr(data.Offset))
 	}
 }
 
 func (d *dumper) dumpCustomSec() {
 	fmt.Printf("Custom[%d]:\n", len(d.module.CustomSecs))
 	for i, cs := range d.module.CustomSecs {
-		fmt.Printf("  custom[%d]: name=%s\n", i, cs.Name) // TODO
+		fmt.Printf("  custom[%d]: name=%s, size=%d\n", i, cs.Name, len(cs.Bytes))
+	}
+}
+
+// signature returns the signature of type idx, or nothing if there is
+// no such type
+func (d *dumper) signature(idx binary.TypeIdx) string {
+	if int(idx) >= len(d.module.TypeSec) {
+		return ""
+	}
+	return "<" + d.module.TypeSec[idx].GetSignature() + ">"
+}
+
+// exprToStr returns a constant expression on one line, without the end
+func exprToStr(expr binary.Expr) string {
+	var strs []string
+	for _, instr := range expr {
+		if instr.Opcode != binary.End {
+			strs = append(strs, text.InstrString(instr))
+		}
 	}
+	return strings.Join(strs, "; ")
 }
 
 func dump(module binary.Module) {
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+// hexSec prints an annotated hexdump of every section named secName. It
+// only splits the module into sections, so the content of the section
+// doesn't have to decode.
+func hexSec(secName, filename string) error {
+	secID, ok := binary.SecNameToID(secName)
+	if !ok {
+		return fmt.Errorf("unknown section name: %s", secName)
+	}
+
+	data, err := readInput(filename)
+	if err != nil {
+		return err
+	}
+	ranges, err := binary.SectionRanges(data)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, sr := range ranges {
+		if sr.ID != secID {
+			continue
+		}
+		found = true
+		hexLine(data, sr.Start, sr.Start+1,
+			fmt.Sprintf("; section id %d (%s)", sr.ID, binary.SecIDToName(sr.ID)))
+		hexLine(data, sr.Start+1, sr.ContentStart,
+			fmt.Sprintf("; size %d", sr.End-sr.ContentStart))
+		for offset := sr.ContentStart; offset < sr.End; offset += 16 {
+			end := offset + 16
+			if end > sr.End {
+				end = sr.End
+			}
+			hexLine(data, offset, end, "|"+printable(data[offset:end])+"|")
+		}
+	}
+	if !found {
+		return fmt.Errorf("no %s section", secName)
+	}
+
+	return nil
+}
+
+func hexLine(data []byte, start, end int, comment string) {
+	hex := make([]string, 0, end-start)
+	for _, b := range data[start:end] {
+		hex = append(hex, fmt.Sprintf("%02x", b))
+	}
+	fmt.Printf("%08x: %-47s  %s\n", start, strings.Join(hex, " "), comment)
+}
+
+func printable(data []byte) string {
+	sb := strings.Builder{}
+	for _, b := range data {
+		if b >= 0x20 && b < 0x7F {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteByte('.')
+		}
+	}
+	return sb.String()
+}
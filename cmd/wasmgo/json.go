@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+
+	"github.com/aiialzy/wasmer/binary"
+	"github.com/aiialzy/wasmer/text"
+)
+
+// jsonModule is the -json view of a module: value types and kinds are
+// names, expressions are lists of instructions in the text format
+type jsonModule struct {
+	Version uint32           `json:"version"`
+	Types   []jsonFuncType   `json:"types"`
+	Imports []jsonImport     `json:"imports"`
+	Funcs   []binary.TypeIdx `json:"funcs"`
+	Tables  []jsonTableType  `json:"tables"`
+	Mems    []jsonLimits     `json:"memories"`
+	Globals []jsonGlobal     `json:"globals"`
+	Exports []jsonExport     `json:"exports"`
+	Start   *binary.FuncIdx  `json:"start,omitempty"`
+	Elems   []jsonElem       `json:"elems"`
+	Code    []jsonCode       `json:"code"`
+	Data    []jsonData       `json:"data"`
+	Customs []jsonCustomSec  `json:"customs"`
+}
+
+type jsonFuncType struct {
+	Params  []string `json:"params"`
+	Results []string `json:"results"`
+}
+
+type jsonLimits struct {
+	Min uint32  `json:"min"`
+	Max *uint32 `json:"max,omitempty"`
+}
+
+type jsonTableType struct {
+	ElemType string `json:"elemType"`
+	jsonLimits
+}
+
+type jsonGlobalType struct {
+	Type    string `json:"type"`
+	Mutable bool   `json:"mutable"`
+}
+
+type jsonImport struct {
+	Module   string          `json:"module"`
+	Name     string          `json:"name"`
+	Kind     string          `json:"kind"`
+	FuncType *binary.TypeIdx `json:"type,omitempty"`
+	Table    *jsonTableType  `json:"table,omitempty"`
+	Mem      *jsonLimits     `json:"memory,omitempty"`
+	Global   *jsonGlobalType `json:"global,omitempty"`
+}
+
+type jsonGlobal struct {
+	jsonGlobalType
+	Init []string `json:"init"`
+}
+
+type jsonExport struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Index uint32 `json:"index"`
+}
+
+type jsonElem struct {
+	Mode   string           `json:"mode"`
+	Table  *binary.TableIdx `json:"table,omitempty"`
+	Offset []string         `json:"offset,omitempty"`
+	Init   []binary.FuncIdx `json:"init,omitempty"`
+	Type   string           `json:"type,omitempty"`
+	Exprs  [][]string       `json:"exprs,omitempty"`
+}
+
+type jsonCode struct {
+	Locals []string `json:"locals"`
+	Body   []string `json:"body"`
+}
+
+type jsonData struct {
+	Mode   string         `json:"mode"`
+	Mem    *binary.MemIdx `json:"memory,omitempty"`
+	Offset []string       `json:"offset,omitempty"`
+	Init   string         `json:"init"` // hex
+}
+
+type jsonCustomSec struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+var kindNames = map[byte]string{
+	binary.ImportTagFunc:   "func",
+	binary.ImportTagTable:  "table",
+	binary.ImportTagMem:    "memory",
+	binary.ImportTagGlobal: "global",
+}
+
+var elemModeNames = map[byte]string{
+	binary.ElemModeActive:      "active",
+	binary.ElemModePassive:     "passive",
+	binary.ElemModeDeclarative: "declarative",
+}
+
+func writeJSON(w io.Writer, module binary.Module) error {
+	jm := jsonModule{
+		Version: module.Version,
+		Types:   []jsonFuncType{},
+		Imports: []jsonImport{},
+		Funcs:   module.FuncSec,
+		Tables:  []jsonTableType{},
+		Mems:    []jsonLimits{},
+		Globals: []jsonGlobal{},
+		Exports: []jsonExport{},
+		Start:   module.StartSec,
+		Elems:   []jsonElem{},
+		Code:    []jsonCode{},
+		Data:    []jsonData{},
+		Customs: []jsonCustomSec{},
+	}
+	if jm.Funcs == nil {
+		jm.Funcs = []binary.TypeIdx{}
+	}
+
+	for _, ft := range module.TypeSec {
+		jm.Types = append(jm.Types, jsonFuncType{
+			Params:  valTypeNames(ft.ParamTypes),
+			Results: valTypeNames(ft.ResultTypes),
+		})
+	}
+	for _, imp := range module.ImportSec {
+		ji := jsonImport{Module: imp.Module, Name: imp.Name, Kind: kindNames[imp.Desc.Tag]}
+		switch imp.Desc.Tag {
+		case binary.ImportTagFunc:
+			ft := imp.Desc.FuncType
+			ji.FuncType = &ft
+		case binary.ImportTagTable:
+			tt := toJSONTableType(imp.Desc.Table)
+			ji.Table = &tt
+		case binary.ImportTagMem:
+			limits := toJSONLimits(imp.Desc.Mem)
+			ji.Mem = &limits
+		case binary.ImportTagGlobal:
+			gt := toJSONGlobalType(imp.Desc.Global)
+			ji.Global = &gt
+		}
+		jm.Imports = append(jm.Imports, ji)
+	}
+	for _, tt := range module.TableSec {
+		jm.Tables = append(jm.Tables, toJSONTableType(tt))
+	}
+	for _, mt := range module.MemSec {
+		jm.Mems = append(jm.Mems, toJSONLimits(mt))
+	}
+	for _, g := range module.GlobalSec {
+		jm.Globals = append(jm.Globals, jsonGlobal{
+			jsonGlobalType: toJSONGlobalType(g.Type),
+			Init:           exprToStrs(g.Init),
+		})
+	}
+	for _, exp := range module.ExportSec {
+		jm.Exports = append(jm.Exports, jsonExport{
+			Name:  exp.Name,
+			Kind:  kindNames[exp.Desc.Tag],
+			Index: exp.Desc.Idx,
+		})
+	}
+	for _, elem := range module.ElemSec {
+		je := jsonElem{Mode: elemModeNames[elem.Mode]}
+		if elem.Mode == binary.ElemModeActive {
+			table := elem.Table
+			je.Table = &table
+			je.Offset = exprToStrs(elem.Offset)
+		}
+		if elem.Exprs != nil {
+			je.Type = binary.ValTypeToStr(elem.Type)
+			for _, expr := range elem.Exprs {
+				je.Exprs = append(je.Exprs, exprToStrs(expr))
+			}
+		} else {
+			je.Init = elem.Init
+		}
+		jm.Elems = append(jm.Elems, je)
+	}
+	for _, code := range module.CodeSec {
+		jm.Code = append(jm.Code, jsonCode{
+			Locals: valTypeNames(code.ExpandedLocals()),
+			Body:   exprToStrs(code.Expr),
+		})
+	}
+	for _, data := range module.DataSec {
+		jd := jsonData{Mode: "passive", Init: hex.EncodeToString(data.Init)}
+		if data.Mode == binary.DataModeActive {
+			mem := data.Mem
+			jd.Mode, jd.Mem = "active", &mem
+			jd.Offset = exprToStrs(data.Offset)
+		}
+		jm.Data = append(jm.Data, jd)
+	}
+	for _, cs := range module.CustomSecs {
+		jm.Customs = append(jm.Customs, jsonCustomSec{Name: cs.Name, Size: len(cs.Bytes)})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jm)
+}
+
+func valTypeNames(vts []binary.ValType) []string {
+	names := make([]string, len(vts))
+	for i, vt := range vts {
+		names[i] = binary.ValTypeToStr(vt)
+	}
+	return names
+}
+
+func exprToStrs(expr binary.Expr) []string {
+	strs := make([]string, len(expr))
+	for i, instr := range expr {
+		strs[i] = text.InstrString(instr)
+	}
+	return strs
+}
+
+func toJSONLimits(limits binary.Limits) jsonLimits {
+	jl := jsonLimits{Min: limits.Min}
+	if limits.Tag == 1 {
+		max := limits.Max
+		jl.Max = &max
+	}
+	return jl
+}
+
+func toJSONTableType(tt binary.TableType) jsonTableType {
+	return jsonTableType{
+		ElemType:   binary.ValTypeToStr(tt.ElemType),
+		jsonLimits: toJSONLimits(tt.Limits),
+	}
+}
+
+func toJSONGlobalType(gt binary.GlobalType) jsonGlobalType {
+	return jsonGlobalType{
+		Type:    binary.ValTypeToStr(gt.ValType),
+		Mutable: gt.Mut == binary.MutVar,
+	}
+}
@@ -3,20 +3,68 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/aiialzy/wasmer/binary"
+	"github.com/aiialzy/wasmer/text"
 )
 
 func main() {
 	dumpFlag := flag.Bool("d", false, "dump")
+	jsonFlag := flag.Bool("json", false, "print the decoded module as JSON")
+	strictFlag := flag.Bool("strict", false, "reject anything beyond the MVP")
+	diffFuncsFlag := flag.Bool("diff-funcs", false, "show which functions changed between two modules")
+	profileDecodeFlag := flag.Bool("profile-decode", false, "report the time spent decoding each section")
+	callGraphFlag := flag.Bool("callgraph", false, "print the call graph in Graphviz DOT format")
+	indirectFlag := flag.Bool("indirect", true, "with -callgraph, draw an edge to an \"indirect\" node from functions using call_indirect")
+	disasmFlag := flag.Int("disasm", -1, "print the body of the function with this index as text")
+	hexSecFlag := flag.String("hexsec", "", "hexdump the named section (type, import, function, ..., code, data, custom)")
 	flag.Parse()
+
+	opts := binary.DefaultDecodeOptions()
+	if *strictFlag {
+		opts.Features = binary.Features{}
+	}
+
+	if *diffFuncsFlag {
+		if flag.NArg() != 2 {
+			fmt.Println("Usage: wasmgo -diff-funcs [-strict] a.wasm b.wasm")
+			os.Exit(1)
+		}
+		if err := diffFuncs(flag.Args()[0], flag.Args()[1], opts); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if flag.NArg() != 1 {
-		fmt.Println("Usage: wasmgo [-d] filename")
+		fmt.Println("Usage: wasmgo [-d] [-json] [-strict] [-profile-decode] [-callgraph [-indirect=false]] [-disasm funcidx] [-hexsec name] filename|-")
 		os.Exit(1)
 	}
 
-	module, err := binary.DecodeFile(flag.Args()[0])
+	if *hexSecFlag != "" {
+		if err := hexSec(*hexSecFlag, flag.Args()[0]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *profileDecodeFlag {
+		if err := profileDecode(flag.Args()[0], opts); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	data, err := readInput(flag.Args()[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	module, err := binary.DecodeWithOptions(data, opts)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -25,4 +73,29 @@ func main() {
 	if *dumpFlag {
 		dump(module)
 	}
+	if *jsonFlag {
+		if err := writeJSON(os.Stdout, module); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *disasmFlag >= 0 {
+		s, err := text.DisassembleFunc(module, binary.FuncIdx(*disasmFlag))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Print(s)
+	}
+	if *callGraphFlag {
+		writeCallGraph(os.Stdout, module, *indirectFlag)
+	}
+}
+
+// readInput reads the file called filename, or stdin when it is "-"
+func readInput(filename string) ([]byte, error) {
+	if filename == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(filename)
 }
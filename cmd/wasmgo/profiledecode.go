@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+// profileDecode decodes filename and prints the time spent on each
+// section, slowest first. Custom sections are added up.
+func profileDecode(filename string, opts binary.DecodeOptions) error {
+	data, err := readInput(filename)
+	if err != nil {
+		return err
+	}
+
+	elapsed := make(map[byte]time.Duration)
+	opts.SectionTimer = func(secID byte, d time.Duration) {
+		elapsed[secID] += d
+	}
+	start := time.Now()
+	if _, err := binary.DecodeWithOptions(data, opts); err != nil {
+		return err
+	}
+	total := time.Since(start)
+
+	secIDs := make([]byte, 0, len(elapsed))
+	for secID := range elapsed {
+		secIDs = append(secIDs, secID)
+	}
+	sort.Slice(secIDs, func(i, j int) bool {
+		return elapsed[secIDs[i]] > elapsed[secIDs[j]]
+	})
+
+	for _, secID := range secIDs {
+		d := elapsed[secID]
+		fmt.Printf("%-10s %12s %6.1f%%\n", binary.SecIDToName(secID), d,
+			float64(d)*100/float64(total))
+	}
+	fmt.Printf("%-10s %12s\n", "total", total)
+	return nil
+}
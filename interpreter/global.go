@@ -0,0 +1,61 @@
+package interpreter
+
+import "github.com/aiialzy/wasmer/binary"
+
+type Global struct {
+	Type binary.GlobalType
+	bits uint64
+	ref  Value // the value of a global of reference type, bits is unused
+}
+
+func NewGlobal(gt binary.GlobalType, v Value) (*Global, error) {
+	g := &Global{Type: gt}
+	if err := g.set(v); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func (g *Global) Get() Value {
+	if isRef(g.Type.ValType) {
+		return g.ref
+	}
+	return fromBits(g.bits, g.Type.ValType)
+}
+
+// set sets g to v, which must have the type of g. Mutability is not
+// checked.
+func (g *Global) set(v Value) error {
+	if isRef(g.Type.ValType) {
+		if err := checkRef(v, g.Type.ValType); err != nil {
+			return err
+		}
+		g.ref = v
+		return nil
+	}
+	bits, err := toBits(v, g.Type.ValType)
+	if err != nil {
+		return err
+	}
+	g.bits = bits
+	return nil
+}
+
+// pushGlobal and popGlobal move the value of g between g and the operand
+// stack
+func (vm *vm) pushGlobal(g *Global) {
+	if isRef(g.Type.ValType) {
+		vm.pushRef(g.ref)
+	} else {
+		vm.pushU64(g.bits)
+	}
+}
+
+func (vm *vm) popGlobal(g *Global) {
+	if isRef(g.Type.ValType) {
+		g.ref = vm.popRef(g.Type.ValType)
+	} else {
+		g.bits = vm.popU64()
+	}
+}
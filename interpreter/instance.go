@@ -0,0 +1,380 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+const DefaultMaxCallDepth = 10000
+
+// Imports maps module name -> field name -> *HostFunc, *Table, *Memory or
+// *Global.
+type Imports map[string]map[string]interface{}
+
+type HostFunc struct {
+	Type binary.FuncType
+	Fn   func(args []Value) ([]Value, error)
+}
+
+type function struct {
+	idx        binary.FuncIdx
+	typ        binary.FuncType
+	code       *binary.Code
+	localCount int
+	ends       []int // index of the matching End for each block/loop/if
+	elses      []int // index of the Else for each if, 0 if it has none
+	host       *HostFunc
+}
+
+type Instance struct {
+	// MaxCallDepth bounds the number of nested wasm calls, deeper
+	// calls trap with "call stack exhausted"
+	MaxCallDepth int
+
+	module  binary.Module
+	funcs   []*function
+	tables  []*Table
+	memory  *Memory
+	globals []*Global
+	datas   [][]byte  // data segments, nil once dropped
+	elems   [][]Value // element segments, nil once dropped
+	// references on the operand stack, see refBits
+	refs   []Value
+	refIdx map[Value]uint64
+	// state right after instantiation, see Reset
+	initialTables  [][]Value
+	initialMemory  []byte
+	initialGlobals []Global
+	initialDatas   [][]byte
+	initialElems   [][]Value
+}
+
+func Instantiate(module binary.Module, imports Imports) (inst *Instance, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			inst = nil
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	inst = &Instance{
+		MaxCallDepth: DefaultMaxCallDepth,
+		module:       module,
+		refIdx:       make(map[Value]uint64),
+	}
+	inst.linkImports(imports)
+	inst.initFuncs()
+	inst.initTables()
+	inst.initMemory()
+	inst.initGlobals()
+	inst.initElems()
+	inst.initData()
+	if module.StartSec != nil {
+		vm := newVM(inst)
+		vm.callFunc(inst.funcs[*module.StartSec])
+		vm.run(0)
+	}
+
+	for _, t := range inst.tables {
+		inst.initialTables = append(inst.initialTables, append([]Value(nil), t.elems...))
+	}
+	if inst.memory != nil {
+		inst.initialMemory = inst.memory.Snapshot()
+	}
+	for _, g := range inst.globals {
+		inst.initialGlobals = append(inst.initialGlobals, *g)
+	}
+	inst.initialDatas = append([][]byte(nil), inst.datas...)
+	inst.initialElems = append([][]Value(nil), inst.elems...)
+
+	return inst, nil
+}
+
+// Reset rolls the tables, the memory, the globals, imported ones
+// included, and the data and element segments back to their state right
+// after Instantiate returned. The start function is not run again.
+func (inst *Instance) Reset() error {
+	for i, t := range inst.tables {
+		t.elems = append(t.elems[:0:0], inst.initialTables[i]...)
+	}
+	if inst.memory != nil {
+		if err := inst.memory.Restore(inst.initialMemory); err != nil {
+			return err
+		}
+	}
+	for i, g := range inst.globals {
+		*g = inst.initialGlobals[i]
+	}
+	copy(inst.datas, inst.initialDatas)
+	copy(inst.elems, inst.initialElems)
+
+	return nil
+}
+
+// Global returns the value of global idx, imported globals come first
+func (inst *Instance) Global(idx binary.GlobalIdx) (Value, error) {
+	if int(idx) >= len(inst.globals) {
+		return nil, fmt.Errorf("unknown global %d", idx)
+	}
+	return inst.globals[idx].Get(), nil
+}
+
+// SetGlobal sets global idx, which must be mutable, to v. v must have the
+// global's type.
+func (inst *Instance) SetGlobal(idx binary.GlobalIdx, v Value) error {
+	if int(idx) >= len(inst.globals) {
+		return fmt.Errorf("unknown global %d", idx)
+	}
+	g := inst.globals[idx]
+	if g.Type.Mut != binary.MutVar {
+		return fmt.Errorf("global %d is immutable", idx)
+	}
+	return g.set(v)
+}
+
+func (inst *Instance) linkImports(imports Imports) {
+	for _, imp := range inst.module.ImportSec {
+		v, err := resolveImport(inst.module, imp, imports)
+		if err != nil {
+			panic(err)
+		}
+
+		switch x := v.(type) {
+		case *HostFunc:
+			inst.funcs = append(inst.funcs, &function{
+				idx:  binary.FuncIdx(len(inst.funcs)),
+				typ:  x.Type,
+				host: x,
+			})
+		case *Table:
+			inst.tables = append(inst.tables, x)
+		case *Memory:
+			inst.memory = x
+		case *Global:
+			inst.globals = append(inst.globals, x)
+		}
+	}
+}
+
+func (inst *Instance) initFuncs() {
+	for i, typeIdx := range inst.module.FuncSec {
+		code := &inst.module.CodeSec[i]
+		// Instantiate does not validate, the frame of each call is
+		// allocated with room for all the locals
+		localCount := code.GetLocalCount()
+		if localCount > binary.MaxLocals {
+			panic(fmt.Errorf("func %d: too many locals: %d", len(inst.funcs), localCount))
+		}
+		ends, elses := matchEnds(code.Expr)
+		inst.funcs = append(inst.funcs, &function{
+			idx:        binary.FuncIdx(len(inst.funcs)),
+			typ:        inst.module.TypeSec[typeIdx],
+			code:       code,
+			localCount: int(localCount),
+			ends:       ends,
+			elses:      elses,
+		})
+	}
+}
+
+func (inst *Instance) initTables() {
+	for _, tt := range inst.module.TableSec {
+		t, err := NewTable(tt)
+		if err != nil {
+			panic(err)
+		}
+		inst.tables = append(inst.tables, t)
+	}
+}
+
+func (inst *Instance) initMemory() {
+	for _, mt := range inst.module.MemSec {
+		mem, err := NewMemory(mt)
+		if err != nil {
+			panic(err)
+		}
+		inst.memory = mem
+	}
+}
+
+func (inst *Instance) initGlobals() {
+	for _, g := range inst.module.GlobalSec {
+		global := &Global{Type: g.Type}
+		if bits := inst.evalConstExpr(g.Init); isRef(g.Type.ValType) {
+			global.ref = inst.bitsRef(bits, g.Type.ValType)
+		} else {
+			global.bits = bits
+		}
+		inst.globals = append(inst.globals, global)
+	}
+}
+
+// initElems copies the active element segments into their tables, a
+// segment that doesn't fit traps. They are dropped afterwards, as if by
+// elem.drop, and so are the declarative ones. Passive segments are kept
+// for table.init.
+func (inst *Instance) initElems() {
+	inst.elems = make([][]Value, len(inst.module.ElemSec))
+	for i, elem := range inst.module.ElemSec {
+		var refs []Value
+		if elem.Exprs != nil {
+			refs = make([]Value, len(elem.Exprs))
+			for i, expr := range elem.Exprs {
+				refs[i] = inst.bitsRef(inst.evalConstExpr(expr), elem.Type)
+			}
+		} else {
+			refs = make([]Value, len(elem.Init))
+			for i, idx := range elem.Init {
+				refs[i] = Funcref{inst.funcs[idx]}
+			}
+		}
+
+		switch elem.Mode {
+		case binary.ElemModePassive:
+			inst.elems[i] = refs
+		case binary.ElemModeActive:
+			offset := uint32(inst.evalConstExpr(elem.Offset))
+			inst.tables[elem.Table].init(offset, refs)
+		}
+	}
+}
+
+// initData copies the active data segments into the memory. They are
+// dropped afterwards, as if by data.drop, passive segments are kept for
+// memory.init.
+func (inst *Instance) initData() {
+	inst.datas = make([][]byte, len(inst.module.DataSec))
+	for i, data := range inst.module.DataSec {
+		if data.Mode == binary.DataModePassive {
+			inst.datas[i] = data.Init
+			continue
+		}
+		offset := uint32(inst.evalConstExpr(data.Offset))
+		inst.memory.write(uint64(offset), data.Init)
+	}
+}
+
+func (inst *Instance) evalConstExpr(expr binary.Expr) uint64 {
+	vm := newVM(inst)
+	for _, instr := range expr {
+		switch instr.Opcode {
+		case binary.I32Const, binary.I64Const, binary.F32Const, binary.F64Const:
+			vm.execConst(instr)
+		case binary.GlobalGet:
+			// globals are appended as they are initialized
+			idx := instr.Args.(uint32)
+			if int(idx) >= len(inst.globals) {
+				panic(fmt.Errorf("global %d read before it is initialized", idx))
+			}
+			vm.pushGlobal(inst.globals[idx])
+		case binary.RefNull, binary.RefFunc:
+			vm.execTable(instr)
+		case binary.I32Add, binary.I32Sub, binary.I32Mul,
+			binary.I64Add, binary.I64Sub, binary.I64Mul:
+			// extended-const
+			vm.execNumeric(instr.Opcode)
+		case binary.End:
+		default:
+			panic(fmt.Errorf("constant expression required, got opcode: 0x%02x", instr.Opcode))
+		}
+	}
+
+	return vm.popU64()
+}
+
+func (inst *Instance) Invoke(name string, args ...Value) ([]Value, error) {
+	f, err := inst.exportedFunc(name)
+	if err != nil {
+		return nil, err
+	}
+	return inst.invokeFunc(f, args)
+}
+
+func (inst *Instance) exportedFunc(name string) (*function, error) {
+	if idx, ok := inst.module.ExportedFuncIndex(name); ok {
+		return inst.funcs[idx], nil
+	}
+
+	return nil, fmt.Errorf("unknown exported function: %s", name)
+}
+
+func (inst *Instance) invokeFunc(f *function, args []Value) (results []Value, err error) {
+	vm, err := inst.prepareCall(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			results = nil
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	vm.callFunc(f)
+	vm.run(0)
+
+	return vm.popResults(f), nil
+}
+
+// prepareCall returns a vm with the arguments of f on its stack
+func (inst *Instance) prepareCall(f *function, args []Value) (*vm, error) {
+	if len(args) != len(f.typ.ParamTypes) {
+		return nil, fmt.Errorf("expected %d arguments, got %d",
+			len(f.typ.ParamTypes), len(args))
+	}
+
+	vm := newVM(inst)
+	for i, arg := range args {
+		if err := vm.pushValue(arg, f.typ.ParamTypes[i]); err != nil {
+			return nil, err
+		}
+	}
+	return vm, nil
+}
+
+func (vm *vm) popResults(f *function) []Value {
+	results := make([]Value, len(f.typ.ResultTypes))
+	for i := len(results) - 1; i >= 0; i-- {
+		results[i] = vm.popValue(f.typ.ResultTypes[i])
+	}
+	return results
+}
+
+// matchEnds records, for every block, loop and if, the index
+// of the End instruction that closes it, and for every if the index
+// of its Else
+func matchEnds(expr binary.Expr) (ends, elses []int) {
+	ends = make([]int, len(expr))
+	elses = make([]int, len(expr))
+	var starts []int
+	for pc, instr := range expr {
+		switch instr.Opcode {
+		case binary.Block, binary.Loop, binary.If:
+			starts = append(starts, pc)
+		case binary.Else:
+			if len(starts) > 0 {
+				elses[starts[len(starts)-1]] = pc
+			}
+		case binary.End:
+			if len(starts) > 0 {
+				ends[starts[len(starts)-1]] = pc
+				starts = starts[:len(starts)-1]
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,121 @@
+package interpreter
+
+import (
+	"encoding/binary"
+
+	wasm "github.com/aiialzy/wasmer/binary"
+)
+
+func (vm *vm) execMemory(instr wasm.Instruction) {
+	mem := vm.inst.memory
+	switch instr.Opcode {
+	case wasm.MemorySize:
+		vm.pushU32(mem.Size())
+		return
+	case wasm.MemoryGrow:
+		vm.pushS32(mem.Grow(vm.popU32()))
+		return
+	}
+
+	memArg := instr.Args.(wasm.MemArg)
+	switch instr.Opcode {
+	case wasm.I32Load:
+		vm.pushU32(binary.LittleEndian.Uint32(vm.load(memArg, 4)))
+	case wasm.I64Load:
+		vm.pushU64(binary.LittleEndian.Uint64(vm.load(memArg, 8)))
+	case wasm.F32Load:
+		vm.pushU32(binary.LittleEndian.Uint32(vm.load(memArg, 4)))
+	case wasm.F64Load:
+		vm.pushU64(binary.LittleEndian.Uint64(vm.load(memArg, 8)))
+	case wasm.I32Load8S:
+		vm.pushS32(int32(int8(vm.load(memArg, 1)[0])))
+	case wasm.I32Load8U:
+		vm.pushU32(uint32(vm.load(memArg, 1)[0]))
+	case wasm.I32Load16S:
+		vm.pushS32(int32(int16(binary.LittleEndian.Uint16(vm.load(memArg, 2)))))
+	case wasm.I32Load16U:
+		vm.pushU32(uint32(binary.LittleEndian.Uint16(vm.load(memArg, 2))))
+	case wasm.I64Load8S:
+		vm.pushS64(int64(int8(vm.load(memArg, 1)[0])))
+	case wasm.I64Load8U:
+		vm.pushU64(uint64(vm.load(memArg, 1)[0]))
+	case wasm.I64Load16S:
+		vm.pushS64(int64(int16(binary.LittleEndian.Uint16(vm.load(memArg, 2)))))
+	case wasm.I64Load16U:
+		vm.pushU64(uint64(binary.LittleEndian.Uint16(vm.load(memArg, 2))))
+	case wasm.I64Load32S:
+		vm.pushS64(int64(int32(binary.LittleEndian.Uint32(vm.load(memArg, 4)))))
+	case wasm.I64Load32U:
+		vm.pushU64(uint64(binary.LittleEndian.Uint32(vm.load(memArg, 4))))
+	case wasm.I32Store, wasm.F32Store:
+		buf := make([]byte, 4)
+		binary.LittleEndian.PutUint32(buf, vm.popU32())
+		vm.store(memArg, buf)
+	case wasm.I64Store, wasm.F64Store:
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, vm.popU64())
+		vm.store(memArg, buf)
+	case wasm.I32Store8, wasm.I64Store8:
+		vm.store(memArg, []byte{byte(vm.popU64())})
+	case wasm.I32Store16, wasm.I64Store16:
+		buf := make([]byte, 2)
+		binary.LittleEndian.PutUint16(buf, uint16(vm.popU64()))
+		vm.store(memArg, buf)
+	case wasm.I64Store32:
+		buf := make([]byte, 4)
+		binary.LittleEndian.PutUint32(buf, uint32(vm.popU64()))
+		vm.store(memArg, buf)
+	}
+}
+
+func (vm *vm) load(memArg wasm.MemArg, n int) []byte {
+	buf := make([]byte, n)
+	vm.inst.memory.read(vm.effectiveAddress(memArg), buf)
+	return buf
+}
+
+// store pops the address, the value must have been popped already
+func (vm *vm) store(memArg wasm.MemArg, data []byte) {
+	vm.inst.memory.write(vm.effectiveAddress(memArg), data)
+}
+
+func (vm *vm) effectiveAddress(memArg wasm.MemArg) uint64 {
+	return uint64(vm.popU32()) + uint64(memArg.Offset)
+}
+
+// execBulkMemory runs memory.init, data.drop, memory.copy and memory.fill.
+// The ranges are checked before anything is written, so an instruction
+// that traps has no effect.
+func (vm *vm) execBulkMemory(instr wasm.Instruction) {
+	if instr.SubOpcode == wasm.DataDrop {
+		vm.inst.datas[instr.Args.(uint32)] = nil
+		return
+	}
+
+	mem := vm.inst.memory
+	n := uint64(vm.popU32())
+	switch instr.SubOpcode {
+	case wasm.MemoryInit:
+		data := vm.inst.datas[instr.Args.(uint32)]
+		s := uint64(vm.popU32())
+		d := uint64(vm.popU32())
+		if s+n > uint64(len(data)) {
+			panic(newTrap(trapOutOfBoundsMemory))
+		}
+		mem.write(d, data[s:s+n])
+	case wasm.MemoryCopy:
+		s := uint64(vm.popU32())
+		d := uint64(vm.popU32())
+		mem.checkOffset(s, int(n))
+		mem.checkOffset(d, int(n))
+		// copy 允许源和目标重叠, 效果同 memmove
+		copy(mem.Data[d:d+n], mem.Data[s:s+n])
+	case wasm.MemoryFill:
+		val := byte(vm.popU32())
+		d := uint64(vm.popU32())
+		mem.checkOffset(d, int(n))
+		for i := d; i < d+n; i++ {
+			mem.Data[i] = val
+		}
+	}
+}
@@ -0,0 +1,498 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+func (vm *vm) execConst(instr binary.Instruction) {
+	switch instr.Opcode {
+	case binary.I32Const:
+		vm.pushS32(instr.Args.(int32))
+	case binary.I64Const:
+		vm.pushS64(instr.Args.(int64))
+	case binary.F32Const:
+		vm.pushF32(instr.Args.(float32))
+	case binary.F64Const:
+		vm.pushF64(instr.Args.(float64))
+	}
+}
+
+func (vm *vm) execNumeric(opcode byte) {
+	switch {
+	case opcode <= binary.F64Ge:
+		vm.execCompare(opcode)
+	case opcode <= binary.I32Rotr:
+		vm.execI32Arith(opcode)
+	case opcode <= binary.I64Rotr:
+		vm.execI64Arith(opcode)
+	case opcode <= binary.F32CopySign:
+		vm.execF32Arith(opcode)
+	case opcode <= binary.F64CopySign:
+		vm.execF64Arith(opcode)
+	default:
+		vm.execConversion(opcode)
+	}
+}
+
+func (vm *vm) execCompare(opcode byte) {
+	switch opcode {
+	case binary.I32Eqz:
+		vm.pushBool(vm.popU32() == 0)
+	case binary.I64Eqz:
+		vm.pushBool(vm.popU64() == 0)
+	}
+
+	switch opcode {
+	case binary.I32Eq, binary.I32Ne, binary.I32LtS, binary.I32LtU, binary.I32GtS,
+		binary.I32GtU, binary.I32LeS, binary.I32LeU, binary.I32GeS, binary.I32GeU:
+		v2, v1 := vm.popU32(), vm.popU32()
+		s2, s1 := int32(v2), int32(v1)
+		switch opcode {
+		case binary.I32Eq:
+			vm.pushBool(v1 == v2)
+		case binary.I32Ne:
+			vm.pushBool(v1 != v2)
+		case binary.I32LtS:
+			vm.pushBool(s1 < s2)
+		case binary.I32LtU:
+			vm.pushBool(v1 < v2)
+		case binary.I32GtS:
+			vm.pushBool(s1 > s2)
+		case binary.I32GtU:
+			vm.pushBool(v1 > v2)
+		case binary.I32LeS:
+			vm.pushBool(s1 <= s2)
+		case binary.I32LeU:
+			vm.pushBool(v1 <= v2)
+		case binary.I32GeS:
+			vm.pushBool(s1 >= s2)
+		case binary.I32GeU:
+			vm.pushBool(v1 >= v2)
+		}
+	case binary.I64Eq, binary.I64Ne, binary.I64LtS, binary.I64LtU, binary.I64GtS,
+		binary.I64GtU, binary.I64LeS, binary.I64LeU, binary.I64GeS, binary.I64GeU:
+		v2, v1 := vm.popU64(), vm.popU64()
+		s2, s1 := int64(v2), int64(v1)
+		switch opcode {
+		case binary.I64Eq:
+			vm.pushBool(v1 == v2)
+		case binary.I64Ne:
+			vm.pushBool(v1 != v2)
+		case binary.I64LtS:
+			vm.pushBool(s1 < s2)
+		case binary.I64LtU:
+			vm.pushBool(v1 < v2)
+		case binary.I64GtS:
+			vm.pushBool(s1 > s2)
+		case binary.I64GtU:
+			vm.pushBool(v1 > v2)
+		case binary.I64LeS:
+			vm.pushBool(s1 <= s2)
+		case binary.I64LeU:
+			vm.pushBool(v1 <= v2)
+		case binary.I64GeS:
+			vm.pushBool(s1 >= s2)
+		case binary.I64GeU:
+			vm.pushBool(v1 >= v2)
+		}
+	case binary.F32Eq, binary.F32Ne, binary.F32Lt, binary.F32Gt, binary.F32Le, binary.F32Ge:
+		v2, v1 := vm.popF32(), vm.popF32()
+		switch opcode {
+		case binary.F32Eq:
+			vm.pushBool(v1 == v2)
+		case binary.F32Ne:
+			vm.pushBool(v1 != v2)
+		case binary.F32Lt:
+			vm.pushBool(v1 < v2)
+		case binary.F32Gt:
+			vm.pushBool(v1 > v2)
+		case binary.F32Le:
+			vm.pushBool(v1 <= v2)
+		case binary.F32Ge:
+			vm.pushBool(v1 >= v2)
+		}
+	case binary.F64Eq, binary.F64Ne, binary.F64Lt, binary.F64Gt, binary.F64Le, binary.F64Ge:
+		v2, v1 := vm.popF64(), vm.popF64()
+		switch opcode {
+		case binary.F64Eq:
+			vm.pushBool(v1 == v2)
+		case binary.F64Ne:
+			vm.pushBool(v1 != v2)
+		case binary.F64Lt:
+			vm.pushBool(v1 < v2)
+		case binary.F64Gt:
+			vm.pushBool(v1 > v2)
+		case binary.F64Le:
+			vm.pushBool(v1 <= v2)
+		case binary.F64Ge:
+			vm.pushBool(v1 >= v2)
+		}
+	}
+}
+
+func (vm *vm) execI32Arith(opcode byte) {
+	switch opcode {
+	case binary.I32Clz:
+		vm.pushU32(uint32(bits.LeadingZeros32(vm.popU32())))
+		return
+	case binary.I32Ctz:
+		vm.pushU32(uint32(bits.TrailingZeros32(vm.popU32())))
+		return
+	case binary.I32PopCnt:
+		vm.pushU32(uint32(bits.OnesCount32(vm.popU32())))
+		return
+	}
+
+	v2, v1 := vm.popU32(), vm.popU32()
+	switch opcode {
+	case binary.I32Add:
+		vm.pushU32(v1 + v2)
+	case binary.I32Sub:
+		vm.pushU32(v1 - v2)
+	case binary.I32Mul:
+		vm.pushU32(v1 * v2)
+	case binary.I32DivS:
+		if v2 == 0 {
+			panic(newTrap(trapIntegerDivideByZero))
+		}
+		if int32(v1) == math.MinInt32 && int32(v2) == -1 {
+			panic(newTrap(trapIntegerOverflow))
+		}
+		vm.pushS32(int32(v1) / int32(v2))
+	case binary.I32DivU:
+		if v2 == 0 {
+			panic(newTrap(trapIntegerDivideByZero))
+		}
+		vm.pushU32(v1 / v2)
+	case binary.I32RemS:
+		if v2 == 0 {
+			panic(newTrap(trapIntegerDivideByZero))
+		}
+		vm.pushS32(int32(v1) % int32(v2))
+	case binary.I32RemU:
+		if v2 == 0 {
+			panic(newTrap(trapIntegerDivideByZero))
+		}
+		vm.pushU32(v1 % v2)
+	case binary.I32And:
+		vm.pushU32(v1 & v2)
+	case binary.I32Or:
+		vm.pushU32(v1 | v2)
+	case binary.I32Xor:
+		vm.pushU32(v1 ^ v2)
+	case binary.I32Shl:
+		vm.pushU32(v1 << (v2 % 32))
+	case binary.I32ShrS:
+		vm.pushS32(int32(v1) >> (v2 % 32))
+	case binary.I32ShrU:
+		vm.pushU32(v1 >> (v2 % 32))
+	case binary.I32Rotl:
+		vm.pushU32(bits.RotateLeft32(v1, int(v2)))
+	case binary.I32Rotr:
+		vm.pushU32(bits.RotateLeft32(v1, -int(v2)))
+	}
+}
+
+func (vm *vm) execI64Arith(opcode byte) {
+	switch opcode {
+	case binary.I64Clz:
+		vm.pushU64(uint64(bits.LeadingZeros64(vm.popU64())))
+		return
+	case binary.I64Ctz:
+		vm.pushU64(uint64(bits.TrailingZeros64(vm.popU64())))
+		return
+	case binary.I64PopCnt:
+		vm.pushU64(uint64(bits.OnesCount64(vm.popU64())))
+		return
+	}
+
+	v2, v1 := vm.popU64(), vm.popU64()
+	switch opcode {
+	case binary.I64Add:
+		vm.pushU64(v1 + v2)
+	case binary.I64Sub:
+		vm.pushU64(v1 - v2)
+	case binary.I64Mul:
+		vm.pushU64(v1 * v2)
+	case binary.I64DivS:
+		if v2 == 0 {
+			panic(newTrap(trapIntegerDivideByZero))
+		}
+		if int64(v1) == math.MinInt64 && int64(v2) == -1 {
+			panic(newTrap(trapIntegerOverflow))
+		}
+		vm.pushS64(int64(v1) / int64(v2))
+	case binary.I64DivU:
+		if v2 == 0 {
+			panic(newTrap(trapIntegerDivideByZero))
+		}
+		vm.pushU64(v1 / v2)
+	case binary.I64RemS:
+		if v2 == 0 {
+			panic(newTrap(trapIntegerDivideByZero))
+		}
+		vm.pushS64(int64(v1) % int64(v2))
+	case binary.I64RemU:
+		if v2 == 0 {
+			panic(newTrap(trapIntegerDivideByZero))
+		}
+		vm.pushU64(v1 % v2)
+	case binary.I64And:
+		vm.pushU64(v1 & v2)
+	case binary.I64Or:
+		vm.pushU64(v1 | v2)
+	case binary.I64Xor:
+		vm.pushU64(v1 ^ v2)
+	case binary.I64Shl:
+		vm.pushU64(v1 << (v2 % 64))
+	case binary.I64ShrS:
+		vm.pushS64(int64(v1) >> (v2 % 64))
+	case binary.I64ShrU:
+		vm.pushU64(v1 >> (v2 % 64))
+	case binary.I64Rotl:
+		vm.pushU64(bits.RotateLeft64(v1, int(v2%64)))
+	case binary.I64Rotr:
+		vm.pushU64(bits.RotateLeft64(v1, -int(v2%64)))
+	}
+}
+
+func (vm *vm) execF32Arith(opcode byte) {
+	switch opcode {
+	case binary.F32Abs:
+		vm.pushU32(vm.popU32() &^ (1 << 31))
+		return
+	case binary.F32Neg:
+		vm.pushU32(vm.popU32() ^ (1 << 31))
+		return
+	case binary.F32Ceil:
+		vm.pushF32(float32(math.Ceil(float64(vm.popF32()))))
+		return
+	case binary.F32Floor:
+		vm.pushF32(float32(math.Floor(float64(vm.popF32()))))
+		return
+	case binary.F32Trunc:
+		vm.pushF32(float32(math.Trunc(float64(vm.popF32()))))
+		return
+	case binary.F32Nearest:
+		vm.pushF32(float32(math.RoundToEven(float64(vm.popF32()))))
+		return
+	case binary.F32Sqrt:
+		vm.pushF32(float32(math.Sqrt(float64(vm.popF32()))))
+		return
+	}
+
+	v2, v1 := vm.popF32(), vm.popF32()
+	switch opcode {
+	case binary.F32Add:
+		vm.pushF32(v1 + v2)
+	case binary.F32Sub:
+		vm.pushF32(v1 - v2)
+	case binary.F32Mul:
+		vm.pushF32(v1 * v2)
+	case binary.F32Div:
+		vm.pushF32(v1 / v2)
+	case binary.F32Min:
+		vm.pushF32(float32(fmin(float64(v1), float64(v2))))
+	case binary.F32Max:
+		vm.pushF32(float32(fmax(float64(v1), float64(v2))))
+	case binary.F32CopySign:
+		vm.pushF32(float32(math.Copysign(float64(v1), float64(v2))))
+	}
+}
+
+func (vm *vm) execF64Arith(opcode byte) {
+	switch opcode {
+	case binary.F64Abs:
+		vm.pushU64(vm.popU64() &^ (1 << 63))
+		return
+	case binary.F64Neg:
+		vm.pushU64(vm.popU64() ^ (1 << 63))
+		return
+	case binary.F64Ceil:
+		vm.pushF64(math.Ceil(vm.popF64()))
+		return
+	case binary.F64Floor:
+		vm.pushF64(math.Floor(vm.popF64()))
+		return
+	case binary.F64Trunc:
+		vm.pushF64(math.Trunc(vm.popF64()))
+		return
+	case binary.F64Nearest:
+		vm.pushF64(math.RoundToEven(vm.popF64()))
+		return
+	case binary.F64Sqrt:
+		vm.pushF64(math.Sqrt(vm.popF64()))
+		return
+	}
+
+	v2, v1 := vm.popF64(), vm.popF64()
+	switch opcode {
+	case binary.F64Add:
+		vm.pushF64(v1 + v2)
+	case binary.F64Sub:
+		vm.pushF64(v1 - v2)
+	case binary.F64Mul:
+		vm.pushF64(v1 * v2)
+	case binary.F64Div:
+		vm.pushF64(v1 / v2)
+	case binary.F64Min:
+		vm.pushF64(fmin(v1, v2))
+	case binary.F64Max:
+		vm.pushF64(fmax(v1, v2))
+	case binary.F64CopySign:
+		vm.pushF64(math.Copysign(v1, v2))
+	}
+}
+
+// wasm min/max propagate NaN and order -0 below +0
+func fmin(a, b float64) float64 {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.NaN()
+	}
+	return math.Min(a, b)
+}
+
+func fmax(a, b float64) float64 {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.NaN()
+	}
+	return math.Max(a, b)
+}
+
+func (vm *vm) execConversion(opcode byte) {
+	switch opcode {
+	case binary.I32WrapI64:
+		vm.pushU32(uint32(vm.popU64()))
+	case binary.I32TruncF32S:
+		vm.pushS32(int32(truncS(float64(vm.popF32()), math.MinInt32, math.MaxInt32)))
+	case binary.I32TruncF32U:
+		vm.pushU32(uint32(truncU(float64(vm.popF32()), math.MaxUint32)))
+	case binary.I32TruncF64S:
+		vm.pushS32(int32(truncS(vm.popF64(), math.MinInt32, math.MaxInt32)))
+	case binary.I32TruncF64U:
+		vm.pushU32(uint32(truncU(vm.popF64(), math.MaxUint32)))
+	case binary.I64ExtendI32S:
+		vm.pushS64(int64(vm.popS32()))
+	case binary.I64ExtendI32U:
+		vm.pushU64(uint64(vm.popU32()))
+	case binary.I64TruncF32S:
+		vm.pushS64(truncS(float64(vm.popF32()), math.MinInt64, math.MaxInt64))
+	case binary.I64TruncF32U:
+		vm.pushU64(truncU(float64(vm.popF32()), math.MaxUint64))
+	case binary.I64TruncF64S:
+		vm.pushS64(truncS(vm.popF64(), math.MinInt64, math.MaxInt64))
+	case binary.I64TruncF64U:
+		vm.pushU64(truncU(vm.popF64(), math.MaxUint64))
+	case binary.F32ConvertI32S:
+		vm.pushF32(float32(vm.popS32()))
+	case binary.F32ConvertI32U:
+		vm.pushF32(float32(vm.popU32()))
+	case binary.F32ConvertI64S:
+		vm.pushF32(float32(vm.popS64()))
+	case binary.F32ConvertI64U:
+		vm.pushF32(float32(vm.popU64()))
+	case binary.F32DemoteF64:
+		vm.pushF32(float32(vm.popF64()))
+	case binary.F64ConvertI32S:
+		vm.pushF64(float64(vm.popS32()))
+	case binary.F64ConvertI32U:
+		vm.pushF64(float64(vm.popU32()))
+	case binary.F64ConvertI64S:
+		vm.pushF64(float64(vm.popS64()))
+	case binary.F64ConvertI64U:
+		vm.pushF64(float64(vm.popU64()))
+	case binary.F64PromoteF32:
+		vm.pushF64(float64(vm.popF32()))
+	case binary.I32ReinterpretF32, binary.F32ReinterpretI32:
+		vm.pushU32(vm.popU32())
+	case binary.I64ReinterpretF64, binary.F64ReinterpretI64:
+		vm.pushU64(vm.popU64())
+	case binary.I32Extend8S:
+		vm.pushS32(int32(int8(vm.popU32())))
+	case binary.I32Extend16S:
+		vm.pushS32(int32(int16(vm.popU32())))
+	case binary.I64Extend8S:
+		vm.pushS64(int64(int8(vm.popU64())))
+	case binary.I64Extend16S:
+		vm.pushS64(int64(int16(vm.popU64())))
+	case binary.I64Extend32S:
+		vm.pushS64(int64(int32(vm.popU64())))
+	default:
+		panic(fmt.Errorf("unsupported instruction: 0x%02x", opcode))
+	}
+}
+
+// truncS truncates f towards zero, trapping unless the result
+// lies in [min, max]
+func truncS(f float64, min, max int64) int64 {
+	if math.IsNaN(f) {
+		panic(newTrap(trapInvalidConversion))
+	}
+	f = math.Trunc(f)
+	if f < float64(min) || f >= -float64(min) || int64(f) > max {
+		panic(newTrap(trapIntegerOverflow))
+	}
+	return int64(f)
+}
+
+func truncU(f float64, max uint64) uint64 {
+	if math.IsNaN(f) {
+		panic(newTrap(trapInvalidConversion))
+	}
+	f = math.Trunc(f)
+	if f < 0 || f >= float64(max)+1 {
+		panic(newTrap(trapIntegerOverflow))
+	}
+	return uint64(f)
+}
+
+func (vm *vm) execTruncSat(subOpcode uint32) {
+	switch subOpcode {
+	case binary.I32TruncSatF32S:
+		vm.pushS32(int32(truncSatS(float64(vm.popF32()), math.MinInt32, math.MaxInt32)))
+	case binary.I32TruncSatF32U:
+		vm.pushU32(uint32(truncSatU(float64(vm.popF32()), math.MaxUint32)))
+	case binary.I32TruncSatF64S:
+		vm.pushS32(int32(truncSatS(vm.popF64(), math.MinInt32, math.MaxInt32)))
+	case binary.I32TruncSatF64U:
+		vm.pushU32(uint32(truncSatU(vm.popF64(), math.MaxUint32)))
+	case binary.I64TruncSatF32S:
+		vm.pushS64(truncSatS(float64(vm.popF32()), math.MinInt64, math.MaxInt64))
+	case binary.I64TruncSatF32U:
+		vm.pushU64(truncSatU(float64(vm.popF32()), math.MaxUint64))
+	case binary.I64TruncSatF64S:
+		vm.pushS64(truncSatS(vm.popF64(), math.MinInt64, math.MaxInt64))
+	case binary.I64TruncSatF64U:
+		vm.pushU64(truncSatU(vm.popF64(), math.MaxUint64))
+	}
+}
+
+func truncSatS(f float64, min, max int64) int64 {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f <= float64(min):
+		return min
+	case f >= -float64(min):
+		return max
+	}
+	n := int64(math.Trunc(f))
+	if n > max {
+		return max
+	}
+	return n
+}
+
+func truncSatU(f float64, max uint64) uint64 {
+	switch {
+	case math.IsNaN(f) || f <= 0:
+		return 0
+	case f >= float64(max)+1:
+		return max
+	}
+	return uint64(math.Trunc(f))
+}
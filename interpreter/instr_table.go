@@ -0,0 +1,105 @@
+package interpreter
+
+import (
+	"github.com/aiialzy/wasmer/binary"
+)
+
+// execTable runs the table and reference instructions. table.init,
+// table.copy and table.fill check their ranges before writing anything.
+func (vm *vm) execTable(instr binary.Instruction) {
+	switch instr.Opcode {
+	case binary.RefNull:
+		vm.pushU64(0)
+		return
+	case binary.RefIsNull:
+		vm.pushBool(vm.popU64() == 0)
+		return
+	case binary.RefFunc:
+		vm.pushRef(Funcref{vm.inst.funcs[instr.Args.(uint32)]})
+		return
+	}
+	switch instr.SubOpcode {
+	case binary.TableInit:
+		args := instr.Args.(binary.TableInitArgs)
+		elem := vm.inst.elems[args.Elem]
+		n := uint64(vm.popU32())
+		s := uint64(vm.popU32())
+		d := vm.popU32()
+		if s+n > uint64(len(elem)) {
+			panic(newTrap(trapOutOfBoundsTable))
+		}
+		vm.inst.tables[args.Table].init(d, elem[s:s+n])
+		return
+	case binary.ElemDrop:
+		vm.inst.elems[instr.Args.(uint32)] = nil
+		return
+	case binary.TableCopy:
+		args := instr.Args.(binary.TableCopyArgs)
+		dst, src := vm.inst.tables[args.Dst], vm.inst.tables[args.Src]
+		n := uint64(vm.popU32())
+		s := uint64(vm.popU32())
+		d := uint64(vm.popU32())
+		if s+n > uint64(src.Size()) || d+n > uint64(dst.Size()) {
+			panic(newTrap(trapOutOfBoundsTable))
+		}
+		// copy 允许源和目标重叠
+		copy(dst.elems[d:d+n], src.elems[s:s+n])
+		return
+	}
+
+	t := vm.inst.tables[instr.Args.(uint32)]
+	et := t.Type.ElemType
+	switch {
+	case instr.Opcode == binary.TableGet:
+		vm.pushRef(t.get(vm.popU32()))
+	case instr.Opcode == binary.TableSet:
+		r := vm.popRef(et)
+		t.set(vm.popU32(), r)
+	case instr.SubOpcode == binary.TableSize:
+		vm.pushU32(t.Size())
+	case instr.SubOpcode == binary.TableGrow:
+		n := vm.popU32()
+		vm.pushS32(t.grow(n, vm.popRef(et)))
+	case instr.SubOpcode == binary.TableFill:
+		n := uint64(vm.popU32())
+		r := vm.popRef(et)
+		d := uint64(vm.popU32())
+		if d+n > uint64(t.Size()) {
+			panic(newTrap(trapOutOfBoundsTable))
+		}
+		for i := d; i < d+n; i++ {
+			t.elems[i] = r
+		}
+	}
+}
+
+func (vm *vm) pushRef(r Value) {
+	vm.pushU64(vm.inst.refBits(r))
+}
+
+func (vm *vm) popRef(vt binary.ValType) Value {
+	return vm.inst.bitsRef(vm.popU64(), vt)
+}
+
+// refBits returns the operand stack form of r, a Funcref or an Externref:
+// 1 + an index in inst.refs, so that 0 is the null reference
+func (inst *Instance) refBits(r Value) uint64 {
+	if r.(interface{ IsNull() bool }).IsNull() {
+		return 0
+	}
+	bits, ok := inst.refIdx[r]
+	if !ok {
+		inst.refs = append(inst.refs, r)
+		bits = uint64(len(inst.refs))
+		inst.refIdx[r] = bits
+	}
+	return bits
+}
+
+// bitsRef returns the reference of type vt that refBits turned into bits
+func (inst *Instance) bitsRef(bits uint64, vt binary.ValType) Value {
+	if bits == 0 {
+		return nullRef(vt)
+	}
+	return inst.refs[bits-1]
+}
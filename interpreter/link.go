@@ -0,0 +1,119 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+// CheckLink checks that imports provides every import of m with a
+// compatible type, as Instantiate does, without instantiating m or
+// running anything. All the problems found are reported.
+func CheckLink(m binary.Module, imports Imports) error {
+	var problems []string
+	for _, imp := range m.ImportSec {
+		if _, err := resolveImport(m, imp, imports); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// resolveImport returns what imports provides for imp, if it exists and
+// matches the type imp asks for
+func resolveImport(m binary.Module, imp binary.Import, imports Imports) (interface{}, error) {
+	v, ok := imports[imp.Module][imp.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown import: %s.%s", imp.Module, imp.Name)
+	}
+	incompatible := func(format string, a ...interface{}) error {
+		return fmt.Errorf("incompatible import type: %s.%s: %s",
+			imp.Module, imp.Name, fmt.Sprintf(format, a...))
+	}
+
+	switch imp.Desc.Tag {
+	case binary.ImportTagFunc:
+		if int(imp.Desc.FuncType) >= len(m.TypeSec) {
+			return nil, fmt.Errorf("unknown type %d", imp.Desc.FuncType)
+		}
+		ft := m.TypeSec[imp.Desc.FuncType]
+		hf, ok := v.(*HostFunc)
+		if !ok {
+			return nil, incompatible("expected a function, got %s", externKind(v))
+		}
+		if !hf.Type.Equal(ft) {
+			return nil, incompatible("expected %s, got %s", ft, hf.Type)
+		}
+	case binary.ImportTagTable:
+		t, ok := v.(*Table)
+		if !ok {
+			return nil, incompatible("expected a table, got %s", externKind(v))
+		}
+		if t.Type.ElemType != imp.Desc.Table.ElemType {
+			return nil, incompatible("expected %s elements, got %s",
+				binary.ValTypeToStr(imp.Desc.Table.ElemType), binary.ValTypeToStr(t.Type.ElemType))
+		}
+		if err := matchLimits(t.Size(), t.Type.Limits, imp.Desc.Table.Limits); err != "" {
+			return nil, incompatible("table %s", err)
+		}
+	case binary.ImportTagMem:
+		mem, ok := v.(*Memory)
+		if !ok {
+			return nil, incompatible("expected a memory, got %s", externKind(v))
+		}
+		if err := matchLimits(mem.Size(), mem.Type, imp.Desc.Mem); err != "" {
+			return nil, incompatible("memory %s", err)
+		}
+	case binary.ImportTagGlobal:
+		g, ok := v.(*Global)
+		if !ok {
+			return nil, incompatible("expected a global, got %s", externKind(v))
+		}
+		if g.Type != imp.Desc.Global {
+			return nil, incompatible("expected %s, got %s", imp.Desc.Global, g.Type)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported import: %s.%s", imp.Module, imp.Name)
+	}
+
+	return v, nil
+}
+
+// matchLimits checks a table or memory of the given current size and
+// limits against the limits an import requires: it must be at least as
+// large as the minimum and, if there is a maximum, must not grow beyond
+// it. The problem is returned as a string, "" if there is none.
+func matchLimits(size uint32, actual, required binary.Limits) string {
+	if size < required.Min {
+		return fmt.Sprintf("size %d is less than the minimum %d", size, required.Min)
+	}
+	if required.Tag == 1 {
+		if actual.Tag != 1 {
+			return fmt.Sprintf("has no maximum, expected at most %d", required.Max)
+		}
+		if actual.Max > required.Max {
+			return fmt.Sprintf("maximum %d is more than %d", actual.Max, required.Max)
+		}
+	}
+	return ""
+}
+
+func externKind(v interface{}) string {
+	switch v.(type) {
+	case *HostFunc:
+		return "a function"
+	case *Table:
+		return "a table"
+	case *Memory:
+		return "a memory"
+	case *Global:
+		return "a global"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,123 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+const (
+	PageSize = 65536
+	MaxPages = 65536
+)
+
+type Memory struct {
+	Type binary.MemType
+	Data []byte
+}
+
+func NewMemory(mt binary.MemType) (*Memory, error) {
+	if mt.Min > MaxPages {
+		return nil, fmt.Errorf("memory size must be at most %d pages", MaxPages)
+	}
+
+	data, err := allocPages(mt.Min)
+	if err != nil {
+		return nil, err
+	}
+	return &Memory{
+		Type: mt,
+		Data: data,
+	}, nil
+}
+
+// allocPages allocates n zeroed pages. 4GiB memories do not fit in the
+// address space of 32-bit platforms, and make panics on sizes the
+// runtime can not reserve.
+func allocPages(n uint32) (data []byte, err error) {
+	size := uint64(n) * PageSize
+	if size > math.MaxInt {
+		return nil, fmt.Errorf("out of memory: can not allocate %d pages (%d bytes)", n, size)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			data, err = nil, fmt.Errorf("out of memory: can not allocate %d pages (%d bytes): %v", n, size, r)
+		}
+	}()
+	return make([]byte, size), nil
+}
+
+func (mem *Memory) Size() uint32 {
+	return uint32(len(mem.Data) / PageSize)
+}
+
+// Grow returns the previous size in pages, or -1 if the memory
+// can not grow by n pages.
+func (mem *Memory) Grow(n uint32) int32 {
+	oldSize := mem.Size()
+	if n == 0 {
+		return int32(oldSize)
+	}
+
+	maxPages := uint32(MaxPages)
+	if mem.Type.Tag == 1 && mem.Type.Max < maxPages {
+		maxPages = mem.Type.Max
+	}
+	if n > maxPages-oldSize {
+		return -1
+	}
+
+	newData, err := allocPages(oldSize + n)
+	if err != nil {
+		return -1
+	}
+	copy(newData, mem.Data)
+	mem.Data = newData
+	return int32(oldSize)
+}
+
+// Snapshot returns a copy of the memory's content.
+func (mem *Memory) Snapshot() []byte {
+	snap := make([]byte, len(mem.Data))
+	copy(snap, mem.Data)
+	return snap
+}
+
+// Restore sets the memory's content, and size, back to a snapshot. The
+// snapshot must be a size the memory type allows.
+func (mem *Memory) Restore(snap []byte) error {
+	if len(snap)%PageSize != 0 {
+		return fmt.Errorf("snapshot size %d is not a multiple of the page size", len(snap))
+	}
+	pages := uint64(len(snap) / PageSize)
+	maxPages := uint64(MaxPages)
+	if mem.Type.Tag == 1 {
+		maxPages = uint64(mem.Type.Max)
+	}
+	if pages < uint64(mem.Type.Min) || pages > maxPages {
+		return fmt.Errorf("snapshot of %d pages does not fit memory %s", pages, mem.Type)
+	}
+
+	if len(snap) != len(mem.Data) {
+		mem.Data = make([]byte, len(snap))
+	}
+	copy(mem.Data, snap)
+	return nil
+}
+
+func (mem *Memory) read(offset uint64, buf []byte) {
+	mem.checkOffset(offset, len(buf))
+	copy(buf, mem.Data[offset:])
+}
+
+func (mem *Memory) write(offset uint64, data []byte) {
+	mem.checkOffset(offset, len(data))
+	copy(mem.Data[offset:], data)
+}
+
+func (mem *Memory) checkOffset(offset uint64, length int) {
+	if offset+uint64(length) > uint64(len(mem.Data)) {
+		panic(newTrap(trapOutOfBoundsMemory))
+	}
+}
@@ -0,0 +1,82 @@
+package interpreter
+
+import (
+	"errors"
+)
+
+// Continuation is a call started by InvokeResumable. Until it is done, it
+// holds the paused call: the frames with their locals and positions, and
+// the operand stack.
+type Continuation struct {
+	vm      *vm
+	fn      *function
+	done    bool
+	results []Value
+}
+
+// InvokeResumable calls exported function name like Invoke, but pauses
+// once fuel instructions have run. The call goes on with Resume. The
+// instance must not be used for other calls, or Reset, while a call is
+// paused, host functions run to completion within a single step.
+func (inst *Instance) InvokeResumable(name string, fuel uint64, args ...Value) (*Continuation, error) {
+	f, err := inst.exportedFunc(name)
+	if err != nil {
+		return nil, err
+	}
+	vm, err := inst.prepareCall(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Continuation{vm: vm, fn: f}
+	vm.metered = true
+	if err := c.step(fuel, true); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Resume continues the call for at most fuel more instructions. A trap
+// ends the call, like finishing it does.
+func (c *Continuation) Resume(fuel uint64) error {
+	if c.vm == nil {
+		return errors.New("call already finished")
+	}
+	return c.step(fuel, false)
+}
+
+func (c *Continuation) step(fuel uint64, start bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.vm = nil
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	c.vm.fuel = fuel
+	if start {
+		c.vm.callFunc(c.fn)
+	}
+	c.vm.run(0)
+	if len(c.vm.frames) == 0 {
+		c.results = c.vm.popResults(c.fn)
+		c.done = true
+		c.vm = nil
+	}
+	return nil
+}
+
+// Done reports whether the call has returned
+func (c *Continuation) Done() bool {
+	return c.done
+}
+
+// Results returns the results of the call once it is done
+func (c *Continuation) Results() []Value {
+	return c.results
+}
@@ -0,0 +1,78 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+// MaxTableSize bounds the size of a table
+const MaxTableSize = 10000000
+
+type Table struct {
+	Type  binary.TableType
+	elems []Value // Funcref or Externref, as the element type says
+}
+
+func NewTable(tt binary.TableType) (*Table, error) {
+	if tt.Limits.Min > MaxTableSize {
+		return nil, fmt.Errorf("table size must be at most %d elements", MaxTableSize)
+	}
+
+	t := &Table{Type: tt}
+	t.grow(tt.Limits.Min, nullRef(tt.ElemType))
+	return t, nil
+}
+
+func (t *Table) Size() uint32 {
+	return uint32(len(t.elems))
+}
+
+// Grow adds n elements set to init, a reference of the element type of t,
+// and returns the previous size, or -1 if the table can not grow by n
+// elements.
+func (t *Table) Grow(n uint32, init Value) (int32, error) {
+	if err := checkRef(init, t.Type.ElemType); err != nil {
+		return -1, err
+	}
+	return t.grow(n, init), nil
+}
+
+func (t *Table) grow(n uint32, init Value) int32 {
+	oldSize := t.Size()
+	maxSize := uint32(MaxTableSize)
+	if t.Type.Limits.Tag == 1 && t.Type.Limits.Max < maxSize {
+		maxSize = t.Type.Limits.Max
+	}
+	if n > maxSize-oldSize {
+		return -1
+	}
+
+	for i := uint32(0); i < n; i++ {
+		t.elems = append(t.elems, init)
+	}
+	return int32(oldSize)
+}
+
+func (t *Table) get(i uint32) Value {
+	if i >= t.Size() {
+		panic(newTrap(trapOutOfBoundsTable))
+	}
+	return t.elems[i]
+}
+
+func (t *Table) set(i uint32, r Value) {
+	if i >= t.Size() {
+		panic(newTrap(trapOutOfBoundsTable))
+	}
+	t.elems[i] = r
+}
+
+// init copies refs into the table from offset on, trapping if they don't
+// fit. Nothing is written in that case.
+func (t *Table) init(offset uint32, refs []Value) {
+	if uint64(offset)+uint64(len(refs)) > uint64(len(t.elems)) {
+		panic(newTrap(trapOutOfBoundsTable))
+	}
+	copy(t.elems[offset:], refs)
+}
@@ -0,0 +1,80 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+type Trap struct {
+	Msg string
+	// Backtrace holds the wasm frames active when the trap happened, the
+	// trapping one first
+	Backtrace []TraceFrame
+}
+
+// TraceFrame is a function in a trap backtrace. Instr is the index, in
+// the function body, of the instruction that trapped or of the call the
+// function was executing, and Offset the absolute byte offset of that
+// instruction in the module. Offset is -1 unless the module was decoded
+// with DecodeOptions.RecordCodeOffsets.
+type TraceFrame struct {
+	Func   binary.FuncIdx
+	Name   string // from the "name" section, "" if unknown
+	Instr  int
+	Offset int
+}
+
+// maxErrorFrames bounds the frames Error lists, the call stack may be
+// thousands of frames deep
+const maxErrorFrames = 10
+
+func (trap *Trap) Error() string {
+	if len(trap.Backtrace) == 0 {
+		return trap.Msg
+	}
+	sb := strings.Builder{}
+	sb.WriteString(trap.Msg)
+	for i, tf := range trap.Backtrace {
+		if i == maxErrorFrames {
+			fmt.Fprintf(&sb, ", ... %d more", len(trap.Backtrace)-i)
+			break
+		}
+		if i == 0 {
+			sb.WriteString(" in ")
+		} else {
+			sb.WriteString(", called from ")
+		}
+		sb.WriteString(tf.String())
+	}
+	return sb.String()
+}
+
+func (tf TraceFrame) String() string {
+	at := fmt.Sprintf("instr %d", tf.Instr)
+	if tf.Offset >= 0 {
+		at = fmt.Sprintf("offset 0x%x", tf.Offset)
+	}
+	if tf.Name != "" {
+		return fmt.Sprintf("$%s (func %d, %s)", tf.Name, tf.Func, at)
+	}
+	return fmt.Sprintf("func %d (%s)", tf.Func, at)
+}
+
+func newTrap(msg string) *Trap {
+	return &Trap{Msg: msg}
+}
+
+const (
+	trapUnreachable         = "unreachable"
+	trapCallStackExhausted  = "call stack exhausted"
+	trapIntegerDivideByZero = "integer divide by zero"
+	trapIntegerOverflow     = "integer overflow"
+	trapInvalidConversion   = "invalid conversion to integer"
+	trapOutOfBoundsMemory   = "out of bounds memory access"
+	trapOutOfBoundsTable    = "out of bounds table access"
+	trapUndefinedElement    = "undefined element"
+	trapUninitialized       = "uninitialized element"
+	trapIndirectCallType    = "indirect call type mismatch"
+)
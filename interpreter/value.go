@@ -0,0 +1,113 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+// Value is an int32, int64, float32, float64, Funcref or Externref,
+// matching the wasm value types i32, i64, f32, f64, funcref and externref.
+type Value = interface{}
+
+// Funcref is a funcref Value, a function of an instance. The zero Funcref
+// is the null reference.
+type Funcref struct {
+	fn *function
+}
+
+func (r Funcref) IsNull() bool {
+	return r.fn == nil
+}
+
+// Externref is an externref Value, a host value that wasm code passes
+// around without looking into it. The zero Externref is the null
+// reference, NewExternref makes the others.
+type Externref struct {
+	host *interface{}
+}
+
+// NewExternref returns a reference to host. Each call returns a distinct
+// reference, even for equal host values.
+func NewExternref(host interface{}) Externref {
+	return Externref{host: &host}
+}
+
+func (r Externref) IsNull() bool {
+	return r.host == nil
+}
+
+// Host returns the value r was made from, nil for the null reference
+func (r Externref) Host() interface{} {
+	if r.host == nil {
+		return nil
+	}
+	return *r.host
+}
+
+func isRef(vt binary.ValType) bool {
+	return vt == binary.FuncRef || vt == binary.ExternRef
+}
+
+// nullRef returns the null reference of reference type vt
+func nullRef(vt binary.ValType) Value {
+	if vt == binary.ExternRef {
+		return Externref{}
+	}
+	return Funcref{}
+}
+
+// checkRef checks that v is a reference of type vt
+func checkRef(v Value, vt binary.ValType) error {
+	switch v.(type) {
+	case Funcref:
+		if vt == binary.FuncRef {
+			return nil
+		}
+	case Externref:
+		if vt == binary.ExternRef {
+			return nil
+		}
+	}
+	return fmt.Errorf("type mismatch: expected %s, got %T", binary.ValTypeToStr(vt), v)
+}
+
+func toBits(v Value, vt binary.ValType) (uint64, error) {
+	switch vt {
+	case binary.ValTypeI32:
+		if x, ok := v.(int32); ok {
+			return uint64(uint32(x)), nil
+		}
+	case binary.ValTypeI64:
+		if x, ok := v.(int64); ok {
+			return uint64(x), nil
+		}
+	case binary.ValTypeF32:
+		if x, ok := v.(float32); ok {
+			return uint64(math.Float32bits(x)), nil
+		}
+	case binary.ValTypeF64:
+		if x, ok := v.(float64); ok {
+			return math.Float64bits(x), nil
+		}
+	}
+
+	return 0, fmt.Errorf("type mismatch: expected %s, got %T",
+		binary.ValTypeToStr(vt), v)
+}
+
+func fromBits(bits uint64, vt binary.ValType) Value {
+	switch vt {
+	case binary.ValTypeI32:
+		return int32(bits)
+	case binary.ValTypeI64:
+		return int64(bits)
+	case binary.ValTypeF32:
+		return math.Float32frombits(uint32(bits))
+	case binary.ValTypeF64:
+		return math.Float64frombits(bits)
+	default:
+		panic(fmt.Errorf("unsupported value type: %d", vt))
+	}
+}
@@ -0,0 +1,360 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+type label struct {
+	opcode byte
+	arity  int // number of values a branch to this label carries
+	height int // operand stack height below the label's values
+	start  int // index of the first instruction inside the block
+	end    int // index of the End closing the block
+}
+
+type frame struct {
+	fn     *function
+	locals []uint64
+	labels []label
+	pc     int
+	height int // operand stack height below the arguments
+}
+
+type vm struct {
+	inst   *Instance
+	stack  []uint64
+	frames []frame
+	// with metered set, run stops when fuel, the number of instructions
+	// it may still execute, runs out
+	metered bool
+	fuel    uint64
+}
+
+func newVM(inst *Instance) *vm {
+	return &vm{inst: inst}
+}
+
+func (vm *vm) pushU64(n uint64) {
+	vm.stack = append(vm.stack, n)
+}
+
+func (vm *vm) popU64() uint64 {
+	n := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return n
+}
+
+func (vm *vm) pushU32(n uint32)  { vm.pushU64(uint64(n)) }
+func (vm *vm) popU32() uint32    { return uint32(vm.popU64()) }
+func (vm *vm) pushS32(n int32)   { vm.pushU64(uint64(uint32(n))) }
+func (vm *vm) popS32() int32     { return int32(vm.popU64()) }
+func (vm *vm) pushS64(n int64)   { vm.pushU64(uint64(n)) }
+func (vm *vm) popS64() int64     { return int64(vm.popU64()) }
+func (vm *vm) pushF32(f float32) { vm.pushU64(uint64(math.Float32bits(f))) }
+func (vm *vm) popF32() float32   { return math.Float32frombits(uint32(vm.popU64())) }
+func (vm *vm) pushF64(f float64) { vm.pushU64(math.Float64bits(f)) }
+func (vm *vm) popF64() float64   { return math.Float64frombits(vm.popU64()) }
+func (vm *vm) popBool() bool     { return vm.popU64() != 0 }
+func (vm *vm) pushBool(b bool) {
+	if b {
+		vm.pushU64(1)
+	} else {
+		vm.pushU64(0)
+	}
+}
+
+// pushValue pushes v, which must be of type vt
+func (vm *vm) pushValue(v Value, vt binary.ValType) error {
+	if isRef(vt) {
+		if err := checkRef(v, vt); err != nil {
+			return err
+		}
+		vm.pushRef(v)
+		return nil
+	}
+	bits, err := toBits(v, vt)
+	if err != nil {
+		return err
+	}
+	vm.pushU64(bits)
+	return nil
+}
+
+func (vm *vm) popValue(vt binary.ValType) Value {
+	if isRef(vt) {
+		return vm.popRef(vt)
+	}
+	return fromBits(vm.popU64(), vt)
+}
+
+// callFunc calls f with its arguments on top of the operand stack. Host
+// functions run immediately, wasm functions get a new frame that run
+// executes.
+func (vm *vm) callFunc(f *function) {
+	if f.host != nil {
+		vm.callHostFunc(f)
+		return
+	}
+
+	if len(vm.frames) >= vm.inst.MaxCallDepth {
+		panic(newTrap(trapCallStackExhausted))
+	}
+
+	paramCount := len(f.typ.ParamTypes)
+	locals := make([]uint64, paramCount+f.localCount)
+	copy(locals, vm.stack[len(vm.stack)-paramCount:])
+	vm.stack = vm.stack[:len(vm.stack)-paramCount]
+
+	vm.frames = append(vm.frames, frame{
+		fn:     f,
+		locals: locals,
+		height: len(vm.stack),
+		labels: []label{{
+			opcode: binary.Block,
+			arity:  len(f.typ.ResultTypes),
+			height: len(vm.stack),
+			end:    len(f.code.Expr) - 1,
+		}},
+	})
+}
+
+func (vm *vm) callIndirect(args binary.CallIndirectArgs) {
+	t := vm.inst.tables[args.Table]
+	i := vm.popU32()
+	if i >= t.Size() {
+		panic(newTrap(trapUndefinedElement))
+	}
+	f := t.elems[i].(Funcref).fn
+	if f == nil {
+		panic(newTrap(trapUninitialized))
+	}
+	if !f.typ.Equal(vm.inst.module.TypeSec[args.Type]) {
+		panic(newTrap(trapIndirectCallType))
+	}
+	vm.callFunc(f)
+}
+
+func (vm *vm) callHostFunc(f *function) {
+	args := make([]Value, len(f.typ.ParamTypes))
+	for i := len(args) - 1; i >= 0; i-- {
+		args[i] = vm.popValue(f.typ.ParamTypes[i])
+	}
+
+	results, err := f.host.Fn(args)
+	if err != nil {
+		panic(newTrap(err.Error()))
+	}
+	if len(results) != len(f.typ.ResultTypes) {
+		panic(fmt.Errorf("host function returned %d results, expected %d",
+			len(results), len(f.typ.ResultTypes)))
+	}
+	for i, result := range results {
+		if err := vm.pushValue(result, f.typ.ResultTypes[i]); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// run executes instructions until the frame stack shrinks back to depth,
+// or a metered vm is out of fuel. All the state lives in vm, so calling
+// run again picks up where it stopped.
+func (vm *vm) run(depth int) {
+	defer func() {
+		if r := recover(); r != nil {
+			if trap, ok := r.(*Trap); ok && trap.Backtrace == nil {
+				trap.Backtrace = vm.backtrace()
+			}
+			panic(r)
+		}
+	}()
+
+	for len(vm.frames) > depth {
+		if vm.metered {
+			if vm.fuel == 0 {
+				return
+			}
+			vm.fuel--
+		}
+		fr := &vm.frames[len(vm.frames)-1]
+		expr := fr.fn.code.Expr
+		if fr.pc >= len(expr) {
+			vm.ret(fr)
+			continue
+		}
+
+		instr := expr[fr.pc]
+		fr.pc++
+		vm.execInstr(fr, instr)
+	}
+}
+
+// backtrace describes the frames on the call stack, innermost first
+func (vm *vm) backtrace() []TraceFrame {
+	names := vm.inst.module.FuncNames()
+	trace := make([]TraceFrame, 0, len(vm.frames))
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		fr := vm.frames[i]
+		tf := TraceFrame{
+			Func:   fr.fn.idx,
+			Name:   names[fr.fn.idx],
+			Instr:  fr.pc - 1, // pc 已经指向下一条指令
+			Offset: -1,
+		}
+		if offsets := fr.fn.code.InstrOffsets; tf.Instr >= 0 && tf.Instr < len(offsets) {
+			tf.Offset = offsets[tf.Instr]
+		}
+		trace = append(trace, tf)
+	}
+	return trace
+}
+
+// ret pops fr, which is the top frame, leaving only the function's
+// results above the stack height it was called with
+func (vm *vm) ret(fr *frame) {
+	arity := len(fr.fn.typ.ResultTypes)
+	if len(vm.stack)-fr.height < arity {
+		panic(fmt.Errorf("function returned %d values, expected %d",
+			len(vm.stack)-fr.height, arity))
+	}
+	copy(vm.stack[fr.height:], vm.stack[len(vm.stack)-arity:])
+	vm.stack = vm.stack[:fr.height+arity]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+}
+
+func (vm *vm) execInstr(fr *frame, instr binary.Instruction) {
+	switch instr.Opcode {
+	case binary.Unreachable:
+		panic(newTrap(trapUnreachable))
+	case binary.Nop:
+	case binary.Block, binary.Loop:
+		vm.enterBlock(fr, instr)
+	case binary.If:
+		cond := vm.popBool()
+		vm.enterBlock(fr, instr)
+		if !cond {
+			// 没有 else 分支时直接跳到 End, 由 End 弹出标签
+			if elsePc := fr.fn.elses[fr.pc-1]; elsePc > 0 {
+				fr.pc = elsePc + 1
+			} else {
+				fr.pc = fr.labels[len(fr.labels)-1].end
+			}
+		}
+	case binary.Else:
+		// the then arm is done, skip the else arm
+		fr.pc = fr.labels[len(fr.labels)-1].end
+	case binary.End:
+		fr.labels = fr.labels[:len(fr.labels)-1]
+	case binary.Br:
+		vm.br(fr, instr.Args.(uint32))
+	case binary.BrIf:
+		if vm.popBool() {
+			vm.br(fr, instr.Args.(uint32))
+		}
+	case binary.BrTable:
+		args := instr.Args.(binary.BrTableArgs)
+		n := vm.popU32()
+		if n < uint32(len(args.Labels)) {
+			vm.br(fr, args.Labels[n])
+		} else {
+			vm.br(fr, args.Default)
+		}
+	case binary.Return:
+		// run 在 pc 越过函数末尾时完成返回
+		fr.labels = fr.labels[:0]
+		fr.pc = len(fr.fn.code.Expr)
+	case binary.Call:
+		vm.callFunc(vm.inst.funcs[instr.Args.(uint32)])
+	case binary.CallIndirect:
+		vm.callIndirect(instr.Args.(binary.CallIndirectArgs))
+	case binary.Drop:
+		vm.popU64()
+	case binary.Select, binary.SelectT:
+		c := vm.popBool()
+		v2 := vm.popU64()
+		v1 := vm.popU64()
+		if c {
+			vm.pushU64(v1)
+		} else {
+			vm.pushU64(v2)
+		}
+	case binary.LocalGet:
+		vm.pushU64(fr.locals[instr.Args.(uint32)])
+	case binary.LocalSet:
+		fr.locals[instr.Args.(uint32)] = vm.popU64()
+	case binary.LocalTee:
+		fr.locals[instr.Args.(uint32)] = vm.stack[len(vm.stack)-1]
+	case binary.GlobalGet:
+		vm.pushGlobal(vm.inst.globals[instr.Args.(uint32)])
+	case binary.GlobalSet:
+		vm.popGlobal(vm.inst.globals[instr.Args.(uint32)])
+	case binary.I32Const, binary.I64Const, binary.F32Const, binary.F64Const:
+		vm.execConst(instr)
+	default:
+		switch {
+		case instr.Opcode >= binary.I32Load && instr.Opcode <= binary.MemoryGrow:
+			vm.execMemory(instr)
+		case instr.Opcode >= binary.I32Eqz && instr.Opcode <= binary.I64Extend32S:
+			vm.execNumeric(instr.Opcode)
+		case instr.Opcode == binary.PrefixMisc && instr.SubOpcode <= binary.I64TruncSatF64U:
+			vm.execTruncSat(instr.SubOpcode)
+		case instr.Opcode == binary.PrefixMisc && instr.SubOpcode >= binary.MemoryInit &&
+			instr.SubOpcode <= binary.MemoryFill:
+			vm.execBulkMemory(instr)
+		case instr.Opcode == binary.TableGet || instr.Opcode == binary.TableSet ||
+			instr.Opcode >= binary.RefNull && instr.Opcode <= binary.RefFunc,
+			instr.Opcode == binary.PrefixMisc && instr.SubOpcode >= binary.TableInit &&
+				instr.SubOpcode <= binary.TableFill:
+			vm.execTable(instr)
+		default:
+			panic(fmt.Errorf("unsupported instruction: 0x%02x", instr.Opcode))
+		}
+	}
+}
+
+func (vm *vm) enterBlock(fr *frame, instr binary.Instruction) {
+	paramCount, resultCount := vm.blockArity(instr.Args.(binary.BlockType))
+	l := label{
+		opcode: instr.Opcode,
+		arity:  resultCount,
+		height: len(vm.stack) - paramCount,
+		start:  fr.pc,
+		end:    fr.fn.ends[fr.pc-1],
+	}
+	if instr.Opcode == binary.Loop {
+		l.arity = paramCount
+	}
+	fr.labels = append(fr.labels, l)
+}
+
+func (vm *vm) blockArity(bt binary.BlockType) (paramCount, resultCount int) {
+	if bt == binary.BlockTypeEmpty {
+		return 0, 0
+	}
+	if _, ok := bt.ValType(); ok {
+		return 0, 1
+	}
+	ft := vm.inst.module.TypeSec[bt]
+	return len(ft.ParamTypes), len(ft.ResultTypes)
+}
+
+// br branches to the n-th enclosing label: the label's values are kept,
+// everything pushed since the label was entered is discarded. Branching
+// to the outermost label returns from the function.
+func (vm *vm) br(fr *frame, n uint32) {
+	idx := len(fr.labels) - 1 - int(n)
+	l := fr.labels[idx]
+
+	copy(vm.stack[l.height:], vm.stack[len(vm.stack)-l.arity:])
+	vm.stack = vm.stack[:l.height+l.arity]
+
+	if l.opcode == binary.Loop {
+		fr.labels = fr.labels[:idx+1]
+		fr.pc = l.start
+	} else {
+		fr.labels = fr.labels[:idx]
+		fr.pc = l.end + 1
+	}
+}
@@ -0,0 +1,567 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+var (
+	i32 = binary.ValTypeI32
+	i64 = binary.ValTypeI64
+	end = binary.Instruction{Opcode: binary.End}
+)
+
+func instr(opcode byte, args interface{}) binary.Instruction {
+	return binary.Instruction{Opcode: opcode, Args: args}
+}
+
+func op(opcode byte) binary.Instruction {
+	return binary.Instruction{Opcode: opcode}
+}
+
+func funcType(params, results []binary.ValType) binary.FuncType {
+	return binary.FuncType{Tag: binary.FtTag, ParamTypes: params, ResultTypes: results}
+}
+
+// funcModule returns a module of one function of type ft exported as "f",
+// the final end is added to body
+func funcModule(ft binary.FuncType, body ...binary.Instruction) binary.Module {
+	return binary.Module{
+		TypeSec:   []binary.FuncType{ft},
+		FuncSec:   []binary.TypeIdx{0},
+		ExportSec: []binary.Export{{Name: "f", Desc: binary.ExportDesc{Tag: binary.ExportTagFunc}}},
+		CodeSec:   []binary.Code{{Expr: append(body, end)}},
+	}
+}
+
+func mustInstantiate(t *testing.T, m binary.Module) *Instance {
+	t.Helper()
+	if err := m.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	inst, err := Instantiate(m, nil)
+	if err != nil {
+		t.Fatalf("Instantiate: %v", err)
+	}
+	return inst
+}
+
+// wantTrap checks that err is a trap with message msg
+func wantTrap(t *testing.T, err error, msg string) *Trap {
+	t.Helper()
+	var trap *Trap
+	if !errors.As(err, &trap) {
+		t.Fatalf("got error %v, want trap %q", err, msg)
+	}
+	if trap.Msg != msg {
+		t.Fatalf("got trap %q, want %q", trap.Msg, msg)
+	}
+	return trap
+}
+
+// factorial computes n! recursively
+func factorial() binary.Module {
+	return funcModule(funcType([]binary.ValType{i64}, []binary.ValType{i64}),
+		instr(binary.LocalGet, uint32(0)),
+		op(binary.I64Eqz),
+		instr(binary.If, binary.BlockTypeI64),
+		instr(binary.I64Const, int64(1)),
+		op(binary.Else),
+		instr(binary.LocalGet, uint32(0)),
+		instr(binary.LocalGet, uint32(0)),
+		instr(binary.I64Const, int64(1)),
+		op(binary.I64Sub),
+		instr(binary.Call, uint32(0)),
+		op(binary.I64Mul),
+		end,
+	)
+}
+
+func TestCallRecursive(t *testing.T) {
+	inst := mustInstantiate(t, factorial())
+	want := int64(1)
+	for n := int64(0); n <= 20; n++ {
+		if n > 0 {
+			want *= n
+		}
+		results, err := inst.Invoke("f", n)
+		if err != nil {
+			t.Fatalf("f(%d): %v", n, err)
+		}
+		if len(results) != 1 || results[0] != want {
+			t.Fatalf("f(%d): got %v, want [%d]", n, results, want)
+		}
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	inst := mustInstantiate(t, factorial())
+	inst.MaxCallDepth = 100
+	if _, err := inst.Invoke("f", int64(50)); err != nil {
+		t.Fatalf("f(50) with 100 frames: %v", err)
+	}
+	_, err := inst.Invoke("f", int64(200))
+	wantTrap(t, err, "call stack exhausted")
+}
+
+func TestIfElse(t *testing.T) {
+	// f(x) = x == 5 ? x + 1 : x ? 10 : 20, the first through an if
+	// without else
+	m := funcModule(funcType([]binary.ValType{i32}, []binary.ValType{i32}),
+		instr(binary.LocalGet, uint32(0)),
+		instr(binary.I32Const, int32(5)),
+		op(binary.I32Eq),
+		instr(binary.If, binary.BlockTypeEmpty),
+		instr(binary.LocalGet, uint32(0)),
+		instr(binary.I32Const, int32(1)),
+		op(binary.I32Add),
+		op(binary.Return),
+		end,
+		instr(binary.LocalGet, uint32(0)),
+		instr(binary.If, binary.BlockTypeI32),
+		instr(binary.I32Const, int32(10)),
+		op(binary.Else),
+		instr(binary.I32Const, int32(20)),
+		end,
+	)
+	inst := mustInstantiate(t, m)
+	for _, tt := range []struct{ x, want int32 }{{1, 10}, {0, 20}, {5, 6}, {-1, 10}} {
+		results, err := inst.Invoke("f", tt.x)
+		if err != nil {
+			t.Fatalf("f(%d): %v", tt.x, err)
+		}
+		if results[0] != tt.want {
+			t.Errorf("f(%d): got %v, want %d", tt.x, results[0], tt.want)
+		}
+	}
+}
+
+func TestGlobalInitFromImport(t *testing.T) {
+	gt := binary.GlobalType{ValType: i32, Mut: binary.MutConst}
+	imported, err := NewGlobal(gt, int32(41))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// global 1 is global 0 + 1
+	m := binary.Module{
+		ImportSec: []binary.Import{{Module: "env", Name: "g",
+			Desc: binary.ImportDesc{Tag: binary.ImportTagGlobal, Global: gt}}},
+		GlobalSec: []binary.Global{{Type: gt, Init: binary.Expr{
+			instr(binary.GlobalGet, uint32(0)),
+			instr(binary.I32Const, int32(1)),
+			op(binary.I32Add),
+			end,
+		}}},
+	}
+	// the addition needs extended-const
+	if err := m.ValidateWithFeatures(binary.AllFeatures()); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	inst, err := Instantiate(m, Imports{"env": {"g": imported}})
+	if err != nil {
+		t.Fatalf("Instantiate: %v", err)
+	}
+	if v, err := inst.Global(1); err != nil || v != int32(42) {
+		t.Fatalf("got global 1 = %v (error %v), want 42", v, err)
+	}
+}
+
+func TestReturnFromNestedBlock(t *testing.T) {
+	// f(x) returns x * 2 from two blocks and a loop deep when x > 10, the
+	// values left below the result are dropped by the return
+	m := funcModule(funcType([]binary.ValType{i32}, []binary.ValType{i32}),
+		instr(binary.I32Const, int32(-1)),
+		instr(binary.Block, binary.BlockTypeEmpty),
+		instr(binary.Loop, binary.BlockTypeEmpty),
+		instr(binary.Block, binary.BlockTypeI32),
+		instr(binary.I32Const, int32(-2)),
+		instr(binary.LocalGet, uint32(0)),
+		instr(binary.I32Const, int32(10)),
+		op(binary.I32GtS),
+		instr(binary.If, binary.BlockTypeEmpty),
+		instr(binary.LocalGet, uint32(0)),
+		instr(binary.I32Const, int32(2)),
+		op(binary.I32Mul),
+		op(binary.Return),
+		end,
+		end,
+		op(binary.Drop),
+		end,
+		end,
+		op(binary.Drop),
+		instr(binary.LocalGet, uint32(0)),
+	)
+	inst := mustInstantiate(t, m)
+	for _, tt := range []struct{ x, want int32 }{{11, 22}, {100, 200}, {10, 10}, {-5, -5}} {
+		results, err := inst.Invoke("f", tt.x)
+		if err != nil {
+			t.Fatalf("f(%d): %v", tt.x, err)
+		}
+		if len(results) != 1 || results[0] != tt.want {
+			t.Fatalf("f(%d): got %v, want [%d]", tt.x, results, tt.want)
+		}
+	}
+}
+
+func TestActiveElemOutOfBounds(t *testing.T) {
+	m := funcModule(funcType(nil, nil))
+	m.TableSec = []binary.TableType{{ElemType: binary.FuncRef, Limits: binary.Limits{Min: 2}}}
+	elem := func(offset int32, funcs ...binary.FuncIdx) binary.Elem {
+		return binary.Elem{
+			Mode:   binary.ElemModeActive,
+			Type:   binary.FuncRef,
+			Offset: binary.Expr{instr(binary.I32Const, offset), end},
+			Init:   funcs,
+		}
+	}
+
+	for _, tt := range []struct {
+		offset int32
+		funcs  []binary.FuncIdx
+		fits   bool
+	}{
+		{1, []binary.FuncIdx{0}, true},
+		{0, []binary.FuncIdx{0, 0}, true},
+		{2, nil, true}, // an empty segment may start at the end of the table
+		{1, []binary.FuncIdx{0, 0}, false},
+		{3, nil, false},
+		{-1, []binary.FuncIdx{0}, false},
+	} {
+		m.ElemSec = []binary.Elem{elem(tt.offset, tt.funcs...)}
+		if tt.fits {
+			mustInstantiate(t, m)
+			continue
+		}
+		_, err := Instantiate(m, nil)
+		wantTrap(t, err, trapOutOfBoundsTable)
+	}
+}
+
+func TestReferenceGlobals(t *testing.T) {
+	ext := binary.ValType(binary.ExternRef)
+	// f(x) stores x in global 1 and returns it
+	m := funcModule(funcType([]binary.ValType{ext}, []binary.ValType{ext}),
+		instr(binary.LocalGet, uint32(0)),
+		instr(binary.GlobalSet, uint32(1)),
+		instr(binary.GlobalGet, uint32(1)),
+	)
+	m.GlobalSec = []binary.Global{
+		{Type: binary.GlobalType{ValType: binary.FuncRef}, Init: binary.Expr{instr(binary.RefFunc, uint32(0)), end}},
+		{Type: binary.GlobalType{ValType: ext, Mut: binary.MutVar}, Init: binary.Expr{instr(binary.RefNull, ext), end}},
+	}
+	inst := mustInstantiate(t, m)
+
+	v, err := inst.Global(0)
+	if r, ok := v.(Funcref); err != nil || !ok || r.IsNull() {
+		t.Fatalf("got global 0 = %v (error %v), want a function", v, err)
+	}
+	if v, err := inst.Global(1); err != nil || v != (Externref{}) {
+		t.Fatalf("got global 1 = %v (error %v), want null", v, err)
+	}
+
+	host := NewExternref("host value")
+	results, err := inst.Invoke("f", host)
+	if err != nil {
+		t.Fatalf("f: %v", err)
+	}
+	if results[0] != host || results[0].(Externref).Host() != "host value" {
+		t.Fatalf("got %v, want %v", results[0], host)
+	}
+	if v, _ := inst.Global(1); v != host {
+		t.Fatalf("got global 1 = %v, want %v", v, host)
+	}
+
+	if err := inst.SetGlobal(1, int32(1)); err == nil {
+		t.Fatalf("got no error setting an externref global to an i32")
+	}
+	if err := inst.SetGlobal(1, NewExternref(2)); err != nil {
+		t.Fatalf("SetGlobal: %v", err)
+	}
+	if err := inst.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if v, _ := inst.Global(1); v != (Externref{}) {
+		t.Fatalf("got global 1 = %v after Reset, want null", v)
+	}
+}
+
+func TestNewMemoryBoundary(t *testing.T) {
+	if _, err := NewMemory(binary.MemType{Min: MaxPages + 1}); err == nil {
+		t.Fatalf("got no error for %d pages, want one", MaxPages+1)
+	}
+	// 4GiB may not be available, but must not crash
+	mem, err := NewMemory(binary.MemType{Min: MaxPages})
+	if err != nil {
+		if !strings.Contains(err.Error(), "out of memory") {
+			t.Fatalf("got error %v, want an out of memory error", err)
+		}
+		return
+	}
+	if size := mem.Size(); size != MaxPages {
+		t.Fatalf("got %d pages, want %d", size, MaxPages)
+	}
+	if old := mem.Grow(1); old != -1 {
+		t.Fatalf("got %d growing a 4GiB memory, want -1", old)
+	}
+}
+
+// TestInstantiateMaxLocals checks that a module that was not decoded, and
+// so not checked against binary.MaxLocals, fails to instantiate rather
+// than allocating a frame for each of its locals
+func TestInstantiateMaxLocals(t *testing.T) {
+	m := funcModule(funcType(nil, nil))
+	m.CodeSec[0].Locals = []binary.Locals{{N: 500000000, Type: binary.ValTypeI32}}
+	if _, err := Instantiate(m, nil); err == nil || !strings.Contains(err.Error(), "too many locals: 500000000") {
+		t.Fatalf("got error %v, want too many locals", err)
+	}
+}
+
+func TestTrapBacktraceOffsets(t *testing.T) {
+	// f calls function 1, which traps
+	m := funcModule(funcType(nil, nil), instr(binary.Call, uint32(1)))
+	m.FuncSec = append(m.FuncSec, 0)
+	m.CodeSec = append(m.CodeSec, binary.Code{Expr: binary.Expr{op(binary.Nop), op(binary.Unreachable), end}})
+	data, err := binary.Encode(m)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	opts := binary.DefaultDecodeOptions()
+	opts.RecordCodeOffsets = true
+	m, err = binary.DecodeWithOptions(data, opts)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	_, err = mustInstantiate(t, m).Invoke("f")
+	trap := wantTrap(t, err, "unreachable")
+	want := []TraceFrame{
+		{Func: 1, Instr: 1, Offset: m.CodeSec[1].InstrOffsets[1]},
+		{Func: 0, Instr: 0, Offset: m.CodeSec[0].InstrOffsets[0]},
+	}
+	if !reflect.DeepEqual(trap.Backtrace, want) {
+		t.Fatalf("got backtrace %v, want %v", trap.Backtrace, want)
+	}
+	if data[want[0].Offset] != binary.Unreachable {
+		t.Fatalf("got byte 0x%02x at offset 0x%x, want unreachable", data[want[0].Offset], want[0].Offset)
+	}
+	if msg := fmt.Sprintf("unreachable in func 1 (offset 0x%x)", want[0].Offset); !strings.HasPrefix(err.Error(), msg) {
+		t.Fatalf("got error %q, want it to start with %q", err, msg)
+	}
+
+	// without offsets the instruction index is reported
+	m.CodeSec[0].InstrOffsets, m.CodeSec[1].InstrOffsets = nil, nil
+	_, err = mustInstantiate(t, m).Invoke("f")
+	if msg := "unreachable in func 1 (instr 1), called from func 0 (instr 0)"; err == nil || err.Error() != msg {
+		t.Fatalf("got error %v, want %q", err, msg)
+	}
+}
+
+func misc(sub uint32, args interface{}) binary.Instruction {
+	return binary.Instruction{Opcode: binary.PrefixMisc, SubOpcode: sub, Args: args}
+}
+
+// tableBulkModule has a table of 4 functions, initially null, and a
+// passive segment of functions 0 and 1, which return 10 and 20. The
+// exports are call(i), init(d, s, n), copy(d, s, n) and drop().
+func tableBulkModule() binary.Module {
+	get := func(i uint32) binary.Instruction { return instr(binary.LocalGet, i) }
+	export := func(name string, idx uint32) binary.Export {
+		return binary.Export{Name: name, Desc: binary.ExportDesc{Tag: binary.ExportTagFunc, Idx: idx}}
+	}
+	return binary.Module{
+		TypeSec: []binary.FuncType{
+			funcType(nil, []binary.ValType{i32}),
+			funcType([]binary.ValType{i32}, []binary.ValType{i32}),
+			funcType([]binary.ValType{i32, i32, i32}, nil),
+			funcType(nil, nil),
+		},
+		FuncSec:  []binary.TypeIdx{0, 0, 1, 2, 2, 3},
+		TableSec: []binary.TableType{{ElemType: binary.FuncRef, Limits: binary.Limits{Min: 4}}},
+		ExportSec: []binary.Export{
+			export("call", 2), export("init", 3), export("copy", 4), export("drop", 5),
+		},
+		ElemSec: []binary.Elem{{Mode: binary.ElemModePassive, Type: binary.FuncRef, Init: []binary.FuncIdx{0, 1}}},
+		CodeSec: []binary.Code{
+			{Expr: binary.Expr{instr(binary.I32Const, int32(10)), end}},
+			{Expr: binary.Expr{instr(binary.I32Const, int32(20)), end}},
+			{Expr: binary.Expr{get(0), instr(binary.CallIndirect, binary.CallIndirectArgs{}), end}},
+			{Expr: binary.Expr{get(0), get(1), get(2), misc(binary.TableInit, binary.TableInitArgs{}), end}},
+			{Expr: binary.Expr{get(0), get(1), get(2), misc(binary.TableCopy, binary.TableCopyArgs{}), end}},
+			{Expr: binary.Expr{misc(binary.ElemDrop, uint32(0)), end}},
+		},
+	}
+}
+
+func TestTableBulk(t *testing.T) {
+	inst := mustInstantiate(t, tableBulkModule())
+	// wantTable checks what call returns for each table element, 0 for
+	// a null one
+	wantTable := func(want ...int32) {
+		t.Helper()
+		for i, w := range want {
+			results, err := inst.Invoke("call", int32(i))
+			if w == 0 {
+				wantTrap(t, err, trapUninitialized)
+			} else if err != nil || results[0] != w {
+				t.Fatalf("call(%d): got %v (error %v), want %d", i, results, err, w)
+			}
+		}
+	}
+	invoke := func(name string, args ...Value) error {
+		_, err := inst.Invoke(name, args...)
+		return err
+	}
+
+	if err := invoke("init", int32(1), int32(0), int32(2)); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	wantTable(0, 10, 20, 0)
+	// the ranges overlap
+	if err := invoke("copy", int32(2), int32(1), int32(2)); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	wantTable(0, 10, 10, 20)
+
+	// out of bounds accesses trap without writing anything
+	wantTrap(t, invoke("init", int32(3), int32(0), int32(2)), trapOutOfBoundsTable)
+	wantTrap(t, invoke("init", int32(0), int32(1), int32(2)), trapOutOfBoundsTable)
+	wantTrap(t, invoke("copy", int32(0), int32(3), int32(2)), trapOutOfBoundsTable)
+	wantTrap(t, invoke("copy", int32(3), int32(0), int32(2)), trapOutOfBoundsTable)
+	wantTable(0, 10, 10, 20)
+
+	// a dropped segment is empty
+	if err := invoke("drop"); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	wantTrap(t, invoke("init", int32(0), int32(0), int32(1)), trapOutOfBoundsTable)
+	if err := invoke("init", int32(0), int32(0), int32(0)); err != nil {
+		t.Fatalf("init of nothing from a dropped segment: %v", err)
+	}
+
+	if err := inst.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	wantTable(0, 0, 0, 0)
+	if err := invoke("init", int32(0), int32(0), int32(2)); err != nil {
+		t.Fatalf("init after Reset: %v", err)
+	}
+	wantTable(10, 20, 0, 0)
+}
+
+func TestExternrefTable(t *testing.T) {
+	ext := binary.ValType(binary.ExternRef)
+	tab, err := NewTable(binary.TableType{ElemType: ext, Limits: binary.Limits{Tag: 1, Min: 1, Max: 3}})
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	// grow(x, n) grows the imported table by n elements set to x, get(i)
+	// returns element i
+	m := binary.Module{
+		TypeSec: []binary.FuncType{
+			funcType([]binary.ValType{ext, i32}, []binary.ValType{i32}),
+			funcType([]binary.ValType{i32}, []binary.ValType{ext}),
+		},
+		ImportSec: []binary.Import{{Module: "m", Name: "t", Desc: binary.ImportDesc{Tag: binary.ImportTagTable, Table: tab.Type}}},
+		FuncSec:   []binary.TypeIdx{0, 1},
+		ExportSec: []binary.Export{
+			{Name: "grow", Desc: binary.ExportDesc{Tag: binary.ExportTagFunc, Idx: 0}},
+			{Name: "get", Desc: binary.ExportDesc{Tag: binary.ExportTagFunc, Idx: 1}},
+		},
+		CodeSec: []binary.Code{
+			{Expr: binary.Expr{instr(binary.LocalGet, uint32(0)), instr(binary.LocalGet, uint32(1)), misc(binary.TableGrow, uint32(0)), end}},
+			{Expr: binary.Expr{instr(binary.LocalGet, uint32(0)), instr(binary.TableGet, uint32(0)), end}},
+		},
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	inst, err := Instantiate(m, Imports{"m": {"t": tab}})
+	if err != nil {
+		t.Fatalf("Instantiate: %v", err)
+	}
+
+	a, b := NewExternref("a"), NewExternref("b")
+	if results, err := inst.Invoke("grow", a, int32(1)); err != nil || results[0] != int32(1) {
+		t.Fatalf("grow: got %v (error %v), want [1]", results, err)
+	}
+	if old, err := tab.Grow(1, b); err != nil || old != 2 {
+		t.Fatalf("Grow: got %d (error %v), want 2", old, err)
+	}
+	for i, want := range []Externref{{}, a, b} {
+		if results, err := inst.Invoke("get", int32(i)); err != nil || results[0] != want {
+			t.Fatalf("get(%d): got %v (error %v), want %v", i, results, err, want)
+		}
+	}
+
+	// growing past the maximum fails, and leaves the table as it is
+	if results, err := inst.Invoke("grow", a, int32(1)); err != nil || results[0] != int32(-1) {
+		t.Fatalf("grow past the maximum: got %v (error %v), want [-1]", results, err)
+	}
+	if old, err := tab.Grow(1, b); err != nil || old != -1 {
+		t.Fatalf("Grow past the maximum: got %d (error %v), want -1", old, err)
+	}
+	if old, err := tab.Grow(0, b); err != nil || old != 3 {
+		t.Fatalf("Grow by 0 at the maximum: got %d (error %v), want 3", old, err)
+	}
+	if _, err := tab.Grow(0, Funcref{}); err == nil {
+		t.Fatalf("got no error growing an externref table with a funcref")
+	}
+}
+
+// TestElemExprs checks an active element segment of expressions: entry 0
+// is function 0, which returns 10, and entry 1 is null
+func TestElemExprs(t *testing.T) {
+	m := funcModule(funcType([]binary.ValType{i32}, []binary.ValType{i32}),
+		instr(binary.LocalGet, uint32(0)),
+		instr(binary.CallIndirect, binary.CallIndirectArgs{Type: 1}),
+	)
+	m.TypeSec = append(m.TypeSec, funcType(nil, []binary.ValType{i32}))
+	m.FuncSec = append(m.FuncSec, 1)
+	m.CodeSec = append(m.CodeSec, binary.Code{Expr: binary.Expr{instr(binary.I32Const, int32(10)), end}})
+	m.ExportSec[0].Desc.Idx = 0
+	m.TableSec = []binary.TableType{{ElemType: binary.FuncRef, Limits: binary.Limits{Min: 2}}}
+	m.ElemSec = []binary.Elem{{
+		Type:   binary.FuncRef,
+		Offset: binary.Expr{instr(binary.I32Const, int32(0)), end},
+		Exprs: []binary.Expr{
+			{instr(binary.RefFunc, uint32(1)), end},
+			{instr(binary.RefNull, binary.ValType(binary.FuncRef)), end},
+		},
+	}}
+	inst := mustInstantiate(t, m)
+
+	if results, err := inst.Invoke("f", int32(0)); err != nil || results[0] != int32(10) {
+		t.Fatalf("f(0): got %v (error %v), want [10]", results, err)
+	}
+	_, err := inst.Invoke("f", int32(1))
+	wantTrap(t, err, trapUninitialized)
+}
+
+// TestMemoryInit copies bytes 1 to 3 of a passive data segment to address
+// 16 and loads them back
+func TestMemoryInit(t *testing.T) {
+	n := uint32(2)
+	m := funcModule(funcType(nil, []binary.ValType{i32}),
+		instr(binary.I32Const, int32(16)),
+		instr(binary.I32Const, int32(1)),
+		instr(binary.I32Const, int32(3)),
+		misc(binary.MemoryInit, uint32(1)),
+		instr(binary.I32Const, int32(16)),
+		instr(binary.I32Load, binary.MemArg{Align: 2}),
+	)
+	m.MemSec = []binary.MemType{{Min: 1}}
+	m.DataCountSec = &n
+	m.DataSec = []binary.Data{
+		{Offset: binary.Expr{instr(binary.I32Const, int32(0)), end}, Init: []byte{1}},
+		{Mode: binary.DataModePassive, Init: []byte{0, 0x2A, 0, 0}},
+	}
+	results, err := mustInstantiate(t, m).Invoke("f")
+	if err != nil || results[0] != int32(42) {
+		t.Fatalf("got %v (error %v), want [42]", results, err)
+	}
+}
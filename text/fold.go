@@ -0,0 +1,222 @@
+package text
+
+import "github.com/aiialzy/wasmer/binary"
+
+// node is an instruction in folded form. children are the folded
+// operands, body/elseBody the instructions of a block, loop or if.
+type node struct {
+	instr    binary.Instruction
+	children []*node
+	body     []*node
+	elseBody []*node
+	hasElse  bool
+	complete bool // all operands are folded children
+	results  int
+}
+
+// folder reconstructs the operand nesting from the flat instruction
+// stream. An instruction folds the values produced by the nodes right
+// before it when each of them is complete and yields a single value,
+// otherwise it is left unfolded so the instruction order never changes.
+type folder struct {
+	module binary.Module
+	labels []int // branch arity of each enclosing label, innermost last
+}
+
+// fold folds expr starting at pc up to the next Else or End of the
+// same depth, returning the nodes and the index of that terminator
+func (f *folder) fold(expr binary.Expr, pc int) ([]*node, int) {
+	var seq []*node
+	foldable := 0 // trailing nodes in seq that may be folded
+	for ; pc < len(expr); pc++ {
+		instr := expr[pc]
+		if instr.Opcode == binary.End || instr.Opcode == binary.Else {
+			return seq, pc
+		}
+
+		pops, pushes := f.stackEffect(instr)
+		n := &node{instr: instr, results: pushes}
+
+		switch instr.Opcode {
+		case binary.Block, binary.Loop, binary.If:
+			arity := pushes
+			if instr.Opcode == binary.Loop {
+				arity, _ = f.blockArity(instr.Args.(binary.BlockType))
+			}
+			f.labels = append(f.labels, arity)
+			n.body, pc = f.fold(expr, pc+1)
+			if pc < len(expr) && expr[pc].Opcode == binary.Else {
+				n.hasElse = true
+				n.elseBody, pc = f.fold(expr, pc+1)
+			}
+			f.labels = f.labels[:len(f.labels)-1]
+		}
+
+		if pops >= 0 && pops <= foldable {
+			n.children = append(n.children, seq[len(seq)-pops:]...)
+			seq = seq[:len(seq)-pops]
+			foldable -= pops
+			n.complete = true
+		} else {
+			foldable = 0
+		}
+
+		seq = append(seq, n)
+		if n.complete && n.results == 1 {
+			foldable++
+		} else {
+			foldable = 0
+		}
+	}
+
+	return seq, pc
+}
+
+func (f *folder) blockArity(bt binary.BlockType) (params, results int) {
+	if bt == binary.BlockTypeEmpty {
+		return 0, 0
+	}
+	if _, ok := bt.ValType(); ok {
+		return 0, 1
+	}
+	if int(bt) < len(f.module.TypeSec) {
+		ft := f.module.TypeSec[bt]
+		return len(ft.ParamTypes), len(ft.ResultTypes)
+	}
+	return -1, 0
+}
+
+func (f *folder) labelArity(l binary.LabelIdx) int {
+	if int(l) < len(f.labels) {
+		return f.labels[len(f.labels)-1-int(l)]
+	}
+	return -1
+}
+
+func (f *folder) funcType(idx binary.FuncIdx) (binary.FuncType, bool) {
+	for _, imp := range f.module.ImportSec {
+		if imp.Desc.Tag == binary.ImportTagFunc {
+			if idx == 0 {
+				return f.typeAt(imp.Desc.FuncType)
+			}
+			idx--
+		}
+	}
+	if int(idx) < len(f.module.FuncSec) {
+		return f.typeAt(f.module.FuncSec[idx])
+	}
+	return binary.FuncType{}, false
+}
+
+func (f *folder) typeAt(idx binary.TypeIdx) (binary.FuncType, bool) {
+	if int(idx) < len(f.module.TypeSec) {
+		return f.module.TypeSec[idx], true
+	}
+	return binary.FuncType{}, false
+}
+
+// stackEffect returns how many operands instr pops and how many values
+// it pushes. pops is -1 when it is unknown, which prevents folding.
+func (f *folder) stackEffect(instr binary.Instruction) (pops, pushes int) {
+	op := instr.Opcode
+	switch op {
+	case binary.Unreachable, binary.Nop:
+		return 0, 0
+	case binary.Block, binary.Loop, binary.If:
+		// only the condition of an if is folded, block parameters are
+		// left on the stack so the folded text keeps its meaning
+		params, results := f.blockArity(instr.Args.(binary.BlockType))
+		if params != 0 {
+			return -1, results
+		}
+		if op == binary.If {
+			return 1, results
+		}
+		return 0, results
+	case binary.Br:
+		return f.labelArity(instr.Args.(uint32)), 0
+	case binary.BrIf:
+		arity := f.labelArity(instr.Args.(uint32))
+		if arity < 0 {
+			return -1, 0
+		}
+		return arity + 1, arity
+	case binary.BrTable:
+		arity := f.labelArity(instr.Args.(binary.BrTableArgs).Default)
+		if arity < 0 {
+			return -1, 0
+		}
+		return arity + 1, 0
+	case binary.Return:
+		return f.labels[0], 0
+	case binary.Call:
+		ft, ok := f.funcType(instr.Args.(uint32))
+		if !ok {
+			return -1, 0
+		}
+		return len(ft.ParamTypes), len(ft.ResultTypes)
+	case binary.CallIndirect:
+		ft, ok := f.typeAt(instr.Args.(binary.CallIndirectArgs).Type)
+		if !ok {
+			return -1, 0
+		}
+		return len(ft.ParamTypes) + 1, len(ft.ResultTypes)
+	case binary.Drop:
+		return 1, 0
+	case binary.Select, binary.SelectT:
+		return 3, 1
+	case binary.LocalGet, binary.GlobalGet:
+		return 0, 1
+	case binary.LocalSet, binary.GlobalSet:
+		return 1, 0
+	case binary.LocalTee, binary.TableGet:
+		return 1, 1
+	case binary.TableSet:
+		return 2, 0
+	case binary.MemorySize:
+		return 0, 1
+	case binary.MemoryGrow:
+		return 1, 1
+	case binary.I32Const, binary.I64Const, binary.F32Const, binary.F64Const:
+		return 0, 1
+	case binary.RefNull, binary.RefFunc:
+		return 0, 1
+	case binary.RefIsNull:
+		return 1, 1
+	case binary.I32Eqz, binary.I64Eqz:
+		return 1, 1
+	case binary.PrefixMisc:
+		switch instr.SubOpcode {
+		case binary.MemoryInit, binary.MemoryCopy, binary.MemoryFill,
+			binary.TableInit, binary.TableCopy, binary.TableFill:
+			return 3, 0
+		case binary.DataDrop, binary.ElemDrop:
+			return 0, 0
+		case binary.TableGrow:
+			return 2, 1
+		case binary.TableSize:
+			return 0, 1
+		default:
+			return 1, 1 // trunc_sat
+		}
+	}
+
+	switch {
+	case op >= binary.I32Load && op <= binary.I64Load32U:
+		return 1, 1
+	case op >= binary.I32Store && op <= binary.I64Store32:
+		return 2, 0
+	case op >= binary.I32Eq && op <= binary.F64Ge:
+		return 2, 1
+	case op >= binary.I32Clz && op <= binary.I32PopCnt,
+		op >= binary.I64Clz && op <= binary.I64PopCnt,
+		op >= binary.F32Abs && op <= binary.F32Sqrt,
+		op >= binary.F64Abs && op <= binary.F64Sqrt,
+		op >= binary.I32WrapI64 && op <= binary.I64Extend32S:
+		return 1, 1
+	case op >= binary.I32Add && op <= binary.F64CopySign:
+		return 2, 1
+	}
+
+	return -1, 0
+}
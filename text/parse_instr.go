@@ -0,0 +1,398 @@
+package text
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+// instrsByName maps instruction names to the opcodes they stand for
+var instrsByName = func() map[string]binary.Instruction {
+	m := make(map[string]binary.Instruction)
+	for op := 0; op < 256; op++ {
+		switch op {
+		case binary.SelectT, binary.PrefixMisc, binary.PrefixSIMD, binary.PrefixAtomic:
+			continue
+		}
+		instr := binary.Instruction{Opcode: byte(op)}
+		if name := instr.GetOpname(); name != "" {
+			m[name] = instr
+		}
+	}
+	for _, prefix := range []byte{binary.PrefixMisc, binary.PrefixSIMD, binary.PrefixAtomic} {
+		for sub := uint32(0); sub < 256; sub++ {
+			instr := binary.Instruction{Opcode: prefix, SubOpcode: sub}
+			if name := instr.GetOpname(); name != "" {
+				m[name] = instr
+			}
+		}
+	}
+	return m
+}()
+
+type instrParser struct {
+	*watParser
+	localIDs map[string]uint32
+	labels   []string // innermost last, "" if unnamed
+	expr     binary.Expr
+}
+
+func (ip *instrParser) parseInstrs(items []*sexpr) {
+	for len(items) > 0 {
+		if items[0].isList {
+			ip.parseFolded(items[0])
+			items = items[1:]
+			continue
+		}
+		var instr binary.Instruction
+		instr, items = ip.parseInstr(items)
+		ip.expr = append(ip.expr, instr)
+	}
+}
+
+// parseFolded emits the operands of a folded instruction before the
+// instruction itself
+func (ip *instrParser) parseFolded(s *sexpr) {
+	switch s.head() {
+	case "block", "loop", "if":
+		fail(s, "folded %s is not supported", s.head())
+	case "":
+		fail(s, "instruction expected, got %s", s)
+	}
+
+	instr, operands := ip.parseInstr(s.list)
+	for _, operand := range operands {
+		if !operand.isList {
+			fail(operand, "unexpected %s in folded instruction", operand)
+		}
+		ip.parseFolded(operand)
+	}
+	ip.expr = append(ip.expr, instr)
+}
+
+// parseInstr parses the instruction items starts with and its immediates,
+// and returns the items that follow them
+func (ip *instrParser) parseInstr(items []*sexpr) (binary.Instruction, []*sexpr) {
+	name := items[0]
+	instr, ok := instrsByName[name.atom]
+	if name.isList || name.quoted || !ok {
+		fail(name, "unknown instruction %s", name)
+	}
+	items = items[1:]
+
+	switch instr.Opcode {
+	case binary.Block, binary.Loop, binary.If:
+		label := ""
+		if len(items) > 0 && isID(items[0]) {
+			label = items[0].atom
+			items = items[1:]
+		}
+		instr.Args, items = ip.parseBlockType(items)
+		ip.labels = append(ip.labels, label)
+	case binary.Else, binary.End:
+		if len(ip.labels) <= 1 {
+			fail(name, "%s outside of a block", name.atom)
+		}
+		if len(items) > 0 && isID(items[0]) {
+			if items[0].atom != ip.labels[len(ip.labels)-1] {
+				fail(items[0], "mismatching label %s", items[0].atom)
+			}
+			items = items[1:]
+		}
+		if instr.Opcode == binary.End {
+			ip.labels = ip.labels[:len(ip.labels)-1]
+		}
+	case binary.Br, binary.BrIf:
+		instr.Args = ip.parseLabel(name, items)
+		items = items[1:]
+	case binary.BrTable:
+		var labels []binary.LabelIdx
+		for len(items) > 0 && isIndex(items[0]) {
+			labels = append(labels, ip.parseLabel(name, items))
+			items = items[1:]
+		}
+		if len(labels) == 0 {
+			fail(name, "br_table needs at least a default label")
+		}
+		instr.Args = binary.BrTableArgs{
+			Labels:  labels[:len(labels)-1],
+			Default: labels[len(labels)-1],
+		}
+	case binary.Call, binary.RefFunc:
+		instr.Args = ip.resolve(ip.operand(name, items), ip.funcIDs, "function")
+		items = items[1:]
+	case binary.CallIndirect:
+		args := binary.CallIndirectArgs{}
+		if len(items) > 0 && isIndex(items[0]) {
+			args.Table = ip.resolve(items[0], ip.tableIDs, "table")
+			items = items[1:]
+		}
+		args.Type, _, items = ip.parseTypeUse(items, nil)
+		instr.Args = args
+	case binary.LocalGet, binary.LocalSet, binary.LocalTee:
+		instr.Args = ip.resolve(ip.operand(name, items), ip.localIDs, "local")
+		items = items[1:]
+	case binary.GlobalGet, binary.GlobalSet:
+		instr.Args = ip.resolve(ip.operand(name, items), ip.globalIDs, "global")
+		items = items[1:]
+	case binary.TableGet, binary.TableSet:
+		instr.Args, items = ip.optionalTable(items)
+	case binary.MemorySize, binary.MemoryGrow:
+		instr.Args = byte(0)
+	case binary.I32Const:
+		instr.Args = parseI32(ip.operand(name, items))
+		items = items[1:]
+	case binary.I64Const:
+		instr.Args = parseI64(ip.operand(name, items))
+		items = items[1:]
+	case binary.F32Const:
+		instr.Args = float32(parseFloat(ip.operand(name, items), 32))
+		items = items[1:]
+	case binary.F64Const:
+		instr.Args = parseFloat(ip.operand(name, items), 64)
+		items = items[1:]
+	case binary.RefNull:
+		switch ip.operand(name, items).atom {
+		case "func":
+			instr.Args = binary.ValType(binary.FuncRef)
+		case "extern":
+			instr.Args = binary.ValType(binary.ExternRef)
+		default:
+			fail(items[0], "heap type expected, got %s", items[0])
+		}
+		items = items[1:]
+	case binary.Select:
+		if len(items) > 0 && items[0].head() == "result" {
+			instr.Opcode = binary.SelectT
+			var vts []binary.ValType
+			for len(items) > 0 && items[0].head() == "result" {
+				vts = ip.parseValTypeList(items[0], vts, nil)
+				items = items[1:]
+			}
+			instr.Args = vts
+		}
+	case binary.PrefixMisc:
+		instr.Args, items = ip.parseMiscArgs(name, instr.SubOpcode, items)
+	case binary.PrefixSIMD:
+		fail(name, "SIMD instructions are not supported")
+	case binary.PrefixAtomic:
+		if instr.SubOpcode == binary.AtomicFence {
+			instr.Args = byte(0)
+		} else {
+			instr.Args, items = ip.parseMemArg(instr, items)
+		}
+	default:
+		if instr.Opcode >= binary.I32Load && instr.Opcode <= binary.I64Store32 {
+			instr.Args, items = ip.parseMemArg(instr, items)
+		}
+	}
+
+	return instr, items
+}
+
+// operand returns the immediate after the instruction name
+func (ip *instrParser) operand(name *sexpr, items []*sexpr) *sexpr {
+	if len(items) == 0 || items[0].isList {
+		fail(name, "missing immediate of %s", name.atom)
+	}
+	return items[0]
+}
+
+func isIndex(s *sexpr) bool {
+	return !s.isList && !s.quoted && s.atom != "" &&
+		(s.atom[0] == '$' || s.atom[0] >= '0' && s.atom[0] <= '9')
+}
+
+// parseLabel returns the depth of the label items starts with
+func (ip *instrParser) parseLabel(name *sexpr, items []*sexpr) binary.LabelIdx {
+	s := ip.operand(name, items)
+	if !isID(s) {
+		return parseU32(s)
+	}
+	for depth := 0; depth < len(ip.labels); depth++ {
+		if ip.labels[len(ip.labels)-1-depth] == s.atom {
+			return binary.LabelIdx(depth)
+		}
+	}
+	fail(s, "unknown label %s", s.atom)
+	return 0
+}
+
+// parseBlockType reads the type use of a block. No type or a single
+// result is encoded inline, other signatures use a type index.
+func (ip *instrParser) parseBlockType(items []*sexpr) (binary.BlockType, []*sexpr) {
+	if len(items) > 0 && items[0].head() == "type" {
+		typeIdx, _, rest := ip.parseTypeUse(items, nil)
+		return binary.BlockType(typeIdx), rest
+	}
+
+	params, results, rest := ip.parseSignature(items, nil)
+	switch {
+	case len(params) == 0 && len(results) == 0:
+		return binary.BlockTypeEmpty, rest
+	case len(params) == 0 && len(results) == 1:
+		// 单个值类型编码为一个字节的 s33
+		return binary.BlockType(int64(results[0]) - 0x80), rest
+	}
+	ft := binary.FuncType{Tag: binary.FtTag, ParamTypes: params, ResultTypes: results}
+	return binary.BlockType(ip.typeIdxOf(ft)), rest
+}
+
+func (ip *instrParser) optionalTable(items []*sexpr) (uint32, []*sexpr) {
+	if len(items) > 0 && isIndex(items[0]) {
+		return ip.resolve(items[0], ip.tableIDs, "table"), items[1:]
+	}
+	return 0, items
+}
+
+func (ip *instrParser) parseMiscArgs(name *sexpr, sub uint32, items []*sexpr) (interface{}, []*sexpr) {
+	switch sub {
+	case binary.MemoryInit, binary.DataDrop, binary.ElemDrop:
+		return parseU32(ip.operand(name, items)), items[1:]
+	case binary.TableInit:
+		args := binary.TableInitArgs{}
+		if len(items) > 1 && isIndex(items[1]) {
+			args.Table = ip.resolve(items[0], ip.tableIDs, "table")
+			items = items[1:]
+		}
+		args.Elem = parseU32(ip.operand(name, items))
+		return args, items[1:]
+	case binary.TableCopy:
+		args := binary.TableCopyArgs{}
+		if len(items) > 1 && isIndex(items[0]) && isIndex(items[1]) {
+			args.Dst = ip.resolve(items[0], ip.tableIDs, "table")
+			args.Src = ip.resolve(items[1], ip.tableIDs, "table")
+			items = items[2:]
+		}
+		return args, items
+	case binary.TableGrow, binary.TableSize, binary.TableFill:
+		return ip.optionalTable(items)
+	}
+	return nil, items
+}
+
+// parseMemArg reads the optional offset=N and align=N of a load or store,
+// the alignment defaults to the natural one
+func (ip *instrParser) parseMemArg(instr binary.Instruction, items []*sexpr) (binary.MemArg, []*sexpr) {
+	memArg := binary.MemArg{}
+	memArg.Align, _ = binary.NaturalAlignment(instr)
+	if len(items) > 0 && !items[0].isList && strings.HasPrefix(items[0].atom, "offset=") {
+		memArg.Offset = parseU32(&sexpr{atom: items[0].atom[len("offset="):], line: items[0].line})
+		items = items[1:]
+	}
+	if len(items) > 0 && !items[0].isList && strings.HasPrefix(items[0].atom, "align=") {
+		align := parseU32(&sexpr{atom: items[0].atom[len("align="):], line: items[0].line})
+		if align == 0 || align&(align-1) != 0 {
+			fail(items[0], "alignment must be a power of two")
+		}
+		memArg.Align = uint32(bits.TrailingZeros32(align))
+		items = items[1:]
+	}
+	return memArg, items
+}
+
+// splitNum removes the sign and the underscores of a number and tells
+// whether it is hexadecimal
+func splitNum(s string) (neg bool, digits string, base int) {
+	switch {
+	case strings.HasPrefix(s, "-"):
+		neg, s = true, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	s = strings.ReplaceAll(s, "_", "")
+	if strings.HasPrefix(s, "0x") {
+		return neg, s[2:], 16
+	}
+	return neg, s, 10
+}
+
+func parseU32(s *sexpr) uint32 {
+	neg, digits, base := splitNum(s.atom)
+	n, err := strconv.ParseUint(digits, base, 32)
+	if neg || s.isList || s.quoted || err != nil {
+		fail(s, "u32 expected, got %s", s)
+	}
+	return uint32(n)
+}
+
+// parseI32 accepts signed and unsigned 32-bit numbers
+func parseI32(s *sexpr) int32 {
+	neg, digits, base := splitNum(s.atom)
+	n, err := strconv.ParseUint(digits, base, 32)
+	if err != nil || neg && n > 1<<31 {
+		fail(s, "i32 constant expected, got %s", s)
+	}
+	if neg {
+		return int32(-int64(n))
+	}
+	return int32(uint32(n))
+}
+
+// parseI64 accepts signed and unsigned 64-bit numbers
+func parseI64(s *sexpr) int64 {
+	neg, digits, base := splitNum(s.atom)
+	n, err := strconv.ParseUint(digits, base, 64)
+	if err != nil || neg && n > 1<<63 {
+		fail(s, "i64 constant expected, got %s", s)
+	}
+	if neg {
+		return int64(-n)
+	}
+	return int64(n)
+}
+
+// parseFloat parses a float of bitSize bits, including inf, nan and
+// nan:0x... with a payload
+func parseFloat(s *sexpr, bitSize int) float64 {
+	neg, digits, base := splitNum(s.atom)
+	var f float64
+	switch {
+	case digits == "inf":
+		f = math.Inf(1)
+	case digits == "nan" || strings.HasPrefix(digits, "nan:0x"):
+		payload := uint64(1) << 51
+		if bitSize == 32 {
+			payload = 1 << 22
+		}
+		if digits != "nan" {
+			n, err := strconv.ParseUint(digits[len("nan:0x"):], 16, 64)
+			if err != nil || n == 0 || n >= payload<<1 {
+				fail(s, "malformed NaN payload %s", s)
+			}
+			payload = n
+		}
+		if bitSize == 32 {
+			bits := uint32(0x7F800000) | uint32(payload)
+			if neg {
+				bits |= 1 << 31
+			}
+			// float32 NaN 转换为 float64 再转回来, 载荷保持不变
+			return float64(math.Float32frombits(bits))
+		}
+		bits := uint64(0x7FF0000000000000) | payload
+		if neg {
+			bits |= 1 << 63
+		}
+		return math.Float64frombits(bits)
+	default:
+		if base == 16 {
+			digits = "0x" + digits
+			if !strings.ContainsAny(digits, "pP") {
+				digits += "p0"
+			}
+		}
+		var err error
+		f, err = strconv.ParseFloat(digits, bitSize)
+		if err != nil {
+			fail(s, "f%d constant expected, got %s", bitSize, s)
+		}
+	}
+	if neg {
+		f = -f
+	}
+	return f
+}
@@ -0,0 +1,582 @@
+package text
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+// ParseWat parses a module in the text format. Only a subset is
+// supported: the type, import, func, table, memory, global, export,
+// start, elem and data fields in their MVP forms, with instructions in
+// the flat form. Plain instructions may be folded, block, loop and if
+// may not. Other constructs are reported as unsupported.
+func ParseWat(r io.Reader) (module binary.Module, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch x := r.(type) {
+			case error:
+				err = x
+			default:
+				err = errors.New("unknown error")
+			}
+		}
+	}()
+
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return binary.Module{}, err
+	}
+
+	fields := readSexprs(string(src))
+	if len(fields) == 1 && fields[0].head() == "module" {
+		fields = fields[0].list[1:]
+		if len(fields) > 0 && isID(fields[0]) {
+			fields = fields[1:]
+		}
+	}
+
+	p := newWatParser()
+	p.parseModule(fields)
+	return p.module, nil
+}
+
+type watParser struct {
+	module binary.Module
+	// identifiers of each index space
+	typeIDs, funcIDs, tableIDs, memIDs, globalIDs map[string]uint32
+	funcCount, tableCount, memCount, globalCount  uint32
+}
+
+func newWatParser() *watParser {
+	return &watParser{
+		module: binary.Module{
+			Magic:   binary.MagicNumber,
+			Version: binary.Version,
+		},
+		typeIDs:   make(map[string]uint32),
+		funcIDs:   make(map[string]uint32),
+		tableIDs:  make(map[string]uint32),
+		memIDs:    make(map[string]uint32),
+		globalIDs: make(map[string]uint32),
+	}
+}
+
+func fail(s *sexpr, format string, a ...interface{}) {
+	panic(fmt.Errorf("line %d: %s", s.line, fmt.Sprintf(format, a...)))
+}
+
+func isID(s *sexpr) bool {
+	return !s.isList && !s.quoted && strings.HasPrefix(s.atom, "$")
+}
+
+// parseModule makes three passes over the fields: types first, since
+// type uses may refer to types defined later, then the identifiers of
+// every index space, and finally everything else
+func (p *watParser) parseModule(fields []*sexpr) {
+	for _, f := range fields {
+		if !f.isList {
+			fail(f, "module field expected, got %s", f)
+		}
+		if f.head() == "type" {
+			p.parseType(f)
+		}
+	}
+	for _, f := range fields {
+		p.bindField(f)
+	}
+	for _, f := range fields {
+		switch f.head() {
+		case "type", "import":
+		case "func":
+			p.parseFunc(f)
+		case "table":
+			p.parseTable(f)
+		case "memory":
+			p.parseMemory(f)
+		case "global":
+			p.parseGlobal(f)
+		case "export":
+			p.parseExport(f)
+		case "start":
+			if len(f.list) != 2 {
+				fail(f, "malformed start")
+			}
+			idx := p.resolve(f.list[1], p.funcIDs, "function")
+			p.module.StartSec = &idx
+		case "elem":
+			p.parseElem(f)
+		case "data":
+			p.parseData(f)
+		default:
+			fail(f, "unsupported module field: %s", f.head())
+		}
+	}
+}
+
+func (p *watParser) parseType(f *sexpr) {
+	items := f.list[1:]
+	if len(items) > 0 && isID(items[0]) {
+		p.bind(p.typeIDs, items[0], uint32(len(p.module.TypeSec)))
+		items = items[1:]
+	}
+	if len(items) != 1 || items[0].head() != "func" {
+		fail(f, "malformed type, expected (func ...)")
+	}
+	params, results, rest := p.parseSignature(items[0].list[1:], nil)
+	if len(rest) > 0 {
+		fail(rest[0], "unexpected %s in type", rest[0])
+	}
+	p.module.TypeSec = append(p.module.TypeSec, binary.FuncType{
+		Tag:         binary.FtTag,
+		ParamTypes:  params,
+		ResultTypes: results,
+	})
+}
+
+// bindField binds the identifier of a func, table, memory or global, and
+// reads imports, which must come before the definitions of their kind
+func (p *watParser) bindField(f *sexpr) {
+	var ids map[string]uint32
+	var count *uint32
+	switch f.head() {
+	case "func":
+		ids, count = p.funcIDs, &p.funcCount
+	case "table":
+		ids, count = p.tableIDs, &p.tableCount
+	case "memory":
+		ids, count = p.memIDs, &p.memCount
+	case "global":
+		ids, count = p.globalIDs, &p.globalCount
+	case "import":
+		p.parseImport(f)
+		return
+	default:
+		return
+	}
+
+	for _, item := range f.list[1:] {
+		if item.head() == "import" {
+			fail(item, "inline imports are not supported")
+		}
+	}
+	if len(f.list) > 1 && isID(f.list[1]) {
+		p.bind(ids, f.list[1], *count)
+	}
+	*count++
+}
+
+func (p *watParser) bind(ids map[string]uint32, id *sexpr, idx uint32) {
+	if _, ok := ids[id.atom]; ok {
+		fail(id, "duplicate identifier %s", id.atom)
+	}
+	ids[id.atom] = idx
+}
+
+// resolve returns the index an identifier or a number refers to
+func (p *watParser) resolve(s *sexpr, ids map[string]uint32, kind string) uint32 {
+	if isID(s) {
+		idx, ok := ids[s.atom]
+		if !ok {
+			fail(s, "unknown %s %s", kind, s.atom)
+		}
+		return idx
+	}
+	if s.isList || s.quoted {
+		fail(s, "%s index expected, got %s", kind, s)
+	}
+	return parseU32(s)
+}
+
+func (p *watParser) parseImport(f *sexpr) {
+	if len(f.list) != 4 || !f.list[1].quoted || !f.list[2].quoted || !f.list[3].isList {
+		fail(f, "malformed import")
+	}
+	imp := binary.Import{Module: f.list[1].atom, Name: f.list[2].atom}
+	desc := f.list[3]
+	items := desc.list[1:]
+
+	var ids map[string]uint32
+	var count *uint32
+	switch desc.head() {
+	case "func":
+		imp.Desc.Tag = binary.ImportTagFunc
+		ids, count = p.funcIDs, &p.funcCount
+	case "table":
+		imp.Desc.Tag = binary.ImportTagTable
+		ids, count = p.tableIDs, &p.tableCount
+	case "memory":
+		imp.Desc.Tag = binary.ImportTagMem
+		ids, count = p.memIDs, &p.memCount
+	case "global":
+		imp.Desc.Tag = binary.ImportTagGlobal
+		ids, count = p.globalIDs, &p.globalCount
+	default:
+		fail(desc, "unsupported import kind: %s", desc.head())
+	}
+	// the count includes the definitions bound so far
+	if *count > p.importedCount(imp.Desc.Tag) {
+		fail(f, "import after the definition of a %s", desc.head())
+	}
+	if len(items) > 0 && isID(items[0]) {
+		p.bind(ids, items[0], *count)
+		items = items[1:]
+	}
+	*count++
+
+	switch desc.head() {
+	case "func":
+		var rest []*sexpr
+		imp.Desc.FuncType, _, rest = p.parseTypeUse(items, nil)
+		if len(rest) > 0 {
+			fail(rest[0], "unexpected %s in import", rest[0])
+		}
+	case "table":
+		imp.Desc.Table = p.parseTableType(desc, items)
+	case "memory":
+		imp.Desc.Mem = p.parseLimits(desc, items)
+	case "global":
+		if len(items) != 1 {
+			fail(desc, "malformed global import")
+		}
+		imp.Desc.Global = p.parseGlobalType(items[0])
+	}
+	p.module.ImportSec = append(p.module.ImportSec, imp)
+}
+
+// parseSignature reads (param ...) and (result ...) lists from the start
+// of items and returns what follows them. The identifiers of named
+// params are bound in localIDs if it is not nil.
+func (p *watParser) parseSignature(items []*sexpr, localIDs map[string]uint32) (params, results []binary.ValType, rest []*sexpr) {
+	for len(items) > 0 && items[0].head() == "param" {
+		params = p.parseValTypeList(items[0], params, localIDs)
+		items = items[1:]
+	}
+	for len(items) > 0 && items[0].head() == "result" {
+		results = p.parseValTypeList(items[0], results, nil)
+		items = items[1:]
+	}
+	return params, results, items
+}
+
+// parseValTypeList appends the types of a param, result or local list to
+// vts. A list with an identifier declares exactly one value.
+func (p *watParser) parseValTypeList(list *sexpr, vts []binary.ValType, ids map[string]uint32) []binary.ValType {
+	items := list.list[1:]
+	if len(items) > 0 && isID(items[0]) {
+		if list.head() == "result" {
+			fail(items[0], "results can not be named")
+		}
+		if len(items) != 2 {
+			fail(list, "a named %s must have exactly one type", list.head())
+		}
+		if ids != nil {
+			p.bind(ids, items[0], uint32(len(vts)))
+		}
+		items = items[1:]
+	}
+	for _, item := range items {
+		vts = append(vts, parseValType(item))
+	}
+	return vts
+}
+
+// parseTypeUse reads an optional (type x) followed by a signature. The
+// signature must match the type if both are given, a signature alone
+// uses the first equal type or adds one.
+func (p *watParser) parseTypeUse(items []*sexpr, localIDs map[string]uint32) (binary.TypeIdx, binary.FuncType, []*sexpr) {
+	var typeIdx binary.TypeIdx
+	hasType := false
+	if len(items) > 0 && items[0].head() == "type" {
+		if len(items[0].list) != 2 {
+			fail(items[0], "malformed type use")
+		}
+		typeIdx = p.resolve(items[0].list[1], p.typeIDs, "type")
+		if int(typeIdx) >= len(p.module.TypeSec) {
+			fail(items[0], "unknown type %d", typeIdx)
+		}
+		hasType = true
+		items = items[1:]
+	}
+
+	start := items
+	params, results, rest := p.parseSignature(items, localIDs)
+	ft := binary.FuncType{Tag: binary.FtTag, ParamTypes: params, ResultTypes: results}
+	if hasType {
+		declared := p.module.TypeSec[typeIdx]
+		if len(rest) != len(start) && !declared.Equal(ft) {
+			fail(start[0], "signature does not match type %d", typeIdx)
+		}
+		return typeIdx, declared, rest
+	}
+	return p.typeIdxOf(ft), ft, rest
+}
+
+func (p *watParser) typeIdxOf(ft binary.FuncType) binary.TypeIdx {
+	for i, t := range p.module.TypeSec {
+		if t.Equal(ft) {
+			return binary.TypeIdx(i)
+		}
+	}
+	p.module.TypeSec = append(p.module.TypeSec, ft)
+	return binary.TypeIdx(len(p.module.TypeSec) - 1)
+}
+
+// parseInlineExports reads (export "name") lists from the start of items
+func (p *watParser) parseInlineExports(items []*sexpr, tag byte, idx uint32) []*sexpr {
+	for len(items) > 0 && items[0].head() == "export" {
+		if len(items[0].list) != 2 || !items[0].list[1].quoted {
+			fail(items[0], "malformed inline export")
+		}
+		p.module.ExportSec = append(p.module.ExportSec, binary.Export{
+			Name: items[0].list[1].atom,
+			Desc: binary.ExportDesc{Tag: tag, Idx: idx},
+		})
+		items = items[1:]
+	}
+	return items
+}
+
+// skipID skips the identifier bound by bindField
+func skipID(f *sexpr) []*sexpr {
+	items := f.list[1:]
+	if len(items) > 0 && isID(items[0]) {
+		items = items[1:]
+	}
+	return items
+}
+
+func (p *watParser) parseFunc(f *sexpr) {
+	idx := p.importedCount(binary.ImportTagFunc) + uint32(len(p.module.FuncSec))
+	items := p.parseInlineExports(skipID(f), binary.ExportTagFunc, idx)
+
+	localIDs := make(map[string]uint32)
+	typeIdx, ft, items := p.parseTypeUse(items, localIDs)
+
+	code := binary.Code{}
+	localCount := uint32(len(ft.ParamTypes))
+	for len(items) > 0 && items[0].head() == "local" {
+		locals := p.parseValTypeList(items[0], nil, nil)
+		if id := items[0].list[1]; isID(id) {
+			p.bind(localIDs, id, localCount)
+		}
+		for _, vt := range locals {
+			n := len(code.Locals)
+			if n > 0 && code.Locals[n-1].Type == vt {
+				code.Locals[n-1].N++
+			} else {
+				code.Locals = append(code.Locals, binary.Locals{N: 1, Type: vt})
+			}
+			localCount++
+		}
+		items = items[1:]
+	}
+
+	ip := &instrParser{watParser: p, localIDs: localIDs, labels: []string{""}}
+	ip.parseInstrs(items)
+	if len(ip.labels) != 1 {
+		fail(f, "unterminated block in function")
+	}
+	code.Expr = append(ip.expr, binary.Instruction{Opcode: binary.End})
+
+	p.module.FuncSec = append(p.module.FuncSec, typeIdx)
+	p.module.CodeSec = append(p.module.CodeSec, code)
+}
+
+func (p *watParser) importedCount(tag byte) uint32 {
+	n := uint32(0)
+	for _, imp := range p.module.ImportSec {
+		if imp.Desc.Tag == tag {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *watParser) parseTable(f *sexpr) {
+	idx := p.importedCount(binary.ImportTagTable) + uint32(len(p.module.TableSec))
+	items := p.parseInlineExports(skipID(f), binary.ExportTagTable, idx)
+	p.module.TableSec = append(p.module.TableSec, p.parseTableType(f, items))
+}
+
+func (p *watParser) parseMemory(f *sexpr) {
+	idx := p.importedCount(binary.ImportTagMem) + uint32(len(p.module.MemSec))
+	items := p.parseInlineExports(skipID(f), binary.ExportTagMem, idx)
+	p.module.MemSec = append(p.module.MemSec, p.parseLimits(f, items))
+}
+
+func (p *watParser) parseGlobal(f *sexpr) {
+	idx := p.importedCount(binary.ImportTagGlobal) + uint32(len(p.module.GlobalSec))
+	items := p.parseInlineExports(skipID(f), binary.ExportTagGlobal, idx)
+	if len(items) == 0 {
+		fail(f, "missing global type")
+	}
+	p.module.GlobalSec = append(p.module.GlobalSec, binary.Global{
+		Type: p.parseGlobalType(items[0]),
+		Init: p.parseConstExpr(items[1:]),
+	})
+}
+
+func (p *watParser) parseExport(f *sexpr) {
+	if len(f.list) != 3 || !f.list[1].quoted || len(f.list[2].list) != 2 {
+		fail(f, "malformed export")
+	}
+	desc := f.list[2]
+	exp := binary.Export{Name: f.list[1].atom}
+	switch desc.head() {
+	case "func":
+		exp.Desc.Tag = binary.ExportTagFunc
+		exp.Desc.Idx = p.resolve(desc.list[1], p.funcIDs, "function")
+	case "table":
+		exp.Desc.Tag = binary.ExportTagTable
+		exp.Desc.Idx = p.resolve(desc.list[1], p.tableIDs, "table")
+	case "memory":
+		exp.Desc.Tag = binary.ExportTagMem
+		exp.Desc.Idx = p.resolve(desc.list[1], p.memIDs, "memory")
+	case "global":
+		exp.Desc.Tag = binary.ExportTagGlobal
+		exp.Desc.Idx = p.resolve(desc.list[1], p.globalIDs, "global")
+	default:
+		fail(desc, "unsupported export kind: %s", desc.head())
+	}
+	p.module.ExportSec = append(p.module.ExportSec, exp)
+}
+
+// parseElem reads an active element segment of function indices:
+// (elem table? offset func? idx*)
+func (p *watParser) parseElem(f *sexpr) {
+	items := f.list[1:]
+	elem := binary.Elem{}
+	if len(items) > 0 && !items[0].isList {
+		elem.Table = p.resolve(items[0], p.tableIDs, "table")
+		items = items[1:]
+	} else if len(items) > 0 && items[0].head() == "table" && len(items[0].list) == 2 {
+		elem.Table = p.resolve(items[0].list[1], p.tableIDs, "table")
+		items = items[1:]
+	}
+	if len(items) == 0 || !items[0].isList {
+		fail(f, "only active element segments are supported")
+	}
+	elem.Offset = p.parseOffset(items[0])
+	items = items[1:]
+	if len(items) > 0 && !items[0].isList && items[0].atom == "func" {
+		items = items[1:]
+	}
+	for _, item := range items {
+		elem.Init = append(elem.Init, p.resolve(item, p.funcIDs, "function"))
+	}
+	p.module.ElemSec = append(p.module.ElemSec, elem)
+}
+
+// parseData reads an active data segment: (data memory? offset string*)
+func (p *watParser) parseData(f *sexpr) {
+	items := f.list[1:]
+	data := binary.Data{}
+	if len(items) > 0 && isID(items[0]) {
+		if _, ok := p.memIDs[items[0].atom]; !ok {
+			fail(items[0], "data segment identifiers are not supported")
+		}
+	}
+	if len(items) > 0 && !items[0].isList && !items[0].quoted {
+		data.Mem = p.resolve(items[0], p.memIDs, "memory")
+		items = items[1:]
+	} else if len(items) > 0 && items[0].head() == "memory" && len(items[0].list) == 2 {
+		data.Mem = p.resolve(items[0].list[1], p.memIDs, "memory")
+		items = items[1:]
+	}
+	if len(items) == 0 || !items[0].isList {
+		fail(f, "only active data segments are supported")
+	}
+	data.Offset = p.parseOffset(items[0])
+	for _, item := range items[1:] {
+		if !item.quoted {
+			fail(item, "string expected in data segment, got %s", item)
+		}
+		data.Init = append(data.Init, item.atom...)
+	}
+	p.module.DataSec = append(p.module.DataSec, data)
+}
+
+// parseOffset reads (offset instr*) or a single folded instruction
+func (p *watParser) parseOffset(s *sexpr) binary.Expr {
+	if s.head() == "offset" {
+		return p.parseConstExpr(s.list[1:])
+	}
+	return p.parseConstExpr([]*sexpr{s})
+}
+
+func (p *watParser) parseConstExpr(items []*sexpr) binary.Expr {
+	ip := &instrParser{watParser: p, labels: []string{""}}
+	ip.parseInstrs(items)
+	if len(ip.labels) != 1 {
+		fail(items[0], "unterminated block in constant expression")
+	}
+	return append(ip.expr, binary.Instruction{Opcode: binary.End})
+}
+
+func (p *watParser) parseGlobalType(s *sexpr) binary.GlobalType {
+	if s.head() == "mut" {
+		if len(s.list) != 2 {
+			fail(s, "malformed mutable global type")
+		}
+		return binary.GlobalType{ValType: parseValType(s.list[1]), Mut: binary.MutVar}
+	}
+	return binary.GlobalType{ValType: parseValType(s), Mut: binary.MutConst}
+}
+
+func (p *watParser) parseLimits(f *sexpr, items []*sexpr) binary.Limits {
+	switch len(items) {
+	case 1:
+		return binary.Limits{Min: parseU32(items[0])}
+	case 2:
+		return binary.Limits{Tag: 1, Min: parseU32(items[0]), Max: parseU32(items[1])}
+	}
+	fail(f, "malformed limits")
+	return binary.Limits{}
+}
+
+func (p *watParser) parseTableType(f *sexpr, items []*sexpr) binary.TableType {
+	if len(items) == 0 {
+		fail(f, "missing table element type")
+	}
+	var elemType byte
+	switch last := items[len(items)-1]; last.atom {
+	case "funcref", "anyfunc":
+		elemType = binary.FuncRef
+	case "externref":
+		elemType = binary.ExternRef
+	default:
+		fail(last, "unsupported table element type: %s", last)
+	}
+	return binary.TableType{
+		ElemType: elemType,
+		Limits:   p.parseLimits(f, items[:len(items)-1]),
+	}
+}
+
+func parseValType(s *sexpr) binary.ValType {
+	if !s.isList && !s.quoted {
+		switch s.atom {
+		case "i32":
+			return binary.ValTypeI32
+		case "i64":
+			return binary.ValTypeI64
+		case "f32":
+			return binary.ValTypeF32
+		case "f64":
+			return binary.ValTypeF64
+		case "v128":
+			return binary.ValTypeV128
+		case "funcref":
+			return binary.FuncRef
+		case "externref":
+			return binary.ExternRef
+		}
+	}
+	fail(s, "value type expected, got %s", s)
+	return 0
+}
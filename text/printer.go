@@ -0,0 +1,411 @@
+package text
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+type PrintOptions struct {
+	// Folded nests operands inside the instruction consuming them, like
+	// wasm2wat --fold-exprs. The default flat form keeps the original
+	// instruction order one per line.
+	Folded bool
+	// Names uses the function and local names of the "name" custom
+	// section as identifiers, where they are valid ones
+	Names bool
+}
+
+type printer struct {
+	w      io.Writer
+	module binary.Module
+	opts   PrintOptions
+	err    error
+
+	funcNames  map[binary.FuncIdx]string
+	localNames map[binary.LocalIdx]string
+}
+
+func PrintFunc(w io.Writer, m binary.Module, idx binary.FuncIdx, opts PrintOptions) error {
+	importedFuncCount := 0
+	for _, imp := range m.ImportSec {
+		if imp.Desc.Tag == binary.ImportTagFunc {
+			importedFuncCount++
+		}
+	}
+	if int(idx) < importedFuncCount {
+		return fmt.Errorf("function %d is imported", idx)
+	}
+	codeIdx := int(idx) - importedFuncCount
+	if codeIdx >= len(m.CodeSec) || codeIdx >= len(m.FuncSec) {
+		return fmt.Errorf("function index out of range: %d", idx)
+	}
+
+	p := &printer{w: w, module: m, opts: opts}
+	if opts.Names {
+		p.loadNames(idx)
+	}
+	typeIdx := m.FuncSec[codeIdx]
+	code := m.CodeSec[codeIdx]
+
+	if id, ok := p.funcID(idx); ok {
+		p.printf("(func %s (type %d)", id, typeIdx)
+	} else {
+		p.printf("(func (;%d;) (type %d)", idx, typeIdx)
+	}
+	var params []binary.ValType
+	if int(typeIdx) < len(m.TypeSec) {
+		ft := m.TypeSec[typeIdx]
+		params = ft.ParamTypes
+		if p.localNames != nil {
+			p.printNamedValTypes("param", 0, params)
+		} else {
+			p.printValTypes("param", params)
+		}
+		p.printValTypes("result", ft.ResultTypes)
+	}
+	p.printf("\n")
+	if p.localNames != nil {
+		locals := code.ExpandedLocals()
+		if len(locals) > 0 {
+			p.printf(" ")
+			p.printNamedValTypes("local", len(params), locals)
+			p.printf("\n")
+		}
+	} else {
+		for _, locals := range code.Locals {
+			p.printf("  (local")
+			for i := uint32(0); i < locals.N; i++ {
+				p.printf(" %s", binary.ValTypeToStr(locals.Type))
+			}
+			p.printf(")\n")
+		}
+	}
+
+	// the final End closes the function itself
+	expr := code.Expr
+	if n := len(expr); n > 0 && expr[n-1].Opcode == binary.End {
+		expr = expr[:n-1]
+	}
+	if opts.Folded {
+		f := &folder{module: m, labels: []int{len(p.funcResults(typeIdx))}}
+		nodes, _ := f.fold(expr, 0)
+		p.printNodes(nodes, 1)
+	} else {
+		p.printFlat(expr)
+	}
+	p.printf(")\n")
+
+	return p.err
+}
+
+func (p *printer) printf(format string, a ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, a...)
+	}
+}
+
+func (p *printer) printValTypes(kind string, vts []binary.ValType) {
+	if len(vts) == 0 {
+		return
+	}
+	p.printf(" (%s", kind)
+	for _, vt := range vts {
+		p.printf(" %s", binary.ValTypeToStr(vt))
+	}
+	p.printf(")")
+}
+
+// printNamedValTypes prints one declaration per value, so that each can
+// carry its name. vts[0] is local first.
+func (p *printer) printNamedValTypes(kind string, first int, vts []binary.ValType) {
+	for i, vt := range vts {
+		if id, ok := p.localID(binary.LocalIdx(first + i)); ok {
+			p.printf(" (%s %s %s)", kind, id, binary.ValTypeToStr(vt))
+		} else {
+			p.printf(" (%s %s)", kind, binary.ValTypeToStr(vt))
+		}
+	}
+}
+
+// loadNames reads the names of the functions and of the locals of
+// function fn, a malformed name section is ignored
+func (p *printer) loadNames(fn binary.FuncIdx) {
+	cs, ok := p.module.CustomSectionByName("name")
+	if !ok {
+		return
+	}
+	ns, err := binary.ParseNameSection(cs)
+	if err != nil {
+		return
+	}
+	p.funcNames = ns.FuncNames
+	p.localNames = ns.LocalNames[fn]
+}
+
+func (p *printer) funcID(idx binary.FuncIdx) (string, bool) {
+	return nameToID(p.funcNames[idx])
+}
+
+func (p *printer) localID(idx binary.LocalIdx) (string, bool) {
+	return nameToID(p.localNames[idx])
+}
+
+// nameToID returns $name if name only holds identifier characters
+func nameToID(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7F || strings.IndexByte("\"(),;[]{}", c) >= 0 {
+			return "", false
+		}
+	}
+	return "$" + name, true
+}
+
+// instrStr is instrToStr with the names of functions and locals
+func (p *printer) instrStr(instr binary.Instruction) string {
+	var id string
+	var ok bool
+	switch instr.Opcode {
+	case binary.Call, binary.RefFunc:
+		id, ok = p.funcID(instr.Args.(uint32))
+	case binary.LocalGet, binary.LocalSet, binary.LocalTee:
+		id, ok = p.localID(instr.Args.(uint32))
+	}
+	if ok {
+		return instr.GetOpname() + " " + id
+	}
+	return instrToStr(instr)
+}
+
+func (p *printer) funcResults(typeIdx binary.TypeIdx) []binary.ValType {
+	if int(typeIdx) < len(p.module.TypeSec) {
+		return p.module.TypeSec[typeIdx].ResultTypes
+	}
+	return nil
+}
+
+func (p *printer) printFlat(expr binary.Expr) {
+	depth := 1
+	for _, instr := range expr {
+		switch instr.Opcode {
+		case binary.End:
+			depth--
+		case binary.Else:
+			depth--
+		}
+		p.printf("%s%s\n", strings.Repeat("  ", depth), p.instrStr(instr))
+		switch instr.Opcode {
+		case binary.Block, binary.Loop, binary.If, binary.Else:
+			depth++
+		}
+	}
+}
+
+func (p *printer) printNodes(nodes []*node, depth int) {
+	for _, n := range nodes {
+		p.printNode(n, depth)
+		p.printf("\n")
+	}
+}
+
+func (p *printer) printNode(n *node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	p.printf("%s(%s", indent, p.instrStr(n.instr))
+	for _, child := range n.children {
+		p.printf("\n")
+		p.printNode(child, depth+1)
+	}
+
+	switch n.instr.Opcode {
+	case binary.Block, binary.Loop:
+		for _, child := range n.body {
+			p.printf("\n")
+			p.printNode(child, depth+1)
+		}
+	case binary.If:
+		p.printf("\n%s  (then", indent)
+		for _, child := range n.body {
+			p.printf("\n")
+			p.printNode(child, depth+2)
+		}
+		p.printf(")")
+		if n.hasElse {
+			p.printf("\n%s  (else", indent)
+			for _, child := range n.elseBody {
+				p.printf("\n")
+				p.printNode(child, depth+2)
+			}
+			p.printf(")")
+		}
+	}
+	p.printf(")")
+}
+
+// DisassembleFunc returns function idx in the flat text format, using the
+// names of the "name" custom section when there is one
+func DisassembleFunc(m binary.Module, idx binary.FuncIdx) (string, error) {
+	sb := &strings.Builder{}
+	if err := PrintFunc(sb, m, idx, PrintOptions{Names: true}); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// InstrString returns instr as it is written in the flat text format
+func InstrString(instr binary.Instruction) string {
+	return instrToStr(instr)
+}
+
+func instrToStr(instr binary.Instruction) string {
+	name := instr.GetOpname()
+	if name == "" {
+		name = fmt.Sprintf("<0x%02x>", instr.Opcode)
+	}
+
+	switch args := instr.Args.(type) {
+	case nil:
+		return name
+	case binary.BlockType:
+		if args == binary.BlockTypeEmpty {
+			return name
+		}
+		if vt, ok := args.ValType(); ok {
+			return name + " (result " + binary.ValTypeToStr(vt) + ")"
+		}
+		return fmt.Sprintf("%s (type %d)", name, args)
+	case binary.BrTableArgs:
+		sb := strings.Builder{}
+		sb.WriteString(name)
+		for _, l := range args.Labels {
+			sb.WriteString(" " + strconv.Itoa(int(l)))
+		}
+		sb.WriteString(" " + strconv.Itoa(int(args.Default)))
+		return sb.String()
+	case binary.CallIndirectArgs:
+		if args.Table != 0 {
+			return fmt.Sprintf("%s %d (type %d)", name, args.Table, args.Type)
+		}
+		return fmt.Sprintf("%s (type %d)", name, args.Type)
+	case []binary.ValType:
+		sb := strings.Builder{}
+		sb.WriteString(name + " (result")
+		for _, vt := range args {
+			sb.WriteString(" " + binary.ValTypeToStr(vt))
+		}
+		sb.WriteString(")")
+		return sb.String()
+	case binary.MemArg:
+		return name + memArgToStr(args, naturalAlign(instr))
+	case binary.MemLaneArgs:
+		return fmt.Sprintf("%s%s %d", name, memArgToStr(args.MemArg, naturalAlign(instr)), args.Lane)
+	case binary.V128:
+		sb := strings.Builder{}
+		sb.WriteString(name + " i8x16")
+		for _, b := range args {
+			sb.WriteString(" " + strconv.Itoa(int(b)))
+		}
+		return sb.String()
+	case binary.ShuffleArgs:
+		sb := strings.Builder{}
+		sb.WriteString(name)
+		for _, lane := range args {
+			sb.WriteString(" " + strconv.Itoa(int(lane)))
+		}
+		return sb.String()
+	case int32:
+		return fmt.Sprintf("%s %d", name, args)
+	case int64:
+		return fmt.Sprintf("%s %d", name, args)
+	case float32:
+		return name + " " + floatToStr(float64(args), 32)
+	case float64:
+		return name + " " + floatToStr(args, 64)
+	case binary.TableInitArgs:
+		return fmt.Sprintf("%s %d %d", name, args.Table, args.Elem)
+	case binary.TableCopyArgs:
+		return fmt.Sprintf("%s %d %d", name, args.Dst, args.Src)
+	case byte:
+		switch instr.Opcode {
+		case binary.RefNull:
+			if args == binary.FuncRef {
+				return name + " func"
+			}
+			return name + " extern"
+		case binary.MemorySize, binary.MemoryGrow, binary.PrefixAtomic:
+			return name
+		}
+		return fmt.Sprintf("%s %d", name, args)
+	case uint32:
+		return fmt.Sprintf("%s %d", name, args)
+	default:
+		return fmt.Sprintf("%s %v", name, args)
+	}
+}
+
+func floatToStr(f float64, bitSize int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bitSize)
+}
+
+func memArgToStr(memArg binary.MemArg, natural uint32) string {
+	s := ""
+	if memArg.Offset != 0 {
+		s += fmt.Sprintf(" offset=%d", memArg.Offset)
+	}
+	if memArg.Align != natural {
+		s += fmt.Sprintf(" align=%d", uint64(1)<<memArg.Align)
+	}
+	return s
+}
+
+// naturalAlign returns log2 of the access size of a load or store
+func naturalAlign(instr binary.Instruction) uint32 {
+	if instr.Opcode == binary.PrefixAtomic {
+		// 原子指令的对齐只能是自然对齐, 解码时已检查
+		return instr.Args.(binary.MemArg).Align
+	}
+	if instr.Opcode == binary.PrefixSIMD {
+		switch instr.SubOpcode {
+		case binary.V128Load8Splat, binary.V128Load8Lane, binary.V128Store8Lane:
+			return 0
+		case binary.V128Load16Splat, binary.V128Load16Lane, binary.V128Store16Lane:
+			return 1
+		case binary.V128Load32Splat, binary.V128Load32Lane, binary.V128Store32Lane,
+			binary.V128Load32Zero:
+			return 2
+		case binary.V128Load, binary.V128Store:
+			return 4
+		default:
+			return 3
+		}
+	}
+
+	switch instr.Opcode {
+	case binary.I32Load8S, binary.I32Load8U, binary.I64Load8S, binary.I64Load8U,
+		binary.I32Store8, binary.I64Store8:
+		return 0
+	case binary.I32Load16S, binary.I32Load16U, binary.I64Load16S, binary.I64Load16U,
+		binary.I32Store16, binary.I64Store16:
+		return 1
+	case binary.I32Load, binary.F32Load, binary.I64Load32S, binary.I64Load32U,
+		binary.I32Store, binary.F32Store, binary.I64Store32:
+		return 2
+	default:
+		return 3
+	}
+}
@@ -0,0 +1,51 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/aiialzy/wasmer/binary"
+)
+
+func TestDisassembleFunc(t *testing.T) {
+	names := []byte{
+		1, 6, 1, 0, 3, 'a', 'd', 'd', // function 0 is "add"
+		// local 0 is "x", local 2 "m " which is not a valid identifier
+		2, 10, 1, 0, 2, 0, 1, 'x', 2, 2, 'm', ' ',
+	}
+	m := binary.Module{
+		TypeSec: []binary.FuncType{{Tag: binary.FtTag, ParamTypes: []binary.ValType{binary.ValTypeI32, binary.ValTypeI32}}},
+		FuncSec: []binary.TypeIdx{0},
+		CodeSec: []binary.Code{{
+			Locals: []binary.Locals{{N: 1, Type: binary.ValTypeI64}},
+			Expr: binary.Expr{
+				{Opcode: binary.Block, Args: binary.BlockTypeEmpty},
+				{Opcode: binary.LocalGet, Args: uint32(0)},
+				{Opcode: binary.LocalGet, Args: uint32(2)},
+				{Opcode: binary.Call, Args: uint32(0)},
+				{Opcode: binary.End},
+				{Opcode: binary.End},
+			},
+		}},
+		CustomSecs: []binary.CustomSec{{Name: "name", Bytes: names}},
+	}
+	got, err := DisassembleFunc(m, 0)
+	if err != nil {
+		t.Fatalf("DisassembleFunc: %v", err)
+	}
+	want := `(func $add (type 0) (param $x i32) (param i32)
+  (local i64)
+  block
+    local.get $x
+    local.get 2
+    call $add
+  end
+)
+`
+	if got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := DisassembleFunc(m, 1); err == nil {
+		t.Fatalf("got no error for function 1, want one")
+	}
+}
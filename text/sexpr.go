@@ -0,0 +1,194 @@
+package text
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sexpr is an atom, a string or a parenthesized list
+type sexpr struct {
+	atom   string
+	quoted bool // atom is the content of a string
+	list   []*sexpr
+	isList bool
+	line   int
+}
+
+// head returns the keyword a list starts with, or ""
+func (s *sexpr) head() string {
+	if s.isList && len(s.list) > 0 && !s.list[0].isList && !s.list[0].quoted {
+		return s.list[0].atom
+	}
+	return ""
+}
+
+func (s *sexpr) String() string {
+	switch {
+	case s.isList:
+		return "(" + s.head() + " ...)"
+	case s.quoted:
+		return strconv.Quote(s.atom)
+	default:
+		return s.atom
+	}
+}
+
+type sexprReader struct {
+	src  string
+	pos  int
+	line int
+}
+
+func readSexprs(src string) []*sexpr {
+	r := &sexprReader{src: src, line: 1}
+	var sexprs []*sexpr
+	for {
+		r.skipSpace()
+		if r.pos >= len(r.src) {
+			return sexprs
+		}
+		sexprs = append(sexprs, r.read())
+	}
+}
+
+func (r *sexprReader) fail(format string, a ...interface{}) {
+	panic(fmt.Errorf("line %d: %s", r.line, fmt.Sprintf(format, a...)))
+}
+
+// skipSpace skips white space, line comments and block comments, which
+// may nest
+func (r *sexprReader) skipSpace() {
+	for r.pos < len(r.src) {
+		switch {
+		case r.src[r.pos] == '\n':
+			r.line++
+			r.pos++
+		case r.src[r.pos] == ' ' || r.src[r.pos] == '\t' || r.src[r.pos] == '\r':
+			r.pos++
+		case strings.HasPrefix(r.src[r.pos:], ";;"):
+			for r.pos < len(r.src) && r.src[r.pos] != '\n' {
+				r.pos++
+			}
+		case strings.HasPrefix(r.src[r.pos:], "(;"):
+			depth := 0
+			for {
+				switch {
+				case r.pos >= len(r.src):
+					r.fail("unterminated block comment")
+				case strings.HasPrefix(r.src[r.pos:], "(;"):
+					depth++
+					r.pos += 2
+				case strings.HasPrefix(r.src[r.pos:], ";)"):
+					depth--
+					r.pos += 2
+				default:
+					if r.src[r.pos] == '\n' {
+						r.line++
+					}
+					r.pos++
+				}
+				if depth == 0 {
+					break
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (r *sexprReader) read() *sexpr {
+	s := &sexpr{line: r.line}
+	switch r.src[r.pos] {
+	case '(':
+		r.pos++
+		s.isList = true
+		for {
+			r.skipSpace()
+			if r.pos >= len(r.src) {
+				r.fail("unexpected end of input, missing )")
+			}
+			if r.src[r.pos] == ')' {
+				r.pos++
+				return s
+			}
+			s.list = append(s.list, r.read())
+		}
+	case ')':
+		r.fail("unexpected )")
+	case '"':
+		s.atom = r.readString()
+		s.quoted = true
+	default:
+		start := r.pos
+		for r.pos < len(r.src) && !strings.ContainsRune(" \t\r\n()\";", rune(r.src[r.pos])) {
+			r.pos++
+		}
+		s.atom = r.src[start:r.pos]
+		if s.atom == "" {
+			r.fail("unexpected %q", r.src[r.pos])
+		}
+	}
+	return s
+}
+
+func (r *sexprReader) readString() string {
+	r.pos++ // "
+	sb := strings.Builder{}
+	for {
+		if r.pos >= len(r.src) || r.src[r.pos] == '\n' {
+			r.fail("unterminated string")
+		}
+		c := r.src[r.pos]
+		r.pos++
+		switch c {
+		case '"':
+			return sb.String()
+		case '\\':
+			sb.WriteString(r.readEscape())
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+func (r *sexprReader) readEscape() string {
+	if r.pos >= len(r.src) {
+		r.fail("unterminated string")
+	}
+	c := r.src[r.pos]
+	r.pos++
+	switch c {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	case '\\', '\'', '"':
+		return string(c)
+	case 'u':
+		end := strings.IndexByte(r.src[r.pos:], '}')
+		if !strings.HasPrefix(r.src[r.pos:], "{") || end < 0 {
+			r.fail("malformed unicode escape")
+		}
+		n, err := strconv.ParseUint(strings.ReplaceAll(r.src[r.pos+1:r.pos+end], "_", ""), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(n)) {
+			r.fail("malformed unicode escape")
+		}
+		r.pos += end + 1
+		return string(rune(n))
+	}
+
+	if r.pos >= len(r.src) {
+		r.fail("unterminated string")
+	}
+	n, err := strconv.ParseUint(r.src[r.pos-1:r.pos+1], 16, 8)
+	if err != nil {
+		r.fail("malformed escape \\%s", r.src[r.pos-1:r.pos+1])
+	}
+	r.pos++
+	return string([]byte{byte(n)})
+}